@@ -0,0 +1,99 @@
+// Command createadmin bootstraps the first administrator. It promotes an
+// existing user, or registers a new one when a password is given.
+//
+//	go run ./cmd/createadmin -email admin@example.com -password 'secret123'
+//	go run ./cmd/createadmin -phone +6281234567890
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/database"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/utils"
+
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the user to promote or create")
+	phone := flag.String("phone", "", "phone of the user to promote or create")
+	password := flag.String("password", "", "password for a new user, required when the user does not exist")
+	force := flag.Bool("force", false, "grant the role even if an admin already exists")
+	flag.Parse()
+
+	if (*email == "") == (*phone == "") {
+		log.Fatal("Provide exactly one of -email or -phone")
+	}
+	if *email != "" {
+		*email = utils.CanonicalEmail(*email)
+		if err := utils.EmailValidation(*email); err != nil {
+			log.Fatal("Invalid email format")
+		}
+	} else {
+		canonical, err := utils.CanonicalPhone(*phone)
+		if err != nil {
+			log.Fatal("Invalid phone number")
+		}
+		*phone = canonical
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+	cfg := config.Load()
+	utils.UsePasswordParams(cfg.Password.Argon2Params())
+
+	if err := database.Connect(cfg.DatabaseURL); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	if err := database.Migrate(); err != nil {
+		log.Fatal("Failed to run database migrations:", err)
+	}
+
+	access := services.NewAccessService(database.DB)
+	hasAdmin, err := access.HasAdmin()
+	if err != nil {
+		log.Fatal("Failed to look up existing admins:", err)
+	}
+	if hasAdmin && !*force {
+		log.Fatal("An admin already exists, grant roles through the admin API or pass -force")
+	}
+
+	query := database.DB.Where("email = ?", *email)
+	if *phone != "" {
+		query = database.DB.Where("phone = ?", *phone)
+	}
+
+	var user models.User
+	err = query.First(&user).Error
+	switch {
+	case err == nil:
+		log.Printf("Promoting existing user %d", user.ID)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := utils.PasswordLengthValidation(*password); err != nil {
+			log.Fatal("User does not exist, provide a -password of 8-32 characters to create it")
+		}
+		hashed, err := utils.HashPassword(*password)
+		if err != nil {
+			log.Fatal("Failed to hash password:", err)
+		}
+		user = models.User{Email: *email, Phone: *phone, Password: hashed}
+		if err := database.DB.Create(&user).Error; err != nil {
+			log.Fatal("Failed to create user:", err)
+		}
+		log.Printf("Created user %d", user.ID)
+	default:
+		log.Fatal("Failed to look up user:", err)
+	}
+
+	if err := access.Grant(user.ID, models.RoleAdmin, nil); err != nil {
+		log.Fatal("Failed to grant admin role:", err)
+	}
+	log.Printf("User %d is now an admin", user.ID)
+}
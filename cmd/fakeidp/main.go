@@ -0,0 +1,44 @@
+// Command fakeidp runs the in-process test OpenID Connect provider on a local
+// port so the OIDC login can be tried without a real identity provider.
+// Every authorization request is approved for the identity given by flags.
+//
+//	go run ./cmd/fakeidp -addr :9100 -client-id tutuplapak
+//	OIDC_PROVIDERS=local OIDC_LOCAL_ISSUER=http://localhost:9100 \
+//	OIDC_LOCAL_CLIENT_ID=tutuplapak \
+//	OIDC_LOCAL_REDIRECT_URL=http://localhost:8080/v1/login/oidc/local/callback go run main.go
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"tutuplapak/internal/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9100", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9100", "issuer URL as reached by the API")
+	clientID := flag.String("client-id", "tutuplapak", "accepted client id")
+	subject := flag.String("sub", "user-1", "subject of the logged in identity")
+	email := flag.String("email", "buyer@example.com", "email of the logged in identity")
+	verified := flag.Bool("email-verified", true, "whether the email is reported as verified")
+	name := flag.String("name", "Test Buyer", "name of the logged in identity")
+	flag.Parse()
+
+	provider, err := oidctest.NewProvider(*issuer, *clientID)
+	if err != nil {
+		log.Fatal("Failed to create provider:", err)
+	}
+	provider.SetIdentity(oidctest.Identity{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: *verified,
+		Name:          *name,
+	})
+
+	log.Printf("Fake OIDC provider %s listening on %s", *issuer, *addr)
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		log.Fatal(err)
+	}
+}
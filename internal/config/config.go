@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -13,12 +17,21 @@ import (
 
 // Config holds configuration values for the application
 type Config struct {
-	Environment string
-	Port        string
-	DatabaseURL string
-	JWTSecret   string
-	DB          *gorm.DB
-	MinIO       MinIOConfig
+	Environment   string
+	Port          string
+	DatabaseURL   string
+	JWTSecret     string
+	DB            *gorm.DB
+	MinIO         MinIOConfig
+	Auth          AuthConfig
+	PasswordReset PasswordResetConfig
+	Notification  NotificationConfig
+	Verification  VerificationConfig
+	Login         LoginProtectionConfig
+	TwoFactor     TwoFactorConfig
+	Password      PasswordHashConfig
+	OIDC          OIDCConfig
+	Product       ProductConfig
 }
 
 type MinIOConfig struct {
@@ -29,6 +42,134 @@ type MinIOConfig struct {
 	BucketName      string
 }
 
+type AuthConfig struct {
+	RefreshTokenTTL time.Duration
+	Signing         SigningConfig
+}
+
+// PasswordResetConfig limits how often reset tokens are sent. Requests over
+// MaxPerIP within Window are refused; over MaxPerContact they are accepted
+// but nothing is sent, so the answer does not reveal whether the account exists.
+type PasswordResetConfig struct {
+	TokenTTL      time.Duration
+	Window        time.Duration
+	MaxPerIP      int
+	MaxPerContact int
+}
+
+// SigningConfig controls how access tokens are signed.
+// HS256 uses JWT_SECRET; RS256 and EdDSA use PEM keys stored in KeysDir.
+type SigningConfig struct {
+	Algorithm string
+	KeysDir   string
+	// RotationInterval is the age at which the signing key is replaced, 0 disables rotation
+	RotationInterval time.Duration
+	// Retention is how long a replaced key keeps verifying tokens before it is deleted
+	Retention     time.Duration
+	CheckInterval time.Duration
+
+	// ActiveKeyID names the key that signs; without it the newest private key signs
+	ActiveKeyID string
+	// GenerateKeys lets a single instance create and rotate its own keys. Replicas
+	// must share keys mounted from a secret instead, so it is off by default.
+	GenerateKeys bool
+}
+
+// NotificationConfig selects how messages such as OTP codes are delivered.
+// Sender is "log" or "file"; the file sender appends to OutboxPath.
+type NotificationConfig struct {
+	Sender     string
+	OutboxPath string
+	// LogBodies makes the log sender print message bodies, codes and reset
+	// links included; only for local development
+	LogBodies bool
+}
+
+type VerificationConfig struct {
+	CodeTTL        time.Duration
+	MaxAttempts    int
+	ResendCooldown time.Duration
+}
+
+// LoginProtectionConfig limits password guessing on the login endpoints
+type LoginProtectionConfig struct {
+	// BackoffThreshold is the number of consecutive failures before delays start
+	BackoffThreshold int
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	// MaxFailures consecutive failures lock the account for LockoutDuration
+	MaxFailures     int
+	LockoutDuration time.Duration
+	// IPMaxFailures failures from one IP within IPWindow block that IP
+	IPMaxFailures int
+	IPWindow      time.Duration
+}
+
+// TwoFactorConfig controls TOTP enrollment and the second login step.
+// EncryptionKey protects TOTP secrets at rest and is required; secrets still
+// encrypted with one of PreviousEncryptionKeys are re-encrypted on next use.
+type TwoFactorConfig struct {
+	Issuer                 string
+	EncryptionKey          string
+	PreviousEncryptionKeys []string
+	ChallengeTTL           time.Duration
+	// MaxAttempts is the number of codes one login challenge accepts
+	MaxAttempts int
+	// MaxFailures consecutive invalid codes across challenges lock the second
+	// factor for LockoutDuration
+	MaxFailures     int
+	LockoutDuration time.Duration
+}
+
+// PasswordHashConfig holds the argon2id cost for new password hashes.
+// Stored hashes with other parameters are upgraded on the next login.
+type PasswordHashConfig struct {
+	// MemoryKiB is the memory cost in KiB
+	MemoryKiB   int
+	Iterations  int
+	Parallelism int
+	SaltLength  int
+	KeyLength   int
+}
+
+// Argon2Params converts the configuration for utils.UsePasswordParams
+func (c PasswordHashConfig) Argon2Params() utils.Argon2Params {
+	return utils.Argon2Params{
+		Memory:      uint32(c.MemoryKiB),
+		Iterations:  uint32(c.Iterations),
+		Parallelism: uint8(c.Parallelism),
+		SaltLength:  uint32(c.SaltLength),
+		KeyLength:   uint32(c.KeyLength),
+	}
+}
+
+// OIDCConfig lists the external identity providers users can log in with.
+// Providers are named in OIDC_PROVIDERS and configured with OIDC_<NAME>_* variables.
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+	// StateTTL is how long a started login may take to come back from the provider
+	StateTTL time.Duration
+}
+
+// ProductConfig limits what a single product and a product import may hold
+type ProductConfig struct {
+	// MaxImages is the largest gallery a product may have, cover included
+	MaxImages int
+	// ImportMaxRows and ImportMaxBytes bound an uploaded CSV or XLSX import
+	ImportMaxRows  int
+	ImportMaxBytes int64
+}
+
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must be registered with the provider and lead to the callback endpoint
+	RedirectURL string
+	Scopes      []string
+}
+
 func Load() *Config {
 	cfg := &Config{
 		Environment: getEnv("ENVIRONMENT", "development"),
@@ -42,6 +183,68 @@ func Load() *Config {
 			UseSSL:          getEnv("MINIO_USE_SSL", "false") == "true",
 			BucketName:      getEnv("MINIO_BUCKET_NAME", "tutuplapak-files"),
 		},
+		Auth: AuthConfig{
+			RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			Signing: SigningConfig{
+				Algorithm:        getEnv("JWT_SIGNING_ALG", "RS256"),
+				KeysDir:          getEnv("JWT_KEYS_DIR", "keys"),
+				RotationInterval: getEnvDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+				Retention:        getEnvDuration("JWT_KEY_RETENTION", 24*time.Hour),
+				CheckInterval:    getEnvDuration("JWT_KEY_CHECK_INTERVAL", 5*time.Minute),
+				ActiveKeyID:      getEnv("JWT_ACTIVE_KEY_ID", ""),
+				GenerateKeys:     getEnv("JWT_KEYS_GENERATE", "false") == "true",
+			},
+		},
+		PasswordReset: PasswordResetConfig{
+			TokenTTL:      getEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute),
+			Window:        getEnvDuration("PASSWORD_RESET_WINDOW", time.Hour),
+			MaxPerIP:      getEnvInt("PASSWORD_RESET_IP_MAX_REQUESTS", 10),
+			MaxPerContact: getEnvInt("PASSWORD_RESET_CONTACT_MAX_REQUESTS", 3),
+		},
+		Notification: NotificationConfig{
+			Sender:     getEnv("NOTIFICATION_SENDER", "log"),
+			OutboxPath: getEnv("NOTIFICATION_OUTBOX", "outbox/messages.jsonl"),
+			LogBodies:  getEnv("NOTIFICATION_LOG_BODIES", "false") == "true",
+		},
+		Verification: VerificationConfig{
+			CodeTTL:        getEnvDuration("OTP_TTL", 10*time.Minute),
+			MaxAttempts:    getEnvInt("OTP_MAX_ATTEMPTS", 5),
+			ResendCooldown: getEnvDuration("OTP_RESEND_COOLDOWN", time.Minute),
+		},
+		Login: LoginProtectionConfig{
+			BackoffThreshold: getEnvInt("LOGIN_BACKOFF_THRESHOLD", 3),
+			BackoffBase:      getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+			BackoffMax:       getEnvDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+			MaxFailures:      getEnvInt("LOGIN_MAX_FAILURES", 10),
+			LockoutDuration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			IPMaxFailures:    getEnvInt("LOGIN_IP_MAX_FAILURES", 50),
+			IPWindow:         getEnvDuration("LOGIN_IP_WINDOW", 15*time.Minute),
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:                 getEnv("TWO_FACTOR_ISSUER", "TutupLapak"),
+			EncryptionKey:          getEnv("TWO_FACTOR_ENCRYPTION_KEY", ""),
+			PreviousEncryptionKeys: getEnvList("TWO_FACTOR_PREVIOUS_ENCRYPTION_KEYS"),
+			ChallengeTTL:           getEnvDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+			MaxAttempts:            getEnvInt("TWO_FACTOR_MAX_ATTEMPTS", 5),
+			MaxFailures:            getEnvInt("TWO_FACTOR_MAX_FAILURES", 10),
+			LockoutDuration:        getEnvDuration("TWO_FACTOR_LOCKOUT_DURATION", 15*time.Minute),
+		},
+		Password: PasswordHashConfig{
+			MemoryKiB:   getEnvInt("PASSWORD_ARGON2_MEMORY_KIB", 64*1024),
+			Iterations:  getEnvInt("PASSWORD_ARGON2_ITERATIONS", 3),
+			Parallelism: getEnvInt("PASSWORD_ARGON2_PARALLELISM", 2),
+			SaltLength:  getEnvInt("PASSWORD_ARGON2_SALT_LENGTH", 16),
+			KeyLength:   getEnvInt("PASSWORD_ARGON2_KEY_LENGTH", 32),
+		},
+		OIDC: OIDCConfig{
+			Providers: loadOIDCProviders(),
+			StateTTL:  getEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+		},
+		Product: ProductConfig{
+			MaxImages:      getEnvInt("PRODUCT_MAX_IMAGES", 10),
+			ImportMaxRows:  getEnvInt("PRODUCT_IMPORT_MAX_ROWS", 1000),
+			ImportMaxBytes: int64(getEnvInt("PRODUCT_IMPORT_MAX_SIZE_MB", 5)) << 20,
+		},
 	}
 
 	// Initialize database
@@ -110,6 +313,72 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvDuration parses a duration such as "15m" or "720h" from the environment
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s, using default %s", key, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvInt parses an integer from the environment
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS, skipping incomplete ones
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProviderConfig{
+			Name:         strings.ToLower(name),
+			Issuer:       strings.TrimSuffix(getEnv(prefix+"ISSUER", ""), "/"),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       getEnvList(prefix + "SCOPES"),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			log.Printf("OIDC provider %s needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL, skipping", name, prefix, prefix, prefix)
+			continue
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// getEnvList splits a comma separated environment variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // Helper function to create string pointer
 // func stringPtr(s string) *string {
 // 	return &s
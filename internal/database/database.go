@@ -38,16 +38,44 @@ func Migrate() error {
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.FileUpload{},
+		&models.Category{},
 		&models.Product{},
+		&models.ProductVariant{},
+		&models.ProductImage{},
+		&models.ProductImport{},
 		&models.Purchase{},
 		&models.PurchaseItem{},
 		&models.PurchasePaymentProof{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.TokenRevocation{},
+		&models.ContactVerification{},
+		&models.PasswordResetToken{},
+		&models.PasswordResetAttempt{},
+		&models.LoginAttempt{},
+		&models.LoginThrottle{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
+		&models.LoginChallenge{},
+		&models.UserRole{},
+		&models.APIKey{},
+		&models.ContactCollision{},
+		&models.AuditEvent{},
+		&models.FileDeletion{},
+		&models.OIDCIdentity{},
+		&models.OIDCLoginState{},
+		&models.ReauthToken{},
 	)
 	if err != nil {
 		log.Printf("Migration error: %v", err)
 		return err
 	}
 
+	if err := runMigrations(); err != nil {
+		log.Printf("Data migration error: %v", err)
+		return err
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
@@ -0,0 +1,293 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// schemaMigration records a data migration that has been applied
+type schemaMigration struct {
+	Version   string `gorm:"primaryKey;type:varchar(64)"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migration changes existing data in a way AutoMigrate cannot. Each one runs
+// once, inside a transaction, in the order listed.
+type migration struct {
+	version string
+	run     func(tx *gorm.DB) error
+}
+
+var migrations = []migration{
+	{version: "20261017_normalize_user_contacts", run: normalizeUserContacts},
+	{version: "20261017_audit_events_append_only", run: protectAuditEvents},
+	{version: "20261017_product_category_column", run: addProductCategoryColumn},
+	{version: "20261017_product_search", run: addProductSearch},
+	{version: "20261017_product_categories", run: addProductCategories},
+	{version: "20261017_product_images", run: addProductCoverImages},
+	{version: "20261018_user_email_verified", run: markProviderEmailsVerified},
+	{version: "20261018_audit_events_anonymize", run: allowAuditAnonymization},
+}
+
+// migrationLockKey identifies the advisory lock held while data migrations
+// run, so instances starting together apply each migration once
+const migrationLockKey int64 = 0x7475747570 // "tutup"
+
+// runMigrations applies the data migrations that have not run yet
+func runMigrations() error {
+	// Advisory locks belong to a session, so everything runs on one connection
+	return DB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return err
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+				log.Printf("Failed to release the migration lock: %v", err)
+			}
+		}()
+
+		if err := conn.AutoMigrate(&schemaMigration{}); err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			var count int64
+			if err := conn.Model(&schemaMigration{}).Where("version = ?", m.version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			log.Printf("Applying migration %s", m.version)
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.run(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: m.version, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// normalizeUserContacts lower-cases emails and converts phones to E.164.
+// Users that would end up sharing a contact are not changed and are recorded
+// in contact_collisions instead.
+func normalizeUserContacts(tx *gorm.DB) error {
+	var users []models.User
+	if err := tx.Select("id", "email", "phone").Find(&users).Error; err != nil {
+		return err
+	}
+
+	emails := make(map[string][]models.User)
+	phones := make(map[string][]models.User)
+	for _, user := range users {
+		if user.Email != "" {
+			canonical := utils.CanonicalEmail(user.Email)
+			emails[canonical] = append(emails[canonical], user)
+		}
+		if user.Phone != "" {
+			canonical, err := utils.CanonicalPhone(user.Phone)
+			if err != nil {
+				log.Printf("Leaving unparseable phone of user %d unchanged", user.ID)
+				continue
+			}
+			phones[canonical] = append(phones[canonical], user)
+		}
+	}
+
+	if err := applyCanonicalContacts(tx, models.ContactTypeEmail, emails, func(u models.User) string { return u.Email }); err != nil {
+		return err
+	}
+	return applyCanonicalContacts(tx, models.ContactTypePhone, phones, func(u models.User) string { return u.Phone })
+}
+
+func applyCanonicalContacts(tx *gorm.DB, channel models.ContactType, groups map[string][]models.User, current func(models.User) string) error {
+	column := string(channel)
+	now := time.Now()
+
+	for canonical, group := range groups {
+		if len(group) > 1 {
+			userIDs := make([]uint, 0, len(group))
+			for _, user := range group {
+				userIDs = append(userIDs, user.ID)
+			}
+			log.Printf("Contact collision on %s %s between users %v", column, canonical, userIDs)
+
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "channel"}, {Name: "canonical"}},
+				DoUpdates: clause.AssignmentColumns([]string{"user_ids", "detected_at"}),
+			}).Create(&models.ContactCollision{
+				Channel:    channel,
+				Canonical:  canonical,
+				UserIDs:    userIDs,
+				DetectedAt: now,
+			}).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		user := group[0]
+		if current(user) == canonical {
+			continue
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update(column, canonical).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// protectAuditEvents makes audit_events append-only for every database client
+func protectAuditEvents(tx *gorm.DB) error {
+	if err := tx.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql`).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(`CREATE TRIGGER audit_events_append_only
+	BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()`).Error
+}
+
+// allowAuditAnonymization lets the append-only trigger accept the one update
+// account deletion needs: clearing the IP, user agent and the personal payload
+// keys listed in models.AuditPersonalPayloadKeys. Every other column must stay
+// unchanged and rows still cannot be deleted.
+func allowAuditAnonymization(tx *gorm.DB) error {
+	return tx.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'UPDATE'
+		AND NEW.id = OLD.id
+		AND NEW.user_id IS NOT DISTINCT FROM OLD.user_id
+		AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id
+		AND NEW.type = OLD.type
+		AND NEW.created_at = OLD.created_at
+		AND NEW.ip = ''
+		AND NEW.user_agent = ''
+		AND NEW.payload IS NOT DISTINCT FROM OLD.payload - ARRAY['identifier', 'target']
+	THEN
+		RETURN NEW;
+	END IF;
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql`).Error
+}
+
+// addProductCategoryColumn creates products.category on databases created
+// after AutoMigrate stopped managing it. Existing databases already have it.
+func addProductCategoryColumn(tx *gorm.DB) error {
+	return tx.Exec(`ALTER TABLE products ADD COLUMN IF NOT EXISTS category varchar(64) NOT NULL DEFAULT ''`).Error
+}
+
+// addProductSearchVector is the generated column behind the q parameter of GET /v1/product
+const addProductSearchVector = `ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(sku, '')), 'B') ||
+		setweight(to_tsvector('simple', coalesce(category, '')), 'C')
+	) STORED`
+
+// addProductSearch adds the full-text vector and trigram index used by the q
+// parameter of GET /v1/product. The 'simple' configuration is used because
+// product names mix Indonesian and English.
+func addProductSearch(tx *gorm.DB) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		addProductSearchVector,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)`,
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addProductCategories seeds the categories table with the former fixed
+// categories and any other value found in products.category, then points
+// every product at its category. products.category is widened to fit category
+// names; the search vector generated from it has to be dropped for that.
+func addProductCategories(tx *gorm.DB) error {
+	names := make([]string, 0, len(models.DefaultCategories))
+	for _, category := range models.DefaultCategories {
+		names = append(names, string(category))
+	}
+	var existing []string
+	if err := tx.Model(&models.Product{}).Distinct().Order("category").Pluck("category", &existing).Error; err != nil {
+		return err
+	}
+	names = append(names, existing...)
+
+	for i, name := range names {
+		slug := utils.Slugify(name)
+		if slug == "" {
+			log.Printf("Leaving products with category %q without a category", name)
+			continue
+		}
+
+		// Values differing only in case or punctuation share a slug and so a category
+		var category models.Category
+		if err := tx.Where(models.Category{Slug: slug}).
+			Attrs(models.Category{Name: name, SortOrder: i}).
+			FirstOrCreate(&category).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Product{}).
+			Where("category = ?", name).
+			UpdateColumn("category_id", category.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	statements := []string{
+		`ALTER TABLE products DROP COLUMN IF EXISTS search_vector`,
+		`ALTER TABLE products ALTER COLUMN category TYPE varchar(64)`,
+		addProductSearchVector,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addProductCoverImages starts the gallery of every existing product with its cover image
+func addProductCoverImages(tx *gorm.DB) error {
+	return tx.Exec(`INSERT INTO product_images (product_id, file_id, file_uri, file_thumbnail_uri, position, created_at)
+		SELECT id, file_id, file_uri, file_thumbnail_uri, 0, NOW() FROM products WHERE file_id <> ''
+		ON CONFLICT (product_id, file_id) DO NOTHING`).Error
+}
+
+// markProviderEmailsVerified trusts the emails of users created from, or
+// linked to, a provider identity that reported the same verified email
+func markProviderEmailsVerified(tx *gorm.DB) error {
+	return tx.Exec(`UPDATE users SET email_verified_at = NOW()
+		WHERE email_verified_at IS NULL AND email IS NOT NULL AND EXISTS (
+			SELECT 1 FROM oidc_identities WHERE oidc_identities.user_id = users.id AND oidc_identities.email = users.email
+		)`).Error
+}
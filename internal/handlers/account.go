@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AccountHandler struct {
+	db       *gorm.DB
+	accounts *services.AccountService
+	minio    *services.MinIOService
+	reauth   *services.ReauthService
+	audit    *services.AuditService
+}
+
+func NewAccountHandler(db *gorm.DB, accounts *services.AccountService, minio *services.MinIOService, reauth *services.ReauthService, audit *services.AuditService) *AccountHandler {
+	return &AccountHandler{
+		db:       db,
+		accounts: accounts,
+		minio:    minio,
+		reauth:   reauth,
+		audit:    audit,
+	}
+}
+
+// Export returns the caller's personal data as JSON, or as a ZIP archive that
+// also holds the uploaded files (GET /v1/user/export?format=json|zip)
+func (h *AccountHandler) Export(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "format must be json or zip",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	userIDUint := userID.(uint)
+	export, err := h.accounts.Export(userIDUint)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	recordAudit(h.audit, c, models.AuditAccountExported, &userIDUint, map[string]any{"format": format})
+
+	filename := fmt.Sprintf("tutuplapak-export-%d-%s", userIDUint, export.ExportedAt.Format("20060102"))
+	if format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".zip"))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	defer archive.Close()
+
+	entry, err := archive.Create("export.json")
+	if err != nil {
+		log.Printf("Failed to write account export: %v", err)
+		return
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		log.Printf("Failed to write account export: %v", err)
+		return
+	}
+
+	// Without object storage the archive only holds the metadata
+	if h.minio == nil {
+		return
+	}
+	for _, file := range export.Files {
+		if err := h.addObject(c, archive, file.FileID, file.FileURI); err != nil {
+			log.Printf("Failed to add file %s to account export: %v", file.FileID, err)
+		}
+	}
+}
+
+// addObject copies a stored file into the archive under files/<fileId>/
+func (h *AccountHandler) addObject(c *gin.Context, archive *zip.Writer, fileID, uri string) error {
+	objectName := h.minio.ObjectNameFromURI(uri)
+	if objectName == "" {
+		return nil
+	}
+
+	object, err := h.minio.GetObject(c.Request.Context(), objectName)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	entry, err := archive.Create(path.Join("files", fileID, path.Base(objectName)))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, object)
+	return err
+}
+
+// Delete anonymizes the caller's account after confirming the password or a
+// reauthentication token (DELETE /v1/user)
+func (h *AccountHandler) Delete(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide your password or a reauthentication token",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if !confirmPassword(c, h.reauth, &user, req.Password, req.ReauthToken, "Invalid password") {
+		return
+	}
+
+	scheduled, err := h.accounts.Delete(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	// The account's IPs and user agents were just scrubbed, so unlike other
+	// events this one records neither
+	if err := h.audit.Record(&models.AuditEvent{
+		UserID:  &user.ID,
+		ActorID: &user.ID,
+		Type:    models.AuditAccountDeleted,
+		Payload: map[string]any{"filesScheduled": scheduled},
+	}); err != nil {
+		log.Printf("Failed to record audit event %s: %v", models.AuditAccountDeleted, err)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Account deleted",
+	})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	db          *gorm.DB
+	access      *services.AccessService
+	revocations *services.RevocationService
+}
+
+func NewAdminHandler(db *gorm.DB, access *services.AccessService, revocations *services.RevocationService) *AdminHandler {
+	return &AdminHandler{
+		db:          db,
+		access:      access,
+		revocations: revocations,
+	}
+}
+
+// findUser loads the user named by the :userId path parameter, writing an error response if it fails
+func (h *AdminHandler) findUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "User not found",
+				Code:    http.StatusNotFound,
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+func (h *AdminHandler) respondWithUser(c *gin.Context, user *models.User) {
+	grants, err := h.access.Resolve(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AdminUserResponse{
+		ID:        user.ID,
+		Email:     user.Email,
+		Phone:     user.Phone,
+		Roles:     grants.Roles,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+// GetUser returns a user with their roles (GET /v1/admin/users/:userId)
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	h.respondWithUser(c, user)
+}
+
+// SetUserRoles replaces the roles of a user (PUT /v1/admin/users/:userId/roles)
+func (h *AdminHandler) SetUserRoles(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+	adminID := currentUserID.(uint)
+
+	var req models.SetRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: roles must be a list of admin or moderator",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	// Keep at least one admin able to manage roles
+	if user.ID == adminID {
+		keepsAdmin := false
+		for _, role := range req.Roles {
+			if role == models.RoleAdmin {
+				keepsAdmin = true
+			}
+		}
+		if !keepsAdmin {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "You cannot remove your own admin role",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	if err := h.access.SetRoles(user.ID, req.Roles, &adminID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	// Access tokens carry the old roles, force the user to refresh them
+	if err := h.revocations.RevokeUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.respondWithUser(c, user)
+}
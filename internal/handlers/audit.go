@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	audit *services.AuditService
+}
+
+func NewAuditHandler(audit *services.AuditService) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// recordAudit appends an event about userID, taking the actor, IP and user
+// agent from the request. Failures are logged and never fail the request.
+func recordAudit(audit *services.AuditService, c *gin.Context, eventType string, userID *uint, payload map[string]any) {
+	event := &models.AuditEvent{
+		UserID:    userID,
+		Type:      eventType,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Payload:   payload,
+	}
+	if actorID, exists := c.Get("user_id"); exists {
+		id := actorID.(uint)
+		event.ActorID = &id
+	}
+
+	if err := audit.Record(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", eventType, err)
+	}
+}
+
+// maskAccountNumber keeps the last four digits of a bank account number
+func maskAccountNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return "****" + number[len(number)-4:]
+}
+
+// ListSecurityEvents returns the caller's recent security events (GET /v1/user/security-events)
+func (h *AuditHandler) ListSecurityEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid limit",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid offset",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	events, err := h.audit.ListForUser(userID.(uint), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
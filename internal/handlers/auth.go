@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// deviceIDHeader lets clients send their device id without changing the request body
+	deviceIDHeader = "X-Device-ID"
+	// deviceNameHeader is a human readable device label shown in the session list
+	deviceNameHeader    = "X-Device-Name"
+	maxDeviceNameLength = 128
+)
+
+type AuthHandler struct {
+	db            *gorm.DB
+	refreshTokens *services.RefreshTokenService
+	access        *services.AccessService
+	revocations   *services.RevocationService
+	audit         *services.AuditService
+}
+
+// NewAuthHandler initializes AuthHandler with the given DB, refresh token store, role lookup, revocation list and audit log
+func NewAuthHandler(db *gorm.DB, refreshTokens *services.RefreshTokenService, access *services.AccessService, revocations *services.RevocationService, audit *services.AuditService) *AuthHandler {
+	return &AuthHandler{
+		db:            db,
+		refreshTokens: refreshTokens,
+		access:        access,
+		revocations:   revocations,
+		audit:         audit,
+	}
+}
+
+// resolveDeviceID picks the device id from the body, then the header,
+// and falls back to a freshly generated one the client should keep
+func resolveDeviceID(c *gin.Context, fromBody string) string {
+	if deviceID := strings.TrimSpace(fromBody); deviceID != "" {
+		return deviceID
+	}
+	if deviceID := strings.TrimSpace(c.GetHeader(deviceIDHeader)); deviceID != "" && len(deviceID) <= 64 {
+		return deviceID
+	}
+	return uuid.NewString()
+}
+
+// sessionClient describes the device making the request
+func sessionClient(c *gin.Context) models.SessionClient {
+	deviceName := strings.TrimSpace(c.GetHeader(deviceNameHeader))
+	if len(deviceName) > maxDeviceNameLength {
+		deviceName = deviceName[:maxDeviceNameLength]
+	}
+
+	return models.SessionClient{
+		DeviceName: deviceName,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+}
+
+// issueTokenPair starts a new session for the user and signs its first access token
+func issueTokenPair(c *gin.Context, refreshTokens *services.RefreshTokenService, access *services.AccessService, user *models.User, deviceID string) (*models.TokenPair, *models.ErrorResponse) {
+	session, refreshToken, err := refreshTokens.StartSession(user.ID, deviceID, sessionClient(c))
+	if err != nil {
+		return nil, &models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to create session",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	token, errResponse := tokenGeneration(access, user, session.ID)
+	if errResponse != nil {
+		return nil, errResponse
+	}
+
+	return &models.TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		DeviceID:     deviceID,
+		SessionID:    session.ID,
+	}, nil
+}
+
+// auditTokenIssued records a new session started by login or registration
+func auditTokenIssued(audit *services.AuditService, c *gin.Context, userID uint, tokens *models.TokenPair, method string) {
+	recordAudit(audit, c, models.AuditTokenIssued, &userID, map[string]any{
+		"method":    method,
+		"sessionId": tokens.SessionID,
+		"deviceId":  tokens.DeviceID,
+	})
+}
+
+// Refresh exchanges a refresh token for a new token pair (POST /v1/auth/refresh)
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide a refresh token and device id",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	session, refreshToken, err := h.refreshTokens.Rotate(req.RefreshToken, req.DeviceID, sessionClient(c))
+	if err != nil {
+		if errors.Is(err, services.ErrRefreshTokenInvalid) ||
+			errors.Is(err, services.ErrRefreshTokenReused) ||
+			errors.Is(err, services.ErrDeviceMismatch) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid or expired refresh token",
+				Code:    http.StatusUnauthorized,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, session.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Success: false,
+				Error:   "User does not exist",
+				Code:    http.StatusUnauthorized,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	// Roles are looked up again so grants and removals apply from the next refresh
+	token, errResponse := tokenGeneration(h.access, &user, session.ID)
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+
+	recordAudit(h.audit, c, models.AuditTokenRefreshed, &user.ID, map[string]any{
+		"sessionId": session.ID,
+		"deviceId":  session.DeviceID,
+	})
+
+	c.JSON(http.StatusOK, models.TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		DeviceID:     session.DeviceID,
+	})
+}
+
+// Logout revokes the presented access token and ends its session (POST /v1/auth/logout)
+func (h *AuthHandler) Logout(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+	userIDUint := userID.(uint)
+
+	if err := h.revocations.RevokeToken(userIDUint, c.GetString("jti"), c.GetTime("token_expires_at")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	// Tokens issued before sessions existed carry no session id
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		if err := h.refreshTokens.RevokeSession(userIDUint, sessionID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Server error",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+	}
+
+	recordAudit(h.audit, c, models.AuditLogout, &userIDUint, map[string]any{
+		"sessionId": c.GetString("session_id"),
+	})
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	})
+}
+
+// LogoutAll ends every session of the user on every device (POST /v1/auth/logout/all)
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	userIDUint := userID.(uint)
+
+	if err := h.refreshTokens.RevokeAllSessions(userIDUint); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	recordAudit(h.audit, c, models.AuditLogoutAll, &userIDUint, nil)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Logged out from all devices",
+		Data: gin.H{
+			"loggedOutAt": time.Now().UTC(),
+		},
+	})
+}
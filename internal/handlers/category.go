@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CategoryHandler struct {
+	categories *services.CategoryService
+}
+
+func NewCategoryHandler(categories *services.CategoryService) *CategoryHandler {
+	return &CategoryHandler{categories: categories}
+}
+
+// respondWithCategoryError maps category service errors to responses
+func respondWithCategoryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Category not found",
+			Code:    http.StatusNotFound,
+		})
+	case errors.Is(err, services.ErrCategoryInvalidSlug), errors.Is(err, services.ErrCategoryInvalidParent), errors.Is(err, services.ErrCategoryAttributes):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+	case errors.Is(err, services.ErrCategorySlugTaken), errors.Is(err, services.ErrCategoryInUse):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+			Code:    http.StatusConflict,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+	}
+}
+
+// categoryID parses the :categoryId path parameter, writing an error response if it fails
+func categoryID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("categoryId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid category ID",
+			Code:    http.StatusBadRequest,
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func bindCategoryInput(c *gin.Context) (models.CategoryInput, bool) {
+	var req models.CategoryInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide a name of at most 64 characters and valid attributes",
+			Code:    http.StatusBadRequest,
+		})
+		return req, false
+	}
+	return req, true
+}
+
+// List returns the category tree (GET /v1/category)
+func (h *CategoryHandler) List(c *gin.Context) {
+	tree, err := h.categories.Tree()
+	if err != nil {
+		respondWithCategoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    tree,
+	})
+}
+
+// Create adds a category (POST /v1/admin/categories)
+func (h *CategoryHandler) Create(c *gin.Context) {
+	req, ok := bindCategoryInput(c)
+	if !ok {
+		return
+	}
+
+	category, err := h.categories.Create(req)
+	if err != nil {
+		respondWithCategoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// Update replaces a category (PUT /v1/admin/categories/:categoryId)
+func (h *CategoryHandler) Update(c *gin.Context) {
+	id, ok := categoryID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindCategoryInput(c)
+	if !ok {
+		return
+	}
+
+	category, err := h.categories.Update(id, req)
+	if err != nil {
+		respondWithCategoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// Delete removes an unused category (DELETE /v1/admin/categories/:categoryId)
+func (h *CategoryHandler) Delete(c *gin.Context) {
+	id, ok := categoryID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.categories.Delete(id); err != nil {
+		respondWithCategoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Category deleted",
+	})
+}
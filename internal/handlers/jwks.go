@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"tutuplapak/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler publishes the public keys used to verify access tokens
+type JWKSHandler struct {
+	keys *middleware.KeyManager
+}
+
+func NewJWKSHandler(keys *middleware.KeyManager) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// JWKS returns the verification key set (GET /.well-known/jwks.json)
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	// Let verifiers cache the set, but short enough to pick up rotations quickly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 	"tutuplapak/internal/middleware"
 	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
 	"tutuplapak/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -11,16 +17,137 @@ import (
 )
 
 type LoginHandler struct {
-	db *gorm.DB
+	db            *gorm.DB
+	refreshTokens *services.RefreshTokenService
+	access        *services.AccessService
+	guard         *services.LoginGuard
+	twoFactor     *services.TwoFactorService
+	audit         *services.AuditService
 }
 
-// NewLoginHandler initializes LoginHandler with the given DB
-func NewLoginHandler(db *gorm.DB) *LoginHandler {
+// NewLoginHandler initializes LoginHandler with the given DB, refresh token store, role lookup, brute-force guard, two-factor service and audit log
+func NewLoginHandler(db *gorm.DB, refreshTokens *services.RefreshTokenService, access *services.AccessService, guard *services.LoginGuard, twoFactor *services.TwoFactorService, audit *services.AuditService) *LoginHandler {
 	return &LoginHandler{
-		db: db,
+		db:            db,
+		refreshTokens: refreshTokens,
+		access:        access,
+		guard:         guard,
+		twoFactor:     twoFactor,
+		audit:         audit,
 	}
 }
 
+// challengeSecondFactor answers with a login challenge instead of tokens when the
+// user has two-factor authentication enabled. It returns true if a response was written.
+func (h *LoginHandler) challengeSecondFactor(c *gin.Context, user *models.User, deviceID, identifier string) bool {
+	enabled, err := h.twoFactor.IsEnabled(user.ID)
+	if err == nil && !enabled {
+		return false
+	}
+
+	var (
+		challengeToken string
+		expiresAt      time.Time
+	)
+	if err == nil {
+		challengeToken, expiresAt, err = h.twoFactor.CreateChallenge(user.ID, deviceID, identifier)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return true
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+		ExpiresAt:         expiresAt,
+	})
+	return true
+}
+
+// setRetryAfter tells the client how many whole seconds to wait
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// allowAttempt responds with 429 and returns false when the guard blocks the login attempt
+func (h *LoginHandler) allowAttempt(c *gin.Context, identifier string) bool {
+	err := h.guard.Check(identifier, c.ClientIP())
+	if err == nil {
+		return true
+	}
+
+	var throttled *services.ThrottledError
+	if !errors.As(err, &throttled) {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return false
+	}
+
+	h.recordFailure(c, identifier, nil, services.LoginReasonThrottled)
+
+	message := "Too many failed login attempts, please try again later"
+	if throttled.Locked {
+		message = "Account temporarily locked due to too many failed login attempts"
+	}
+	setRetryAfter(c, throttled.RetryAfter)
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    http.StatusTooManyRequests,
+	})
+	return false
+}
+
+func (h *LoginHandler) recordFailure(c *gin.Context, identifier string, userID *uint, reason string) {
+	if err := h.guard.RecordFailure(identifier, c.ClientIP(), c.Request.UserAgent(), userID, reason); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	recordAudit(h.audit, c, models.AuditLoginFailed, userID, map[string]any{
+		"identifier": identifier,
+		"reason":     reason,
+	})
+}
+
+func (h *LoginHandler) recordSuccess(c *gin.Context, identifier string, userID uint) {
+	if err := h.guard.RecordSuccess(identifier, c.ClientIP(), c.Request.UserAgent(), userID); err != nil {
+		log.Printf("Failed to record login success: %v", err)
+	}
+	recordAudit(h.audit, c, models.AuditLoginSucceeded, &userID, map[string]any{
+		"identifier": identifier,
+	})
+}
+
+// upgradePasswordHash rehashes the password after a successful login when the
+// stored hash uses bcrypt or outdated argon2id parameters
+func (h *LoginHandler) upgradePasswordHash(user *models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+		return
+	}
+
+	// Only replace the hash that was verified, in case the password changed meanwhile
+	if err := h.db.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashedPassword).Error; err != nil {
+		log.Printf("Failed to store upgraded password hash for user %d: %v", user.ID, err)
+		return
+	}
+	user.Password = hashedPassword
+}
+
 func passwordValidation(userInput string, userPassword string) *models.ErrorResponse {
 	if err := utils.VerifyPassword(userInput, userPassword); err != nil {
 		errResponse := &models.ErrorResponse{
@@ -35,8 +162,18 @@ func passwordValidation(userInput string, userPassword string) *models.ErrorResp
 	return nil
 }
 
-func tokenGeneration(user *models.User) (string, *models.ErrorResponse) {
-	token, err := middleware.GenerateToken(user)
+// tokenGeneration signs an access token carrying the user's current roles and permissions
+func tokenGeneration(access *services.AccessService, user *models.User, sessionID string) (string, *models.ErrorResponse) {
+	grants, err := access.Resolve(user.ID)
+	if err != nil {
+		return "", &models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	token, err := middleware.GenerateToken(user, sessionID, grants)
 	if err != nil {
 		response := &models.ErrorResponse{
 			Success: false,
@@ -50,6 +187,123 @@ func tokenGeneration(user *models.User) (string, *models.ErrorResponse) {
 
 }
 
+// loginIdentifier is the brute-force protection key of a canonical contact
+func loginIdentifier(channel models.ContactType, contact string) string {
+	return string(channel) + ":" + contact
+}
+
+// authenticate checks the password of the user owning the canonical contact under
+// brute-force protection. On failure it writes the response and returns nil.
+// The throttle is only reset by completeLogin, after any second factor.
+func (h *LoginHandler) authenticate(c *gin.Context, channel models.ContactType, contact, password string) *models.User {
+	identifier := loginIdentifier(channel, contact)
+	if !h.allowAttempt(c, identifier) {
+		return nil
+	}
+
+	//  Check existing user
+	var user models.User
+	if err := h.db.Where(string(channel)+" = ?", contact).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			h.recordFailure(c, identifier, nil, services.LoginReasonUnknownUser)
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "User does not exist",
+				Code:    http.StatusNotFound,
+			})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return nil
+	}
+
+	// Verify Password
+	if err := passwordValidation(password, user.Password); err != nil {
+		h.recordFailure(c, identifier, &user.ID, services.LoginReasonInvalidPassword)
+		c.JSON(http.StatusUnauthorized, err)
+		return nil
+	}
+	h.upgradePasswordHash(&user, password)
+
+	return &user
+}
+
+// completeLogin answers with a two-factor challenge or a new token pair.
+// identifier is the login throttle key of a password login, reset once no
+// second factor is pending, and method names how the user authenticated.
+func (h *LoginHandler) completeLogin(c *gin.Context, user *models.User, identifier, deviceIDInput, method string) {
+	deviceID := resolveDeviceID(c, deviceIDInput)
+	if h.challengeSecondFactor(c, user, deviceID, identifier) {
+		return
+	}
+	if identifier != "" {
+		h.recordSuccess(c, identifier, user.ID)
+	}
+
+	// Generate Token
+	tokens, errResponse := issueTokenPair(c, h.refreshTokens, h.access, user, deviceID)
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+	auditTokenIssued(h.audit, c, user.ID, tokens, method)
+
+	c.JSON(http.StatusOK, models.LoginPhoneOutput{
+		Phone:        user.Phone,
+		Email:        user.Email,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		DeviceID:     tokens.DeviceID,
+	})
+}
+
+// Login accepts either an email or a phone number as identifier (POST /v1/login)
+func (h *LoginHandler) Login(ctx *gin.Context) {
+	var input models.LoginInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide an email or phone and a password",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var (
+		channel       = models.ContactTypePhone
+		contact       string
+		validationErr *models.ErrorResponse
+	)
+	if utils.IsEmailIdentifier(input.Identifier) {
+		channel = models.ContactTypeEmail
+		contact = utils.CanonicalEmail(input.Identifier)
+		if err := utils.EmailValidation(contact); err != nil {
+			validationErr = &models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid input: invalid email format",
+				Code:    http.StatusBadRequest,
+			}
+		}
+	} else {
+		contact, validationErr = utils.NormalizePhone(input.Identifier)
+	}
+	if validationErr != nil {
+		ctx.JSON(validationErr.Code, validationErr)
+		return
+	}
+
+	user := h.authenticate(ctx, channel, contact, input.Password)
+	if user == nil {
+		return
+	}
+
+	h.completeLogin(ctx, user, loginIdentifier(channel, contact), input.DeviceID, "password")
+}
+
 // Login handle user login requests
 func (h *LoginHandler) LoginEmail(context *gin.Context) {
 
@@ -66,6 +320,7 @@ func (h *LoginHandler) LoginEmail(context *gin.Context) {
 		return
 	}
 
+	inputUser.Email = utils.CanonicalEmail(inputUser.Email)
 	if err := utils.EmailValidation(inputUser.Email); err != nil {
 		response := models.ErrorResponse{
 			Success: false,
@@ -86,47 +341,12 @@ func (h *LoginHandler) LoginEmail(context *gin.Context) {
 		return
 	}
 
-	//  Check existing user
-	var user models.User
-	if err := h.db.Where("email = ?", inputUser.Email).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			response := models.ErrorResponse{
-				Success: false,
-				Error:   "User does not exist",
-				Code:    http.StatusNotFound,
-			}
-			context.JSON(http.StatusNotFound, response)
-			return
-		}
-		response := models.ErrorResponse{
-			Success: false,
-			Error:   "Server error",
-			Code:    http.StatusInternalServerError,
-		}
-		context.JSON(http.StatusInternalServerError, response)
-		return
-	}
-
-	// Password Hash Validation
-	err := passwordValidation(inputUser.Password, user.Password)
-	// Verify Password
-	if err != nil {
-		context.JSON(http.StatusUnauthorized, err)
+	user := h.authenticate(context, models.ContactTypeEmail, inputUser.Email, inputUser.Password)
+	if user == nil {
 		return
 	}
 
-	// Generate Token
-	token, err := tokenGeneration(&user)
-	if err != nil {
-		context.JSON(http.StatusInternalServerError, err)
-	}
-
-	// Login successfully
-	context.JSON(http.StatusOK, gin.H{
-		"email": user.Email,
-		"phone": "", // can be replace with: user.Phone if later exists
-		"token": token,
-	})
+	h.completeLogin(context, user, loginIdentifier(models.ContactTypeEmail, inputUser.Email), inputUser.DeviceID, "password")
 }
 
 func (h *LoginHandler) LoginPhone(ctx *gin.Context) {
@@ -142,9 +362,10 @@ func (h *LoginHandler) LoginPhone(ctx *gin.Context) {
 		return
 	}
 
-	// Check if phone number is valid
-	if err := utils.PhoneValidation(inputUser.Phone); err != nil {
-		ctx.JSON(err.Code, err)
+	// Check if phone number is valid, local numbers are converted to E.164
+	phone, validationErr := utils.NormalizePhone(inputUser.Phone)
+	if validationErr != nil {
+		ctx.JSON(validationErr.Code, validationErr)
 		return
 	}
 
@@ -154,52 +375,92 @@ func (h *LoginHandler) LoginPhone(ctx *gin.Context) {
 		return
 	}
 
-	// Check if user exists
-	var user models.User
-	if err := h.db.Where("phone = ?", inputUser.Phone).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			ctx.JSON(http.StatusNotFound, models.ErrorResponse{
-				Success: false,
-				Error:   "User does not exist",
-				Code:    http.StatusNotFound,
-			})
-			return
-		}
-		// Handle other database errors
-		ctx.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   "Database error",
-			Code:    http.StatusInternalServerError,
-		})
+	user := h.authenticate(ctx, models.ContactTypePhone, phone, inputUser.Password)
+	if user == nil {
 		return
 	}
 
-	// Verify Password
-	if err := utils.VerifyPassword(inputUser.Password, user.Password); err != nil {
-		ctx.JSON(http.StatusUnauthorized, models.ErrorResponse{
+	h.completeLogin(ctx, user, loginIdentifier(models.ContactTypePhone, phone), inputUser.DeviceID, "password")
+}
+
+// LoginTwoFactor completes a login challenge with a TOTP or recovery code (POST /v1/login/2fa)
+func (h *LoginHandler) LoginTwoFactor(ctx *gin.Context) {
+	var input models.LoginTwoFactorRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Success: false,
-			Error:   "Invalid password",
-			Code:    http.StatusUnauthorized,
+			Error:   "Invalid input: please provide the challenge token and a code or recovery code",
+			Code:    http.StatusBadRequest,
 		})
 		return
 	}
 
-	// Generate Token
-	token, err := middleware.GenerateToken(&user)
+	challenge, err := h.twoFactor.CompleteChallenge(input.ChallengeToken, input.Code, input.RecoveryCode)
 	if err != nil {
+		// The challenge is returned for wrong codes and lockouts, so the failure is attributed
+		var userID *uint
+		if challenge != nil {
+			userID = &challenge.UserID
+		}
+		recordAudit(h.audit, ctx, models.AuditLoginTwoFactorFailed, userID, map[string]any{
+			"usedRecoveryCode": input.RecoveryCode != "",
+		})
+		var throttled *services.ThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			setRetryAfter(ctx, throttled.RetryAfter)
+			ctx.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Success: false,
+				Error:   "Two-factor authentication temporarily locked due to too many invalid codes",
+				Code:    http.StatusTooManyRequests,
+			})
+		case errors.Is(err, services.ErrTwoFactorCodeInvalid):
+			ctx.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid two-factor code",
+				Code:    http.StatusUnauthorized,
+			})
+		case errors.Is(err, services.ErrChallengeInvalid), errors.Is(err, services.ErrTwoFactorNotEnrolled):
+			ctx.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid or expired login challenge, please log in again",
+				Code:    http.StatusUnauthorized,
+			})
+		default:
+			ctx.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Server error",
+				Code:    http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, challenge.UserID).Error; err != nil {
 		ctx.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
-			Error:   "Failed to generate token",
+			Error:   "Database error",
 			Code:    http.StatusInternalServerError,
 		})
 		return
 	}
+	if challenge.Identifier != "" {
+		h.recordSuccess(ctx, challenge.Identifier, user.ID)
+	}
 
-	var userEmail string = user.Email
+	tokens, errResponse := issueTokenPair(ctx, h.refreshTokens, h.access, &user, challenge.DeviceID)
+	if errResponse != nil {
+		ctx.JSON(errResponse.Code, errResponse)
+		return
+	}
+	auditTokenIssued(h.audit, ctx, user.ID, tokens, "two_factor")
 
 	ctx.JSON(http.StatusOK, models.LoginPhoneOutput{
-		Phone: user.Phone,
-		Email: userEmail,
-		Token: token,
+		Phone:        user.Phone,
+		Email:        user.Email,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		DeviceID:     tokens.DeviceID,
 	})
 }
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oidcStateCookie binds a started login to the browser that started it, so a
+// callback URL cannot be replayed in someone else's browser
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/v1/login/oidc"
+)
+
+// OIDCHandler logs users in through external OpenID Connect providers
+type OIDCHandler struct {
+	oidc   *services.OIDCService
+	login  *LoginHandler
+	reauth *services.ReauthService
+	audit  *services.AuditService
+}
+
+func NewOIDCHandler(oidc *services.OIDCService, login *LoginHandler, reauth *services.ReauthService, audit *services.AuditService) *OIDCHandler {
+	return &OIDCHandler{
+		oidc:   oidc,
+		login:  login,
+		reauth: reauth,
+		audit:  audit,
+	}
+}
+
+// isSecureRequest reports whether the client reached us over HTTPS
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// setStateCookie stores the login state in an HttpOnly cookie sent only to the callback
+func setStateCookie(c *gin.Context, state string, expiresAt time.Time) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(time.Until(expiresAt).Seconds()), oidcStateCookiePath, "", isSecureRequest(c), true)
+}
+
+// checkStateCookie compares the callback state with the cookie of the browser
+// and clears the cookie, writing an error response when they differ
+func checkStateCookie(c *gin.Context, state string) bool {
+	cookie, err := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", isSecureRequest(c), true)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		oidcError(c, services.ErrOIDCInvalidState)
+		return false
+	}
+	return true
+}
+
+// begin starts an authorization request and answers with the provider URL
+func (h *OIDCHandler) begin(c *gin.Context, deviceID string, userID *uint, reauth bool) {
+	authorizationURL, state, expiresAt, err := h.oidc.Begin(c.Request.Context(), c.Param("provider"), deviceID, userID, reauth)
+	if err != nil {
+		oidcError(c, err)
+		return
+	}
+	setStateCookie(c, state, expiresAt)
+
+	c.JSON(http.StatusOK, models.OIDCAuthorizationResponse{
+		AuthorizationURL: authorizationURL,
+		ExpiresAt:        expiresAt,
+	})
+}
+
+// oidcError maps OIDC service errors to responses
+func oidcError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOIDCUnknownProvider):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Unknown identity provider",
+			Code:    http.StatusNotFound,
+		})
+	case errors.Is(err, services.ErrOIDCInvalidState):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Login request expired or already used, please start again",
+			Code:    http.StatusBadRequest,
+		})
+	case errors.Is(err, services.ErrOIDCInvalidToken):
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Identity provider returned an invalid token",
+			Code:    http.StatusUnauthorized,
+		})
+	case errors.Is(err, services.ErrOIDCIdentityInUse):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Success: false,
+			Error:   "This identity is already linked to another account",
+			Code:    http.StatusConflict,
+		})
+	case errors.Is(err, services.ErrOIDCLinkRequired):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Success: false,
+			Error:   "An account with this email already exists, log in to it and link this identity",
+			Code:    http.StatusConflict,
+		})
+	case errors.Is(err, services.ErrOIDCNotLinked):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Success: false,
+			Error:   "This identity is not linked to your account",
+			Code:    http.StatusForbidden,
+		})
+	default:
+		log.Printf("OIDC login failed: %v", err)
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Success: false,
+			Error:   "Identity provider unavailable",
+			Code:    http.StatusBadGateway,
+		})
+	}
+}
+
+// Providers lists the identity providers users can log in with (GET /v1/login/oidc)
+func (h *OIDCHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, models.OIDCProvidersResponse{Providers: h.oidc.Providers()})
+}
+
+// Begin starts a login and returns the provider URL to open (GET /v1/login/oidc/:provider)
+func (h *OIDCHandler) Begin(c *gin.Context) {
+	h.begin(c, resolveDeviceID(c, c.Query("deviceId")), nil, false)
+}
+
+// BeginLink starts adding a provider identity to the caller's account (POST /v1/user/oidc/:provider/link)
+func (h *OIDCHandler) BeginLink(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	userIDUint := userID.(uint)
+	h.begin(c, "", &userIDUint, false)
+}
+
+// BeginReauth starts a fresh login at a linked provider whose callback returns
+// a reauthentication token, confirming requests that otherwise need the
+// password (POST /v1/user/oidc/:provider/reauth)
+func (h *OIDCHandler) BeginReauth(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	userIDUint := userID.(uint)
+	h.begin(c, "", &userIDUint, true)
+}
+
+// Callback finishes a login, link or reauthentication when the provider redirects back
+// (GET /v1/login/oidc/:provider/callback?code=...&state=...)
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider := c.Param("provider")
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Login was not approved by the identity provider: " + providerErr,
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: state and code are required",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if !checkStateCookie(c, state) {
+		return
+	}
+
+	claims, loginState, err := h.oidc.Complete(c.Request.Context(), provider, state, code)
+	if err != nil {
+		oidcError(c, err)
+		return
+	}
+
+	if loginState.Reauth && loginState.LinkUserID != nil {
+		h.completeReauth(c, provider, claims, *loginState.LinkUserID)
+		return
+	}
+
+	user, created, err := h.oidc.ResolveUser(provider, claims, loginState.LinkUserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Success: false,
+				Error:   "Account no longer exists",
+				Code:    http.StatusUnauthorized,
+			})
+			return
+		}
+		if errors.Is(err, services.ErrOIDCIdentityInUse) || errors.Is(err, services.ErrOIDCLinkRequired) {
+			oidcError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if loginState.LinkUserID != nil {
+		recordAudit(h.audit, c, models.AuditIdentityLinked, &user.ID, map[string]any{"provider": provider})
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Identity linked",
+		})
+		return
+	}
+
+	if created {
+		recordAudit(h.audit, c, models.AuditUserRegistered, &user.ID, map[string]any{"provider": provider})
+	}
+	recordAudit(h.audit, c, models.AuditLoginSucceeded, &user.ID, map[string]any{"provider": provider})
+
+	h.login.completeLogin(c, user, "", loginState.DeviceID, "oidc:"+provider)
+}
+
+// completeReauth answers with a reauthentication token once the provider
+// confirmed an identity linked to the user
+func (h *OIDCHandler) completeReauth(c *gin.Context, provider string, claims *models.OIDCClaims, userID uint) {
+	if err := h.oidc.CheckIdentity(provider, claims, userID); err != nil {
+		if errors.Is(err, services.ErrOIDCNotLinked) {
+			oidcError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	reauthToken, expiresAt, err := h.reauth.Issue(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	recordAudit(h.audit, c, models.AuditReauthenticated, &userID, map[string]any{"provider": provider})
+
+	c.JSON(http.StatusOK, models.ReauthResponse{
+		ReauthToken: reauthToken,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// ListIdentities returns the provider accounts linked to the caller (GET /v1/user/oidc)
+func (h *OIDCHandler) ListIdentities(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	identities, err := h.oidc.ListIdentities(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordResetHandler struct {
+	resets *services.PasswordResetService
+}
+
+func NewPasswordResetHandler(resets *services.PasswordResetService) *PasswordResetHandler {
+	return &PasswordResetHandler{resets: resets}
+}
+
+// RequestReset sends a reset token to the given email or phone (POST /v1/password/reset).
+// The answer is the same whether or not an account uses the contact.
+func (h *PasswordResetHandler) RequestReset(c *gin.Context) {
+	var req models.RequestPasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide a contact type and contact detail",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if req.ContactType == models.ContactTypePhone {
+		phone, validationErr := utils.NormalizePhone(req.ContactDetail)
+		if validationErr != nil {
+			c.JSON(validationErr.Code, validationErr)
+			return
+		}
+		req.ContactDetail = phone
+	} else {
+		req.ContactDetail = utils.CanonicalEmail(req.ContactDetail)
+		if err := utils.EmailValidation(req.ContactDetail); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid input: invalid email format",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	if err := h.resets.Request(req.ContactType, req.ContactDetail, c.ClientIP()); err != nil {
+		var throttled *services.ThrottledError
+		if errors.As(err, &throttled) {
+			setRetryAfter(c, throttled.RetryAfter)
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Success: false,
+				Error:   "Too many password reset requests, please try again later",
+				Code:    http.StatusTooManyRequests,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	// Same answer whether or not the account exists
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "If an account uses this contact, a password reset token has been sent",
+	})
+}
+
+// ConfirmReset sets a new password using a reset token (POST /v1/password/reset/confirm)
+func (h *PasswordResetHandler) ConfirmReset(c *gin.Context) {
+	var req models.ConfirmPasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide a token and a new password",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := utils.PasswordValidation(req.Password); err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Internal server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if err := h.resets.Confirm(req.Token, hashedPassword); err != nil {
+		if errors.Is(err, services.ErrResetTokenInvalid) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid or expired reset token",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password has been reset, please log in again",
+	})
+}
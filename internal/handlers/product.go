@@ -5,18 +5,53 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"tutuplapak/internal/config"
 	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type ProductHandler struct {
-	db *gorm.DB
+	db             *gorm.DB
+	categories     *services.CategoryService
+	maxImages      int
+	importMaxRows  int
+	importMaxBytes int64
 }
 
-func NewProductHandler(db *gorm.DB) *ProductHandler {
-	return &ProductHandler{db: db}
+func NewProductHandler(db *gorm.DB, categories *services.CategoryService, cfg config.ProductConfig) *ProductHandler {
+	return &ProductHandler{
+		db:             db,
+		categories:     categories,
+		maxImages:      cfg.MaxImages,
+		importMaxRows:  cfg.ImportMaxRows,
+		importMaxBytes: cfg.ImportMaxBytes,
+	}
+}
+
+// resolveCategory looks up the category named in a product payload, writing an error response if it fails
+func (h *ProductHandler) resolveCategory(c *gin.Context, value string) (*models.Category, bool) {
+	category, err := h.categories.Resolve(value)
+	if err != nil {
+		if errors.Is(err, services.ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "category is not valid",
+				Code:    http.StatusBadRequest,
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
+		})
+		return nil, false
+	}
+	return category, true
 }
 
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
@@ -46,6 +81,20 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	category, ok := h.resolveCategory(c, string(product.Category))
+	if !ok {
+		return
+	}
+
+	if errResponse := validateVariants(product.Qty, product.Price, product.Options, product.Variants); errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+	attributes, descriptionHTML, ok := h.productDetails(c, category.ID, product.Attributes, product.Description)
+	if !ok {
+		return
+	}
+
 	// Validate file ID belongs to the user
 	var fileUpload models.FileUpload
 	if err := h.db.Where("file_id = ?", product.FileID).First(&fileUpload).Error; err != nil {
@@ -84,21 +133,72 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if errResponse := h.checkVariantSKUs(userIDUint, 0, product.SKU, product.Variants); errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+	variantFiles, errResponse := h.ownedFiles(userIDUint, variantFileIDs(product.Variants))
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+
+	// Without fileIds the gallery is just the cover
+	gallery := galleryFileIDs(product.FileID, product.FileIDs)
+	if gallery == nil {
+		gallery = []string{product.FileID}
+	}
+	if !h.checkGallerySize(c, len(gallery)) {
+		return
+	}
+	galleryFiles, errResponse := h.ownedFiles(userIDUint, gallery)
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+	if len(product.Variants) > 0 {
+		product.Qty, product.Price = summarizeVariants(product.Variants)
+	}
+
 	sku := strings.TrimSpace(product.SKU)
 
 	p := models.Product{
-		UserID:   userIDUint,
-		Name:     product.Name,
-		Category: product.Category,
-		Qty:      product.Qty,
-		Price:    product.Price,
-		SKU:      sku,
-		FileID:   product.FileID,
-		FileURI:  fileUpload.FileURI,
+		UserID:     userIDUint,
+		Name:       product.Name,
+		Category:   models.ProductCategory(category.Name),
+		CategoryID: category.ID,
+		Qty:        product.Qty,
+		Price:      product.Price,
+		SKU:        sku,
+		FileID:     product.FileID,
+		FileURI:    fileUpload.FileURI,
+		Options:    product.Options,
 		// FileThumbnailURI: "", // let Go generate zero value
+		Description:     product.Description,
+		DescriptionHTML: descriptionHTML,
+		Attributes:      attributes,
 	}
 
-	if err := h.db.Create(&p).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Variants").Create(&p).Error; err != nil {
+			return err
+		}
+		variants, err := replaceVariants(tx, p.ID, product.Variants, variantFiles)
+		if err != nil {
+			return err
+		}
+		p.Variants = variants
+		return replaceImages(tx, p.ID, gallery, galleryFiles)
+	})
+	if errors.Is(err, errVariantNotFound) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "variantId is not a variant of this product",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   "Server Error",
@@ -107,20 +207,18 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	resp := models.ProductOutput{
-		ProductID:        strconv.FormatUint(uint64(p.ID), 10),
-		Name:             p.Name,
-		Category:         string(p.Category),
-		Quantity:         p.Qty,
-		Price:            p.Price,
-		SKU:              p.SKU,
-		FileID:           p.FileID,
-		FileURI:          p.FileURI,
-		FileThumbnailURI: p.FileThumbnailURI,
-		CreatedAt:        p.CreatedAt,
-		UpdatedAt:        p.UpdatedAt,
+	images, err := loadImages(h.db, []models.Product{p})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
 	}
 
+	resp := newProductOutput(&p, p.Variants, images[p.ID])
+
 	c.JSON(http.StatusCreated, resp)
 }
 
@@ -135,6 +233,9 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		})
 		return
 	}
+	queryParams.Attributes = c.QueryMap("attr")
+	queryParams.AttributesMin = c.QueryMap("attrMin")
+	queryParams.AttributesMax = c.QueryMap("attrMax")
 
 	limit := queryParams.Limit
 	offset := queryParams.Offset
@@ -146,27 +247,81 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		offset = 0
 	}
 
-	query := h.db.Model(&models.Product{})
-
-	if queryParams.ProductID != "" {
-		if productID, err := strconv.ParseUint(queryParams.ProductID, 10, 32); err == nil {
-			query = query.Where("id = ?", uint(productID))
-		}
+	filter, errResponse := parseProductFilter(queryParams, h.categories)
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
 	}
+	search := filter.search
+	query := filter.apply(h.db.Model(&models.Product{}), facetNone)
+
+	sortBy := queryParams.SortBy
+	if sortBy == "" && search != nil {
+		sortBy = "relevance"
+	}
+	// Without a q search there is nothing to rank by
+	if sortBy == "" || (sortBy == "relevance" && search == nil) {
+		sortBy = "newest"
+	}
+	order := newProductOrder(sortBy, search)
+
+	// Offset mode counts the matches; cursor mode skips the count and seeks past the cursor
+	var (
+		total  *int64
+		facets *models.ProductFacets
+		cursor *productCursor
+	)
+	if queryParams.Cursor != "" {
+		var err error
+		cursor, err = decodeProductCursor(queryParams.Cursor, sortBy)
+		if err == nil {
+			query, err = order.after(query, sortBy, cursor)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid cursor for this sortBy",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		offset = 0
+	} else {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Server Error",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		total = &count
 
-	if queryParams.SKU != "" {
-		sku := strings.TrimSpace(queryParams.SKU)
-		if sku != "" {
-			query = query.Where("sku = ?", sku)
+		var err error
+		if facets, err = filter.facets(h.db); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Server Error",
+				Code:    http.StatusInternalServerError,
+			})
+			return
 		}
 	}
 
-	if queryParams.Category != "" {
-		query = query.Where("category = ?", queryParams.Category)
+	backward := cursor != nil && cursor.Backward
+	query = order.apply(query, backward)
+
+	// One extra row tells whether another page follows
+	query = query.Limit(limit + 1).Offset(offset)
+	if search != nil {
+		query = search.selectRanked(query)
+	} else {
+		query = query.Select("products.*")
 	}
 
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
+	var products []productRow
+	if err := query.Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   "Server Error",
@@ -175,23 +330,43 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		return
 	}
 
-	switch queryParams.SortBy {
-	case "newest":
-		query = query.Order("created_at DESC, updated_at DESC")
-	case "oldest":
-		query = query.Order("created_at ASC, updated_at ASC")
-	case "cheapest":
-		query = query.Order("price ASC")
-	case "expensive":
-		query = query.Order("price DESC")
-	default:
-		query = query.Order("created_at DESC, updated_at DESC")
+	hasMore := len(products) > limit
+	if hasMore {
+		products = products[:limit]
+	}
+	if backward {
+		for i, j := 0, len(products)-1; i < j; i, j = i+1, j-1 {
+			products[i], products[j] = products[j], products[i]
+		}
 	}
 
-	query = query.Limit(limit).Offset(offset)
+	response := models.ProductListResponse{
+		Success: true,
+		Total:   total,
+		Facets:  facets,
+		Limit:   limit,
+		Offset:  offset,
+	}
 
-	var products []models.Product
-	if err := query.Find(&products).Error; err != nil {
+	if len(products) > 0 {
+		first, last := &products[0], &products[len(products)-1]
+		// Going backward, "more" lies before the page; the page we came from lies after it
+		if (backward && hasMore) || (!backward && (cursor != nil || offset > 0)) {
+			response.PrevCursor = encodeProductCursor(sortBy, true, first)
+		}
+		if (!backward && hasMore) || backward {
+			response.NextCursor = encodeProductCursor(sortBy, false, last)
+		}
+	}
+
+	productIDs := make([]uint, 0, len(products))
+	pageProducts := make([]models.Product, 0, len(products))
+	for _, product := range products {
+		productIDs = append(productIDs, product.ID)
+		pageProducts = append(pageProducts, product.Product)
+	}
+	variants, err := loadVariants(h.db, productIDs)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   "Server Error",
@@ -199,30 +374,20 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		})
 		return
 	}
-
-	var productOutputs []models.ProductOutput
-	for _, product := range products {
-		productOutputs = append(productOutputs, models.ProductOutput{
-			ProductID:        strconv.FormatUint(uint64(product.ID), 10),
-			Name:             product.Name,
-			Category:         string(product.Category),
-			Quantity:         product.Qty,
-			Price:            product.Price,
-			SKU:              product.SKU,
-			FileID:           product.FileID,
-			FileURI:          product.FileURI,
-			FileThumbnailURI: product.FileThumbnailURI,
-			CreatedAt:        product.CreatedAt,
-			UpdatedAt:        product.UpdatedAt,
+	images, err := loadImages(h.db, pageProducts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
 		})
+		return
 	}
 
-	response := models.ProductListResponse{
-		Success: true,
-		Data:    productOutputs,
-		Total:   total,
-		Limit:   limit,
-		Offset:  offset,
+	for _, product := range products {
+		output := newProductOutput(&product.Product, variants[product.ID], images[product.ID])
+		output.Highlight = highlightSnippet(product.Highlight)
+		response.Data = append(response.Data, output)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -271,9 +436,19 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	category, ok := h.resolveCategory(c, req.Category)
+	if !ok {
+		return
+	}
+
+	if errResponse := validateVariants(req.Qty, req.Price, req.Options, req.Variants); errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+
 	// Cari produk milik user
 	var product models.Product
-	if err := h.db.Where("id = ? AND user_id = ?", productIdUint, userIDUint).First(&product).Error; err != nil {
+	if err := h.db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", productIdUint, userIDUint).First(&product).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
 				Success: false,
@@ -308,38 +483,92 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	// Validasi fileId: apakah fileId milik user
+	if errResponse := h.checkVariantSKUs(userIDUint, product.ID, req.SKU, req.Variants); errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+	variantFiles, errResponse := h.ownedFiles(userIDUint, variantFileIDs(req.Variants))
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+
+	// Without fileIds the gallery is kept and only gains the cover if it is new
+	gallery := galleryFileIDs(req.FileID, req.FileIDs)
+	if gallery != nil && !h.checkGallerySize(c, len(gallery)) {
+		return
+	}
+	galleryFiles, errResponse := h.ownedFiles(userIDUint, gallery)
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+	if len(req.Variants) > 0 {
+		req.Qty, req.Price = summarizeVariants(req.Variants)
+	}
+
+	// Validasi fileId: apakah fileId milik user. The gallery check above
+	// covers it only when fileIds is given.
 	fileId := req.FileID
+	coverFiles, errResponse := h.ownedFiles(userIDUint, []string{fileId})
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+	fileUpload := coverFiles[fileId]
 
-	var fileUpload models.FileUpload
-	if err := h.db.Where("file_id = ?", fileId).First(&fileUpload).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{
-				Success: false,
-				Error:   "fileId is not valid / exists",
-				Code:    http.StatusBadRequest,
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   "Server error",
-			Code:    http.StatusInternalServerError,
-		})
+	// Left-out details are kept, but still have to fit the (possibly new) category
+	attributes := req.Attributes
+	if attributes == nil {
+		attributes = product.Attributes
+	}
+	description := product.Description
+	if req.Description != nil {
+		description = *req.Description
+	}
+	attributes, descriptionHTML, ok := h.productDetails(c, category.ID, attributes, description)
+	if !ok {
 		return
 	}
 
 	// Update product
 	product.Name = req.Name
-	product.Category = models.ProductCategory(req.Category)
+	product.Description = description
+	product.DescriptionHTML = descriptionHTML
+	product.Attributes = attributes
+	product.Category = models.ProductCategory(category.Name)
+	product.CategoryID = category.ID
 	product.Qty = req.Qty
 	product.Price = req.Price
 	product.SKU = strings.TrimSpace(req.SKU)
 	product.FileID = fileId
 	product.FileURI = fileUpload.FileURI
+	product.Options = req.Options
 	// FileThumbnailURI bisa diisi kalau ada service thumbnail
 
-	if err := h.db.Save(&product).Error; err != nil {
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Variants").Save(&product).Error; err != nil {
+			return err
+		}
+		variants, err := replaceVariants(tx, product.ID, req.Variants, variantFiles)
+		if err != nil {
+			return err
+		}
+		product.Variants = variants
+		if gallery != nil {
+			return replaceImages(tx, product.ID, gallery, galleryFiles)
+		}
+		return ensureCoverImage(tx, &product)
+	})
+	if errors.Is(err, errVariantNotFound) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "variantId is not a variant of this product",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   "Server error",
@@ -349,24 +578,11 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	}
 
 	// Response sesuai kontrak
-	resp := models.ProductResponse{
-		ProductID:        strconv.FormatUint(uint64(product.ID), 10),
-		Name:             product.Name,
-		Category:         string(product.Category),
-		Qty:              product.Qty,
-		Price:            product.Price,
-		SKU:              product.SKU,
-		FileID:           product.FileID,
-		FileURI:          product.FileURI,
-		FileThumbnailURI: product.FileThumbnailURI,
-		CreatedAt:        product.CreatedAt,
-		UpdatedAt:        product.UpdatedAt,
-	}
-
-	c.JSON(http.StatusOK, resp)
+	h.respondWithProduct(c, &product)
 }
 
 // DeleteProduct DELETE /v1/product/productId
+// The product is only marked deleted so purchases that refer to it keep working
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -390,7 +606,7 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	}
 
 	var product models.Product
-	if err := h.db.Where("id = ? AND user_id = ?", productId, userID).First(&product).Error; err != nil {
+	if err := h.db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", productId, userID).First(&product).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
 				Success: false,
@@ -407,7 +623,10 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Delete(&product).Error; err != nil {
+	if err := h.db.Model(&product).Updates(map[string]any{
+		"is_active":  false,
+		"deleted_at": time.Now(),
+	}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   "Server Error",
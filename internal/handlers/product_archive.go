@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"tutuplapak/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ArchiveProduct hides a product from listings and checkout until it is
+// restored (POST /v1/product/:productId/archive)
+func (h *ProductHandler) ArchiveProduct(c *gin.Context) {
+	product, _, ok := h.findOwnedProduct(c, false)
+	if !ok {
+		return
+	}
+
+	if product.ArchivedAt == nil {
+		if err := h.db.Model(product).Updates(map[string]any{
+			"is_active":   false,
+			"archived_at": time.Now(),
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Server error",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+	}
+
+	h.respondWithProduct(c, product)
+}
+
+// RestoreProduct lists an archived or deleted product again
+// (POST /v1/product/:productId/restore)
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	product, _, ok := h.findOwnedProduct(c, true)
+	if !ok {
+		return
+	}
+
+	if product.ArchivedAt == nil && product.DeletedAt == nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Success: false,
+			Error:   "Product is not archived or deleted",
+			Code:    http.StatusConflict,
+		})
+		return
+	}
+
+	if err := h.db.Model(product).Updates(map[string]any{
+		"is_active":   true,
+		"archived_at": nil,
+		"deleted_at":  nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.respondWithProduct(c, product)
+}
+
+// ListArchivedProducts returns the caller's archived products, or with
+// status=deleted their deleted ones (GET /v1/product/archived)
+func (h *ProductHandler) ListArchivedProducts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	var params models.ArchivedProductQueryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid query parameters",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if params.Limit == 0 {
+		params.Limit = 5
+	}
+
+	query := h.db.Model(&models.Product{}).Where("user_id = ?", userID)
+	if params.Status == "deleted" {
+		query = query.Where("deleted_at IS NOT NULL").Order("deleted_at DESC")
+	} else {
+		query = query.Where("archived_at IS NOT NULL AND deleted_at IS NULL").Order("archived_at DESC")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	var products []models.Product
+	if err := query.Order("id DESC").Limit(params.Limit).Offset(params.Offset).Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	productIDs := make([]uint, 0, len(products))
+	for _, product := range products {
+		productIDs = append(productIDs, product.ID)
+	}
+	variants, err := loadVariants(h.db, productIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	images, err := loadImages(h.db, products)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := models.ProductListResponse{
+		Success: true,
+		Data:    []models.ProductOutput{},
+		Total:   &total,
+		Limit:   params.Limit,
+		Offset:  params.Offset,
+	}
+	for i := range products {
+		response.Data = append(response.Data, newProductOutput(&products[i], variants[products[i].ID], images[products[i].ID]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
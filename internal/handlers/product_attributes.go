@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// productDetails validates the attributes of a product payload against its
+// category and renders its description, writing an error response if it fails
+func (h *ProductHandler) productDetails(c *gin.Context, categoryID uint, attributes map[string]any, description string) (map[string]any, string, bool) {
+	schema, err := h.categories.AttributeSchema(categoryID)
+	if err == nil {
+		attributes, err = services.ValidateAttributes(schema, attributes)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAttributes) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return nil, "", false
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
+		})
+		return nil, "", false
+	}
+
+	descriptionHTML, err := utils.RenderMarkdown(description)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "description is not valid Markdown",
+			Code:    http.StatusBadRequest,
+		})
+		return nil, "", false
+	}
+
+	return attributes, descriptionHTML, true
+}
+
+// attributeFilter matches products whose attribute is one of values, or
+// whose numeric attribute lies between min and max
+type attributeFilter struct {
+	key    string
+	values []string
+	min    *float64
+	max    *float64
+}
+
+// parseAttributeFilters reads attr[key], attrMin[key] and attrMax[key]
+func parseAttributeFilters(params models.ProductQueryParams) ([]attributeFilter, *models.ErrorResponse) {
+	filters := make(map[string]*attributeFilter)
+	get := func(key string) (*attributeFilter, *models.ErrorResponse) {
+		if !services.IsAttributeKey(key) {
+			return nil, invalidProductQuery("Invalid attribute: " + key)
+		}
+		if filters[key] == nil {
+			filters[key] = &attributeFilter{key: key}
+		}
+		return filters[key], nil
+	}
+
+	for key, value := range params.Attributes {
+		filter, errResponse := get(key)
+		if errResponse != nil {
+			return nil, errResponse
+		}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				filter.values = append(filter.values, v)
+			}
+		}
+	}
+	for _, bound := range []struct {
+		values map[string]string
+		name   string
+		min    bool
+	}{
+		{params.AttributesMin, "attrMin", true},
+		{params.AttributesMax, "attrMax", false},
+	} {
+		for key, value := range bound.values {
+			filter, errResponse := get(key)
+			if errResponse != nil {
+				return nil, errResponse
+			}
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, invalidProductQuery(bound.name + "[" + key + "] must be a number")
+			}
+			if bound.min {
+				filter.min = &number
+			} else {
+				filter.max = &number
+			}
+		}
+	}
+
+	result := make([]attributeFilter, 0, len(filters))
+	for _, filter := range filters {
+		result = append(result, *filter)
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"tutuplapak/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// productCursor is the decoded form of the opaque nextCursor/prevCursor values.
+// Key holds the sort column of the row the page starts after, ID breaks ties.
+type productCursor struct {
+	SortBy   string `json:"s"`
+	Backward bool   `json:"b,omitempty"`
+	Key      string `json:"k"`
+	ID       uint   `json:"id"`
+}
+
+// productRow is a product as read by GetProducts, with the search columns
+type productRow struct {
+	models.Product
+	Rank      float64
+	Highlight string
+}
+
+// productOrder describes how a sortBy option orders the listing
+type productOrder struct {
+	// column is the ORDER BY key, keyExpr the same key usable in WHERE
+	column  string
+	keyExpr string
+	keyArgs []any
+	desc    bool
+}
+
+// newProductOrder returns the ordering for sortBy; relevance requires a search
+func newProductOrder(sortBy string, search *productSearch) productOrder {
+	switch sortBy {
+	case "relevance":
+		expr, args := search.rankExpression()
+		return productOrder{column: "rank", keyExpr: expr, keyArgs: args, desc: true}
+	case "oldest":
+		return productOrder{column: "created_at", keyExpr: "created_at"}
+	case "cheapest":
+		return productOrder{column: "price", keyExpr: "price"}
+	case "expensive":
+		return productOrder{column: "price", keyExpr: "price", desc: true}
+	default:
+		return productOrder{column: "created_at", keyExpr: "created_at", desc: true}
+	}
+}
+
+// apply orders the query by the sort key and id, reversed when paging backward
+func (o productOrder) apply(query *gorm.DB, backward bool) *gorm.DB {
+	direction := "ASC"
+	if o.desc != backward {
+		direction = "DESC"
+	}
+	return query.Order(o.column + " " + direction + ", id " + direction)
+}
+
+// after restricts the query to rows past the cursor in the paging direction
+func (o productOrder) after(query *gorm.DB, sortBy string, cursor *productCursor) (*gorm.DB, error) {
+	key, err := parseCursorKey(sortBy, cursor.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	operator := ">"
+	if o.desc != cursor.Backward {
+		operator = "<"
+	}
+	args := append(append([]any{}, o.keyArgs...), key, cursor.ID)
+	return query.Where("("+o.keyExpr+", id) "+operator+" (?, ?)", args...), nil
+}
+
+// cursorKey formats the sort key of a row for a cursor
+func cursorKey(sortBy string, row *productRow) string {
+	switch sortBy {
+	case "relevance":
+		return strconv.FormatFloat(row.Rank, 'g', -1, 64)
+	case "cheapest", "expensive":
+		return strconv.FormatUint(uint64(row.Price), 10)
+	default:
+		return row.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+func parseCursorKey(sortBy, key string) (any, error) {
+	switch sortBy {
+	case "relevance":
+		return strconv.ParseFloat(key, 64)
+	case "cheapest", "expensive":
+		return strconv.ParseUint(key, 10, 32)
+	default:
+		return time.Parse(time.RFC3339Nano, key)
+	}
+}
+
+func encodeProductCursor(sortBy string, backward bool, row *productRow) string {
+	raw, _ := json.Marshal(productCursor{
+		SortBy:   sortBy,
+		Backward: backward,
+		Key:      cursorKey(sortBy, row),
+		ID:       row.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeProductCursor reads a cursor, rejecting ones issued for another sortBy
+func decodeProductCursor(value, sortBy string) (*productCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor productCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.SortBy != sortBy {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"tutuplapak/internal/models"
+)
+
+func TestProductCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 17, 8, 30, 0, 123456000, time.UTC)
+	row := &productRow{Product: models.Product{ID: 42, Price: 15000, CreatedAt: createdAt}, Rank: 0.0759}
+
+	tests := []struct {
+		sortBy string
+		key    any
+	}{
+		{"newest", createdAt},
+		{"oldest", createdAt},
+		{"cheapest", uint64(15000)},
+		{"expensive", uint64(15000)},
+		{"relevance", 0.0759},
+	}
+	for _, tt := range tests {
+		for _, backward := range []bool{false, true} {
+			cursor, err := decodeProductCursor(encodeProductCursor(tt.sortBy, backward, row), tt.sortBy)
+			if err != nil {
+				t.Fatalf("%s: decode: %v", tt.sortBy, err)
+			}
+			if cursor.SortBy != tt.sortBy || cursor.Backward != backward || cursor.ID != 42 {
+				t.Fatalf("%s: unexpected cursor %+v", tt.sortBy, cursor)
+			}
+			key, err := parseCursorKey(tt.sortBy, cursor.Key)
+			if err != nil {
+				t.Fatalf("%s: parse key %q: %v", tt.sortBy, cursor.Key, err)
+			}
+			if createdAt, ok := key.(time.Time); ok {
+				if !createdAt.Equal(tt.key.(time.Time)) {
+					t.Fatalf("%s: expected key %v, got %v", tt.sortBy, tt.key, createdAt)
+				}
+			} else if key != tt.key {
+				t.Fatalf("%s: expected key %v, got %v", tt.sortBy, tt.key, key)
+			}
+		}
+	}
+}
+
+func TestDecodeProductCursorRejectsInvalidCursors(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	valid := encodeProductCursor("cheapest", false, &productRow{Product: models.Product{ID: 1, Price: 1000}})
+
+	tests := map[string]string{
+		"not base64":     "%%%",
+		"padded base64":  base64.URLEncoding.EncodeToString([]byte(`{"s":"cheapest","k":"1000","id":1}`)),
+		"not json":       encode("cheapest:1000:1"),
+		"wrong types":    encode(`{"s":"cheapest","k":1000,"id":"1"}`),
+		"another sortBy": encodeProductCursor("expensive", false, &productRow{Product: models.Product{ID: 1, Price: 1000}}),
+		"truncated":      valid[:len(valid)-4],
+	}
+	for name, value := range tests {
+		if _, err := decodeProductCursor(value, "cheapest"); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s: expected errInvalidCursor, got %v", name, err)
+		}
+	}
+
+	// A decodable cursor whose key was edited is rejected before it reaches the query
+	order := newProductOrder("cheapest", nil)
+	for _, key := range []string{"", "cheap", "-1", "1.5", "99999999999"} {
+		cursor, err := decodeProductCursor(encode(`{"s":"cheapest","k":"`+key+`","id":1}`), "cheapest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := order.after(nil, "cheapest", cursor); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+	cursor, _ := decodeProductCursor(encode(`{"s":"newest","k":"yesterday","id":1}`), "newest")
+	if _, err := newProductOrder("newest", nil).after(nil, "newest", cursor); err == nil {
+		t.Error("expected a key that is no timestamp to be rejected")
+	}
+}
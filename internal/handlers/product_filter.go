@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// productPriceBuckets are the lower bounds of the price facet buckets
+var productPriceBuckets = []uint{0, 10000, 50000, 100000, 500000}
+
+// Facets that ignore their own filter when counted
+const (
+	facetNone     = ""
+	facetCategory = "category"
+	facetPrice    = "price"
+)
+
+// productFilter holds the validated filters of GetProducts
+type productFilter struct {
+	productID     *uint
+	sku           string
+	categoryIDs   []uint
+	minPrice      *uint
+	maxPrice      *uint
+	sellerID      *uint
+	inStock       *bool
+	createdAfter  *time.Time
+	createdBefore *time.Time
+	attributes    []attributeFilter
+	search        *productSearch
+}
+
+func invalidProductQuery(message string) *models.ErrorResponse {
+	return &models.ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    http.StatusBadRequest,
+	}
+}
+
+func serverErrorResponse() *models.ErrorResponse {
+	return &models.ErrorResponse{
+		Success: false,
+		Error:   "Server error",
+		Code:    http.StatusInternalServerError,
+	}
+}
+
+// parseProductFilter validates the filter parameters of GetProducts
+func parseProductFilter(params models.ProductQueryParams, categories *services.CategoryService) (*productFilter, *models.ErrorResponse) {
+	filter := &productFilter{
+		sku:      strings.TrimSpace(params.SKU),
+		minPrice: params.MinPrice,
+		maxPrice: params.MaxPrice,
+		inStock:  params.InStock,
+		search:   newProductSearch(params.Query),
+	}
+
+	// An unparsable productId has always been ignored rather than rejected
+	if params.ProductID != "" {
+		if productID, err := strconv.ParseUint(params.ProductID, 10, 32); err == nil {
+			id := uint(productID)
+			filter.productID = &id
+		}
+	}
+
+	// Categories are matched by slug or name and include their subcategories
+	var categoryIDs []uint
+	for _, value := range params.Category {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			category, err := categories.Resolve(name)
+			if errors.Is(err, services.ErrCategoryNotFound) {
+				return nil, invalidProductQuery("Invalid category: " + name)
+			}
+			if err != nil {
+				return nil, serverErrorResponse()
+			}
+			categoryIDs = append(categoryIDs, category.ID)
+		}
+	}
+	if len(categoryIDs) > 0 {
+		var err error
+		if filter.categoryIDs, err = categories.WithDescendants(categoryIDs); err != nil {
+			return nil, serverErrorResponse()
+		}
+	}
+
+	if filter.minPrice != nil && filter.maxPrice != nil && *filter.minPrice > *filter.maxPrice {
+		return nil, invalidProductQuery("minPrice must not be greater than maxPrice")
+	}
+
+	if params.SellerID != "" {
+		sellerID, err := strconv.ParseUint(params.SellerID, 10, 32)
+		if err != nil {
+			return nil, invalidProductQuery("Invalid sellerId")
+		}
+		id := uint(sellerID)
+		filter.sellerID = &id
+	}
+
+	var errResponse *models.ErrorResponse
+	if filter.attributes, errResponse = parseAttributeFilters(params); errResponse != nil {
+		return nil, errResponse
+	}
+
+	var err error
+	if filter.createdAfter, err = parseProductDate(params.CreatedAfter); err != nil {
+		return nil, invalidProductQuery("createdAfter must be an RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+	if filter.createdBefore, err = parseProductDate(params.CreatedBefore); err != nil {
+		return nil, invalidProductQuery("createdBefore must be an RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+
+	return filter, nil
+}
+
+func parseProductDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// apply adds the filters to query, leaving out the filter of the given facet
+func (f *productFilter) apply(query *gorm.DB, facet string) *gorm.DB {
+	query = query.Where("is_active = ?", true)
+
+	if f.productID != nil {
+		query = query.Where("id = ?", *f.productID)
+	}
+	if f.sku != "" {
+		query = query.Where("(sku = ? OR id IN (?))", f.sku,
+			query.Session(&gorm.Session{NewDB: true}).Model(&models.ProductVariant{}).Select("product_id").Where("sku = ?", f.sku))
+	}
+	if len(f.categoryIDs) > 0 && facet != facetCategory {
+		query = query.Where("category_id IN ?", f.categoryIDs)
+	}
+	if facet != facetPrice {
+		if f.minPrice != nil {
+			query = query.Where("price >= ?", *f.minPrice)
+		}
+		if f.maxPrice != nil {
+			query = query.Where("price <= ?", *f.maxPrice)
+		}
+	}
+	if f.sellerID != nil {
+		query = query.Where("user_id = ?", *f.sellerID)
+	}
+	if f.inStock != nil {
+		if *f.inStock {
+			query = query.Where("qty > 0")
+		} else {
+			query = query.Where("qty = 0")
+		}
+	}
+	// createdAfter is inclusive, createdBefore exclusive
+	if f.createdAfter != nil {
+		query = query.Where("created_at >= ?", *f.createdAfter)
+	}
+	if f.createdBefore != nil {
+		query = query.Where("created_at < ?", *f.createdBefore)
+	}
+	// Numeric bounds only compare attributes stored as JSON numbers
+	for _, attribute := range f.attributes {
+		if len(attribute.values) > 0 {
+			query = query.Where("attributes ->> ? IN ?", attribute.key, attribute.values)
+		}
+		number := "CASE WHEN jsonb_typeof(attributes -> ?) = 'number' THEN (attributes ->> ?)::numeric END"
+		if attribute.min != nil {
+			query = query.Where(number+" >= ?", attribute.key, attribute.key, *attribute.min)
+		}
+		if attribute.max != nil {
+			query = query.Where(number+" <= ?", attribute.key, attribute.key, *attribute.max)
+		}
+	}
+	if f.search != nil {
+		query = f.search.filter(query)
+	}
+
+	return query
+}
+
+// facets counts the matching products per category and price bucket
+func (f *productFilter) facets(db *gorm.DB) (*models.ProductFacets, error) {
+	facets := &models.ProductFacets{
+		Categories:   []models.CategoryFacet{},
+		PriceBuckets: make([]models.PriceBucketFacet, len(productPriceBuckets)),
+	}
+
+	if err := f.apply(db.Model(&models.Product{}), facetCategory).
+		Select("category, COUNT(*) AS count").
+		Group("category").
+		Scan(&facets.Categories).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(facets.Categories, func(i, j int) bool {
+		return facets.Categories[i].Category < facets.Categories[j].Category
+	})
+
+	// The bucket index is the number of lower bounds above the first one that the price reaches
+	bucketExpr := "0"
+	bounds := make([]any, 0, len(productPriceBuckets)-1)
+	for _, bound := range productPriceBuckets[1:] {
+		bucketExpr += " + CASE WHEN price >= ? THEN 1 ELSE 0 END"
+		bounds = append(bounds, bound)
+	}
+
+	var counts []struct {
+		Bucket int
+		Count  int64
+	}
+	if err := f.apply(db.Model(&models.Product{}), facetPrice).
+		Select("("+bucketExpr+") AS bucket, COUNT(*) AS count", bounds...).
+		Group("bucket").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	for i, min := range productPriceBuckets {
+		facets.PriceBuckets[i].Min = min
+		if i+1 < len(productPriceBuckets) {
+			max := productPriceBuckets[i+1] - 1
+			facets.PriceBuckets[i].Max = &max
+		}
+	}
+	for _, count := range counts {
+		if count.Bucket >= 0 && count.Bucket < len(facets.PriceBuckets) {
+			facets.PriceBuckets[count.Bucket].Count = count.Count
+		}
+	}
+
+	return facets, nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tutuplapak/internal/models"
+)
+
+func TestParseProductFilter(t *testing.T) {
+	uintPtr := func(v uint) *uint { return &v }
+	inStock := true
+
+	// Categories need the category service and are left out here
+	filter, errResponse := parseProductFilter(models.ProductQueryParams{
+		ProductID:     "12",
+		SKU:           "  KAOS-1 ",
+		MinPrice:      uintPtr(1000),
+		MaxPrice:      uintPtr(1000),
+		SellerID:      "7",
+		InStock:       &inStock,
+		CreatedAfter:  "2024-05-01",
+		CreatedBefore: "2024-06-01T08:00:00+07:00",
+		Query:         "kaos",
+	}, nil)
+	if errResponse != nil {
+		t.Fatalf("unexpected error %q", errResponse.Error)
+	}
+	if filter.productID == nil || *filter.productID != 12 || filter.sku != "KAOS-1" {
+		t.Fatalf("unexpected productId %v or sku %q", filter.productID, filter.sku)
+	}
+	if *filter.minPrice != 1000 || *filter.maxPrice != 1000 {
+		t.Fatal("expected an equal minPrice and maxPrice to be allowed")
+	}
+	if filter.sellerID == nil || *filter.sellerID != 7 || filter.inStock != &inStock {
+		t.Fatalf("unexpected sellerId %v or inStock %v", filter.sellerID, filter.inStock)
+	}
+	if !filter.createdAfter.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected createdAfter %v", filter.createdAfter)
+	}
+	if !filter.createdBefore.Equal(time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected createdBefore %v", filter.createdBefore)
+	}
+	if filter.search == nil || filter.search.tsquery != "kaos:*" {
+		t.Fatalf("unexpected search %+v", filter.search)
+	}
+
+	// An unparsable productId is ignored as it always was
+	filter, errResponse = parseProductFilter(models.ProductQueryParams{ProductID: "abc"}, nil)
+	if errResponse != nil || filter.productID != nil || filter.search != nil {
+		t.Fatalf("expected an empty filter, got %+v, %v", filter, errResponse)
+	}
+}
+
+func TestParseProductFilterRejectsInvalidInput(t *testing.T) {
+	uintPtr := func(v uint) *uint { return &v }
+
+	tests := map[string]models.ProductQueryParams{
+		"price range":         {MinPrice: uintPtr(5000), MaxPrice: uintPtr(4999)},
+		"seller":              {SellerID: "seller-1"},
+		"negative seller":     {SellerID: "-1"},
+		"created after":       {CreatedAfter: "01/05/2024"},
+		"created before":      {CreatedBefore: "2024-05-01 10:00"},
+		"attribute key":       {Attributes: map[string]string{"a b": "x"}},
+		"attribute min":       {AttributesMin: map[string]string{"size": "large"}},
+		"attribute max":       {AttributesMax: map[string]string{"size": "10cm"}},
+		"attribute bound key": {AttributesMin: map[string]string{"bad key!": "1"}},
+	}
+	for name, params := range tests {
+		filter, errResponse := parseProductFilter(params, nil)
+		if errResponse == nil {
+			t.Errorf("%s: expected an error, got %+v", name, filter)
+			continue
+		}
+		if errResponse.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, errResponse.Code)
+		}
+	}
+}
+
+func TestParseAttributeFilters(t *testing.T) {
+	filters, errResponse := parseAttributeFilters(models.ProductQueryParams{
+		Attributes:    map[string]string{"color": "red, blue,,"},
+		AttributesMin: map[string]string{"size": "38", "weight": "-0.5"},
+		AttributesMax: map[string]string{"size": "42.5"},
+	})
+	if errResponse != nil {
+		t.Fatalf("unexpected error %q", errResponse.Error)
+	}
+
+	byKey := make(map[string]attributeFilter, len(filters))
+	for _, filter := range filters {
+		byKey[filter.key] = filter
+	}
+	if len(byKey) != 3 {
+		t.Fatalf("expected one filter per key, got %+v", filters)
+	}
+	if color := byKey["color"]; len(color.values) != 2 || color.values[0] != "red" || color.values[1] != "blue" || color.min != nil {
+		t.Fatalf("unexpected color filter %+v", color)
+	}
+	if size := byKey["size"]; size.min == nil || *size.min != 38 || size.max == nil || *size.max != 42.5 {
+		t.Fatalf("unexpected size filter %+v", size)
+	}
+	if weight := byKey["weight"]; weight.min == nil || *weight.min != -0.5 || weight.max != nil {
+		t.Fatalf("unexpected weight filter %+v", weight)
+	}
+}
@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"tutuplapak/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ownedFiles loads the uploads with the given IDs. Uploads made without an
+// account may be used by anyone; the others only by their uploader.
+func (h *ProductHandler) ownedFiles(userID uint, fileIDs []string) (map[string]models.FileUpload, *models.ErrorResponse) {
+	files := make(map[string]models.FileUpload, len(fileIDs))
+	if len(fileIDs) == 0 {
+		return files, nil
+	}
+
+	var uploads []models.FileUpload
+	if err := h.db.Where("file_id IN ? AND (user_id IS NULL OR user_id = ?)", fileIDs, userID).Find(&uploads).Error; err != nil {
+		return nil, serverErrorResponse()
+	}
+	for _, upload := range uploads {
+		files[upload.FileID] = upload
+	}
+	for _, fileID := range fileIDs {
+		if _, ok := files[fileID]; !ok {
+			return nil, invalidProductInput("fileId is not valid / exists")
+		}
+	}
+	return files, nil
+}
+
+// galleryFileIDs orders the gallery of a product payload with duplicates
+// removed and the cover added in front when it is missing. It returns nil when
+// the payload leaves the gallery alone.
+func galleryFileIDs(cover string, fileIDs []string) []string {
+	if fileIDs == nil {
+		return nil
+	}
+
+	gallery := make([]string, 0, len(fileIDs)+1)
+	seen := make(map[string]bool, len(fileIDs)+1)
+	for _, fileID := range fileIDs {
+		if !seen[fileID] {
+			seen[fileID] = true
+			gallery = append(gallery, fileID)
+		}
+	}
+	if !seen[cover] {
+		gallery = append([]string{cover}, gallery...)
+	}
+	return gallery
+}
+
+// gallerySizeError rejects a gallery with more images than a product may have
+func (h *ProductHandler) gallerySizeError(count int) *models.ErrorResponse {
+	if count > h.maxImages {
+		return invalidProductInput("A product can have at most " + strconv.Itoa(h.maxImages) + " images")
+	}
+	return nil
+}
+
+// checkGallerySize writes an error response when the gallery is too large
+func (h *ProductHandler) checkGallerySize(c *gin.Context, count int) bool {
+	if errResponse := h.gallerySizeError(count); errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return false
+	}
+	return true
+}
+
+// replaceImages stores the gallery in the given order
+func replaceImages(tx *gorm.DB, productID uint, fileIDs []string, files map[string]models.FileUpload) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductImage{}).Error; err != nil {
+		return err
+	}
+	if len(fileIDs) == 0 {
+		return nil
+	}
+
+	images := make([]models.ProductImage, 0, len(fileIDs))
+	for i, fileID := range fileIDs {
+		images = append(images, models.ProductImage{
+			ProductID:        productID,
+			FileID:           fileID,
+			FileURI:          files[fileID].FileURI,
+			FileThumbnailURI: files[fileID].FileThumbnailURI,
+			Position:         i,
+		})
+	}
+	return tx.Create(&images).Error
+}
+
+// ensureCoverImage adds the product's cover to its gallery when it is not in it yet
+func ensureCoverImage(tx *gorm.DB, product *models.Product) error {
+	var count int64
+	if err := tx.Model(&models.ProductImage{}).
+		Where("product_id = ? AND file_id = ?", product.ID, product.FileID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	// The cover goes first; the others keep their order behind it
+	if err := tx.Model(&models.ProductImage{}).
+		Where("product_id = ?", product.ID).
+		UpdateColumn("position", gorm.Expr("position + 1")).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.ProductImage{
+		ProductID:        product.ID,
+		FileID:           product.FileID,
+		FileURI:          product.FileURI,
+		FileThumbnailURI: product.FileThumbnailURI,
+	}).Error
+}
+
+// loadImages returns the galleries of the given products keyed by product ID, marking each cover
+func loadImages(db *gorm.DB, products []models.Product) (map[uint][]models.ProductImage, error) {
+	images := make(map[uint][]models.ProductImage)
+	if len(products) == 0 {
+		return images, nil
+	}
+
+	covers := make(map[uint]string, len(products))
+	productIDs := make([]uint, 0, len(products))
+	for _, product := range products {
+		covers[product.ID] = product.FileID
+		productIDs = append(productIDs, product.ID)
+	}
+
+	var rows []models.ProductImage
+	if err := db.Where("product_id IN ?", productIDs).Order("position, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		row.IsCover = row.FileID == covers[row.ProductID]
+		images[row.ProductID] = append(images[row.ProductID], row)
+	}
+	return images, nil
+}
+
+// findOwnedProduct loads the caller's product named by the :productId path
+// parameter, writing an error response if it fails. Deleted products are only
+// found with withDeleted.
+func (h *ProductHandler) findOwnedProduct(c *gin.Context, withDeleted bool) (*models.Product, uint, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return nil, 0, false
+	}
+	userIDUint := userID.(uint)
+
+	productID, err := strconv.ParseUint(c.Param("productId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid productId",
+			Code:    http.StatusBadRequest,
+		})
+		return nil, 0, false
+	}
+
+	query := h.db.Where("id = ? AND user_id = ?", productID, userIDUint)
+	if !withDeleted {
+		query = query.Where("deleted_at IS NULL")
+	}
+	var product models.Product
+	if err := query.First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "productId not found",
+				Code:    http.StatusNotFound,
+			})
+			return nil, 0, false
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return nil, 0, false
+	}
+
+	return &product, userIDUint, true
+}
+
+// respondWithProduct reloads the product's variants and gallery and writes it
+func (h *ProductHandler) respondWithProduct(c *gin.Context, product *models.Product) {
+	if err := h.db.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	}).First(product, product.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	images, err := loadImages(h.db, []models.Product{*product})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	product.Images = images[product.ID]
+
+	c.JSON(http.StatusOK, newProductResponse(product))
+}
+
+// setCover makes one of the gallery images the product's cover
+func setCover(tx *gorm.DB, product *models.Product, image models.ProductImage) error {
+	product.FileID = image.FileID
+	product.FileURI = image.FileURI
+	product.FileThumbnailURI = image.FileThumbnailURI
+	return tx.Model(&models.Product{}).Where("id = ?", product.ID).Updates(map[string]any{
+		"file_id":            image.FileID,
+		"file_uri":           image.FileURI,
+		"file_thumbnail_uri": image.FileThumbnailURI,
+	}).Error
+}
+
+// AddProductImage appends an image to the gallery (POST /v1/product/:productId/images)
+func (h *ProductHandler) AddProductImage(c *gin.Context) {
+	product, userID, ok := h.findOwnedProduct(c, false)
+	if !ok {
+		return
+	}
+
+	var req models.AddProductImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "fileId is required",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	files, errResponse := h.ownedFiles(userID, []string{req.FileID})
+	if errResponse != nil {
+		c.JSON(errResponse.Code, errResponse)
+		return
+	}
+
+	var images []models.ProductImage
+	if err := h.db.Where("product_id = ?", product.ID).Order("position").Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	for _, image := range images {
+		if image.FileID == req.FileID {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Success: false,
+				Error:   "Image is already in the gallery",
+				Code:    http.StatusConflict,
+			})
+			return
+		}
+	}
+	if !h.checkGallerySize(c, len(images)+1) {
+		return
+	}
+
+	position := 0
+	if len(images) > 0 {
+		position = images[len(images)-1].Position + 1
+	}
+	image := models.ProductImage{
+		ProductID:        product.ID,
+		FileID:           req.FileID,
+		FileURI:          files[req.FileID].FileURI,
+		FileThumbnailURI: files[req.FileID].FileThumbnailURI,
+		Position:         position,
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&image).Error; err != nil {
+			return err
+		}
+		if req.Cover {
+			return setCover(tx, product, image)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.respondWithProduct(c, product)
+}
+
+// ReorderProductImages puts the gallery in a new order and optionally picks
+// another cover (PUT /v1/product/:productId/images)
+func (h *ProductHandler) ReorderProductImages(c *gin.Context) {
+	product, _, ok := h.findOwnedProduct(c, false)
+	if !ok {
+		return
+	}
+
+	var req models.ReorderProductImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "fileIds must list the gallery images",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var images []models.ProductImage
+	if err := h.db.Where("product_id = ?", product.ID).Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	byFileID := make(map[string]models.ProductImage, len(images))
+	for _, image := range images {
+		byFileID[image.FileID] = image
+	}
+
+	// The new order has to name every image exactly once
+	seen := make(map[string]bool, len(req.FileIDs))
+	for _, fileID := range req.FileIDs {
+		if _, exists := byFileID[fileID]; !exists || seen[fileID] {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "fileIds must list each gallery image once",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		seen[fileID] = true
+	}
+	if len(seen) != len(images) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "fileIds must list each gallery image once",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if req.CoverFileID != "" && !seen[req.CoverFileID] {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "coverFileId must be one of the gallery images",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for i, fileID := range req.FileIDs {
+			if err := tx.Model(&models.ProductImage{}).
+				Where("id = ?", byFileID[fileID].ID).
+				UpdateColumn("position", i).Error; err != nil {
+				return err
+			}
+		}
+		if req.CoverFileID != "" && req.CoverFileID != product.FileID {
+			return setCover(tx, product, byFileID[req.CoverFileID])
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.respondWithProduct(c, product)
+}
+
+// RemoveProductImage removes an image from the gallery; removing the cover
+// makes the next image the cover (DELETE /v1/product/:productId/images/:fileId)
+func (h *ProductHandler) RemoveProductImage(c *gin.Context) {
+	product, _, ok := h.findOwnedProduct(c, false)
+	if !ok {
+		return
+	}
+	fileID := c.Param("fileId")
+
+	var images []models.ProductImage
+	if err := h.db.Where("product_id = ?", product.ID).Order("position, id").Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	var removed *models.ProductImage
+	var remaining []models.ProductImage
+	for i := range images {
+		if images[i].FileID == fileID {
+			removed = &images[i]
+		} else {
+			remaining = append(remaining, images[i])
+		}
+	}
+	if removed == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Image is not in the gallery",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+	if len(remaining) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "A product needs at least one image",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(removed).Error; err != nil {
+			return err
+		}
+		if removed.FileID == product.FileID {
+			return setCover(tx, product, remaining[0])
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.respondWithProduct(c, product)
+}
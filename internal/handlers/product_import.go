@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Columns of a product import; attributes go in attr.<key> columns
+const (
+	importColumnSKU         = "sku"
+	importColumnName        = "name"
+	importColumnCategory    = "category"
+	importColumnQty         = "qty"
+	importColumnPrice       = "price"
+	importColumnFileID      = "fileid"
+	importColumnFileIDs     = "fileids"
+	importColumnDescription = "description"
+	importAttributePrefix   = "attr."
+)
+
+var (
+	importColumnNames = []string{
+		importColumnSKU, importColumnName, importColumnCategory, importColumnQty, importColumnPrice,
+		importColumnFileID, importColumnFileIDs, importColumnDescription,
+	}
+	importRequiredColumns = []string{
+		importColumnSKU, importColumnName, importColumnCategory, importColumnQty, importColumnPrice,
+		importColumnFileID,
+	}
+)
+
+// importColumns maps the header of an import to column positions
+type importColumns struct {
+	fields     map[string]int
+	attributes map[string]int
+}
+
+// parseImportHeader reads the header row; column names are case-insensitive
+func parseImportHeader(header []string) (*importColumns, error) {
+	columns := &importColumns{fields: make(map[string]int), attributes: make(map[string]int)}
+	known := make(map[string]bool, len(importColumnNames))
+	for _, name := range importColumnNames {
+		known[name] = true
+	}
+
+	for i, cell := range header {
+		name := strings.TrimSpace(cell)
+		lower := strings.ToLower(name)
+		switch {
+		case name == "":
+			continue
+		case strings.HasPrefix(lower, importAttributePrefix):
+			key := name[len(importAttributePrefix):]
+			if !services.IsAttributeKey(key) {
+				return nil, fmt.Errorf("invalid attribute column: %s", name)
+			}
+			if _, exists := columns.attributes[key]; exists {
+				return nil, fmt.Errorf("duplicate column: %s", name)
+			}
+			columns.attributes[key] = i
+		case known[lower]:
+			if _, exists := columns.fields[lower]; exists {
+				return nil, fmt.Errorf("duplicate column: %s", name)
+			}
+			columns.fields[lower] = i
+		default:
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+	}
+
+	for _, name := range importRequiredColumns {
+		if _, ok := columns.fields[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+	return columns, nil
+}
+
+// has reports whether the import has the given column
+func (columns *importColumns) has(field string) bool {
+	_, ok := columns.fields[field]
+	return ok
+}
+
+// get returns the trimmed cell of the given column, empty when the row is short
+func (columns *importColumns) get(row []string, field string) string {
+	i, ok := columns.fields[field]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// errTooManyImportRows stops counting the rows of a file once it is over the limit
+var errTooManyImportRows = errors.New("too many rows")
+
+// eachImportRow streams the rows of an uploaded CSV or XLSX file to fn
+func eachImportRow(format models.ProductImportFormat, data []byte, fn func(row []string) error) error {
+	if format == models.ProductImportXLSX {
+		return utils.EachXLSXRow(data, fn)
+	}
+	return utils.EachCSVRow(data, fn)
+}
+
+// ImportProducts queues a CSV or XLSX file of products for import
+// (POST /v1/product/import). The header and size are checked right away; the
+// rows are validated and imported in the background.
+func (h *ProductHandler) ImportProducts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "file is required",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var format models.ProductImportFormat
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".csv":
+		format = models.ProductImportCSV
+	case ".xlsx":
+		format = models.ProductImportXLSX
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "file must be a .csv or .xlsx spreadsheet",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if fileHeader.Size > h.importMaxBytes {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   fmt.Sprintf("file must be at most %d MB", h.importMaxBytes>>20),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	upsert := false
+	if value := c.PostForm("upsert"); value != "" {
+		if upsert, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "upsert must be true or false",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, h.importMaxBytes))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	var header []string
+	rowCount, total := 0, 0
+	err = eachImportRow(format, data, func(row []string) error {
+		rowCount++
+		if rowCount == 1 {
+			header = row
+			return nil
+		}
+		if !utils.IsBlankRow(row) {
+			total++
+			if total > h.importMaxRows {
+				return errTooManyImportRows
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errTooManyImportRows) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "file is not a valid " + strings.ToUpper(string(format)) + " file",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if rowCount == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "file is empty",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if _, err := parseImportHeader(header); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid header: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if total == 0 || total > h.importMaxRows {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   fmt.Sprintf("file must contain between 1 and %d products", h.importMaxRows),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	job := models.ProductImport{
+		UserID:    userIDUint,
+		FileName:  filepath.Base(fileHeader.Filename),
+		Format:    format,
+		Upsert:    upsert,
+		Status:    models.ProductImportPending,
+		Data:      data,
+		TotalRows: total,
+	}
+	if err := h.db.Create(&job).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// findProductImport loads the caller's import named by the :importId path
+// parameter, writing an error response if it fails
+func (h *ProductHandler) findProductImport(c *gin.Context) (*models.ProductImport, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return nil, false
+	}
+
+	importID, err := strconv.ParseUint(c.Param("importId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid importId",
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	var job models.ProductImport
+	if err := h.db.Omit("data").Where("id = ? AND user_id = ?", importID, userID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "importId is not found",
+				Code:    http.StatusNotFound,
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server Error",
+			Code:    http.StatusInternalServerError,
+		})
+		return nil, false
+	}
+	return &job, true
+}
+
+// GetProductImport reports the progress of an import (GET /v1/product/import/:importId)
+func (h *ProductHandler) GetProductImport(c *gin.Context) {
+	job, ok := h.findProductImport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GetProductImportErrors downloads the rows that were not imported as CSV
+// (GET /v1/product/import/:importId/errors)
+func (h *ProductHandler) GetProductImportErrors(c *gin.Context) {
+	job, ok := h.findProductImport(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("product-import-%d-errors.csv", job.ID)))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"row", "sku", "error"})
+	for _, rowError := range job.Errors {
+		writer.Write([]string{strconv.Itoa(rowError.Row), rowError.SKU, rowError.Error})
+	}
+	writer.Flush()
+}
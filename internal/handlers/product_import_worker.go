@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/utils"
+
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+const (
+	// importProgressEvery is how many failed rows may go by before progress is
+	// saved; imported rows save it with their product
+	importProgressEvery = 25
+	// importStaleAfter is how long a processing import may go without progress
+	// before another worker takes it over, e.g. after a restart
+	importStaleAfter = 10 * time.Minute
+)
+
+// StartImportWorker runs queued product imports every interval until ctx is done
+func (h *ProductHandler) StartImportWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := h.processImports(ctx); err != nil {
+					log.Printf("Failed to process product imports: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// processImports runs the queued imports one after another
+func (h *ProductHandler) processImports(ctx context.Context) error {
+	for ctx.Err() == nil {
+		job, err := h.claimImport()
+		if err != nil || job == nil {
+			return err
+		}
+		if err := h.runImport(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimImport marks the oldest queued import as processing and returns it,
+// or nil when there is none. The status check keeps two replicas from taking
+// the same import.
+func (h *ProductHandler) claimImport() (*models.ProductImport, error) {
+	var job models.ProductImport
+	err := h.db.Where("status = ? OR (status = ? AND updated_at < ?)",
+		models.ProductImportPending, models.ProductImportProcessing, time.Now().Add(-importStaleAfter)).
+		Order("id").First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := h.db.Model(&models.ProductImport{}).
+		Where("id = ? AND status = ? AND updated_at = ?", job.ID, job.Status, job.UpdatedAt).
+		Updates(map[string]any{
+			"status":     models.ProductImportProcessing,
+			"started_at": now,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another worker got there first; try again on the next tick
+		return nil, nil
+	}
+
+	// A job taken over keeps the progress saved up to its checkpoint
+	job.Status = models.ProductImportProcessing
+	job.StartedAt = &now
+	job.UpdatedAt = now
+	return &job, nil
+}
+
+// errImportTakenOver reports that another worker has saved progress on the
+// job since this one last did
+var errImportTakenOver = errors.New("import was taken over by another worker")
+
+// runImport imports every row of the job after its checkpoint and records the
+// outcome. Rows are imported on their own, so one bad row does not hold back
+// the others.
+func (h *ProductHandler) runImport(job *models.ProductImport) error {
+	var importer *productImporter
+	var importErr error
+	rowNumber := 0
+	err := eachImportRow(job.Format, job.Data, func(row []string) error {
+		rowNumber++
+		if importer == nil {
+			columns, err := parseImportHeader(row)
+			if err != nil {
+				return err
+			}
+			importer = &productImporter{
+				h:          h,
+				job:        job,
+				columns:    columns,
+				categories: make(map[string]*models.Category),
+				schemas:    make(map[uint][]models.AttributeDefinition),
+				skuRows:    make(map[string]int),
+			}
+			return nil
+		}
+		if utils.IsBlankRow(row) {
+			return nil
+		}
+		if rowNumber <= job.CheckpointRow {
+			importer.remember(rowNumber, row)
+			return nil
+		}
+
+		importErr = importer.importRow(rowNumber, row)
+		return importErr
+	})
+	if importErr != nil {
+		if errors.Is(importErr, errImportTakenOver) {
+			return nil
+		}
+		return importErr
+	}
+	if err != nil || importer == nil {
+		message := "file could not be read"
+		if err != nil {
+			message += ": " + err.Error()
+		}
+		return h.db.Model(job).Updates(map[string]any{
+			"status":      models.ProductImportFailed,
+			"error":       message,
+			"data":        nil,
+			"finished_at": time.Now(),
+		}).Error
+	}
+
+	now := time.Now()
+	done := *job
+	done.Status = models.ProductImportCompleted
+	done.FailedRows = len(done.Errors)
+	done.Data = nil
+	done.FinishedAt = &now
+	result := h.db.Model(&done).
+		Where("checkpoint_row = ?", job.CheckpointRow).
+		Select("status", "processed_rows", "created_rows", "updated_rows", "failed_rows", "errors", "data", "finished_at").
+		Updates(&done)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		*job = done
+	}
+	return nil
+}
+
+// productImporter imports the rows of one job, caching the categories and
+// attribute schemas its rows refer to
+type productImporter struct {
+	h          *ProductHandler
+	job        *models.ProductImport
+	columns    *importColumns
+	categories map[string]*models.Category
+	schemas    map[uint][]models.AttributeDefinition
+	// skuRows remembers the row each SKU was first seen in
+	skuRows map[string]int
+}
+
+// parseRow reads and validates the product fields of a row
+func (imp *productImporter) parseRow(row []string) (models.ProductInput, *models.ErrorResponse) {
+	columns := imp.columns
+
+	input := models.ProductInput{
+		Name:        columns.get(row, importColumnName),
+		Category:    models.ProductCategory(columns.get(row, importColumnCategory)),
+		SKU:         columns.get(row, importColumnSKU),
+		FileID:      columns.get(row, importColumnFileID),
+		Description: columns.get(row, importColumnDescription),
+	}
+	for _, field := range []struct {
+		column string
+		value  *uint
+	}{{importColumnQty, &input.Qty}, {importColumnPrice, &input.Price}} {
+		text := columns.get(row, field.column)
+		if text == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(text, 10, 32)
+		if err != nil {
+			return input, invalidProductInput(field.column + " must be a whole number")
+		}
+		*field.value = uint(value)
+	}
+	if fileIDs := columns.get(row, importColumnFileIDs); fileIDs != "" {
+		for _, fileID := range strings.Split(fileIDs, ",") {
+			if fileID = strings.TrimSpace(fileID); fileID != "" {
+				input.FileIDs = append(input.FileIDs, fileID)
+			}
+		}
+	}
+
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return input, invalidProductInput("Invalid product input: " + err.Error())
+	}
+	if errResponse := validateVariants(input.Qty, input.Price, nil, nil); errResponse != nil {
+		return input, errResponse
+	}
+	return input, nil
+}
+
+// remember notes the SKU of a row handled before the checkpoint, so later
+// rows with the same SKU are still reported after a takeover
+func (imp *productImporter) remember(rowNumber int, row []string) {
+	input, errResponse := imp.parseRow(row)
+	if errResponse != nil {
+		return
+	}
+	sku := strings.TrimSpace(input.SKU)
+	if _, seen := imp.skuRows[sku]; !seen {
+		imp.skuRows[sku] = rowNumber
+	}
+}
+
+// importRow imports a row and records its outcome. A product is saved in the
+// same transaction as the checkpoint counting it, so a job taken over after
+// a restart neither repeats nor skips it. The error is only set when the
+// import cannot go on.
+func (imp *productImporter) importRow(rowNumber int, row []string) error {
+	next := *imp.job
+	next.CheckpointRow = rowNumber
+	next.ProcessedRows++
+
+	errResponse, err := imp.saveRow(rowNumber, row, &next)
+	if err != nil {
+		return err
+	}
+	if errResponse == nil {
+		*imp.job = next
+		return nil
+	}
+
+	next.Errors = append(next.Errors, models.ProductImportError{
+		Row:   rowNumber,
+		SKU:   imp.columns.get(row, importColumnSKU),
+		Error: errResponse.Error,
+	})
+	if len(next.Errors)-next.FailedRows >= importProgressEvery {
+		if err := imp.checkpoint(imp.h.db, &next); err != nil {
+			return err
+		}
+	} else {
+		// Failed rows past the last checkpoint are simply tried again
+		next.CheckpointRow = imp.job.CheckpointRow
+	}
+	*imp.job = next
+	return nil
+}
+
+// checkpoint saves the progress in next. It only applies while the job is at
+// the checkpoint this worker saved last.
+func (imp *productImporter) checkpoint(tx *gorm.DB, next *models.ProductImport) error {
+	next.FailedRows = len(next.Errors)
+	next.UpdatedAt = time.Now()
+	result := tx.Model(next).
+		Where("checkpoint_row = ?", imp.job.CheckpointRow).
+		Select("checkpoint_row", "processed_rows", "created_rows", "updated_rows", "failed_rows", "errors", "updated_at").
+		Updates(next)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errImportTakenOver
+	}
+	return nil
+}
+
+// saveRow creates the product of a row, or with upsert updates the seller's
+// product with its SKU, applying the rules of POST and PUT /v1/product. The
+// row is counted in next, which is saved as the checkpoint with the product.
+func (imp *productImporter) saveRow(rowNumber int, row []string, next *models.ProductImport) (*models.ErrorResponse, error) {
+	h, columns, userID := imp.h, imp.columns, imp.job.UserID
+
+	input, errResponse := imp.parseRow(row)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	sku := strings.TrimSpace(input.SKU)
+	if first, seen := imp.skuRows[sku]; seen {
+		return invalidProductInput("sku is already used in row " + strconv.Itoa(first)), nil
+	}
+	imp.skuRows[sku] = rowNumber
+
+	category, errResponse := imp.category(string(input.Category))
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	var existing *models.Product
+	var product models.Product
+	err := h.db.Where("user_id = ? AND sku = ?", userID, sku).First(&product).Error
+	switch {
+	case err == nil:
+		if !imp.job.Upsert {
+			return &models.ErrorResponse{Success: false, Error: "sku already exists", Code: http.StatusConflict}, nil
+		}
+		if product.DeletedAt != nil {
+			return invalidProductInput("sku belongs to a deleted product; restore it before importing"), nil
+		}
+		if len(product.Options) > 0 {
+			return invalidProductInput("product has variants; update it through PUT /v1/product/:productId"), nil
+		}
+		existing = &product
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return serverErrorResponse(), nil
+	}
+
+	var productID uint
+	if existing != nil {
+		productID = existing.ID
+	}
+	if errResponse := h.checkVariantSKUs(userID, productID, sku, nil); errResponse != nil {
+		return errResponse, nil
+	}
+
+	// Left-out columns keep the details of an updated product
+	description := input.Description
+	if existing != nil && !columns.has(importColumnDescription) {
+		description = existing.Description
+	}
+	var attributes map[string]any
+	if existing != nil && len(columns.attributes) == 0 {
+		attributes = existing.Attributes
+	} else {
+		schema, errResponse := imp.schema(category.ID)
+		if errResponse != nil {
+			return errResponse, nil
+		}
+		attributes = importAttributes(schema, columns, row)
+	}
+	attributes, descriptionHTML, errResponse := imp.details(category.ID, attributes, description)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	// A new product's gallery is just the cover unless fileIds is given;
+	// an updated product keeps its gallery
+	gallery := galleryFileIDs(input.FileID, input.FileIDs)
+	if gallery == nil && existing == nil {
+		gallery = []string{input.FileID}
+	}
+	if gallery != nil {
+		if errResponse := h.gallerySizeError(len(gallery)); errResponse != nil {
+			return errResponse, nil
+		}
+	}
+	fileIDs := gallery
+	if fileIDs == nil {
+		fileIDs = []string{input.FileID}
+	}
+	files, errResponse := h.ownedFiles(userID, fileIDs)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	if existing == nil {
+		product = models.Product{UserID: userID}
+	}
+	product.Name = input.Name
+	product.Category = models.ProductCategory(category.Name)
+	product.CategoryID = category.ID
+	product.Qty = input.Qty
+	product.Price = input.Price
+	product.SKU = sku
+	product.FileID = input.FileID
+	product.FileURI = files[input.FileID].FileURI
+	product.Description = description
+	product.DescriptionHTML = descriptionHTML
+	product.Attributes = attributes
+
+	saved := *next
+	if existing != nil {
+		saved.UpdatedRows++
+	} else {
+		saved.CreatedRows++
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Variants", "Images").Save(&product).Error; err != nil {
+			return err
+		}
+		if gallery != nil {
+			if err := replaceImages(tx, product.ID, gallery, files); err != nil {
+				return err
+			}
+		} else if err := ensureCoverImage(tx, &product); err != nil {
+			return err
+		}
+		return imp.checkpoint(tx, &saved)
+	})
+	if errors.Is(err, errImportTakenOver) {
+		return nil, err
+	}
+	if err != nil {
+		return serverErrorResponse(), nil
+	}
+	*next = saved
+	return nil, nil
+}
+
+// category resolves the category of a row
+func (imp *productImporter) category(value string) (*models.Category, *models.ErrorResponse) {
+	key := strings.ToLower(value)
+	if category, ok := imp.categories[key]; ok {
+		return category, nil
+	}
+
+	category, err := imp.h.categories.Resolve(value)
+	if err != nil {
+		if errors.Is(err, services.ErrCategoryNotFound) {
+			return nil, invalidProductInput("category is not valid")
+		}
+		return nil, serverErrorResponse()
+	}
+	imp.categories[key] = category
+	return category, nil
+}
+
+// schema returns the attribute schema of a category
+func (imp *productImporter) schema(categoryID uint) ([]models.AttributeDefinition, *models.ErrorResponse) {
+	if schema, ok := imp.schemas[categoryID]; ok {
+		return schema, nil
+	}
+
+	schema, err := imp.h.categories.AttributeSchema(categoryID)
+	if err != nil {
+		return nil, serverErrorResponse()
+	}
+	imp.schemas[categoryID] = schema
+	return schema, nil
+}
+
+// details validates the attributes of a row and renders its description,
+// like productDetails does for API payloads
+func (imp *productImporter) details(categoryID uint, attributes map[string]any, description string) (map[string]any, string, *models.ErrorResponse) {
+	schema, errResponse := imp.schema(categoryID)
+	if errResponse != nil {
+		return nil, "", errResponse
+	}
+	attributes, err := services.ValidateAttributes(schema, attributes)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAttributes) {
+			return nil, "", invalidProductInput(err.Error())
+		}
+		return nil, "", serverErrorResponse()
+	}
+
+	descriptionHTML, err := utils.RenderMarkdown(description)
+	if err != nil {
+		return nil, "", invalidProductInput("description is not valid Markdown")
+	}
+	return attributes, descriptionHTML, nil
+}
+
+// importAttributes reads the attr.<key> cells of a row. Cells are typed by
+// the schema, so "12" becomes a number for a number attribute; cells that do
+// not parse stay strings and are reported by ValidateAttributes.
+func importAttributes(schema []models.AttributeDefinition, columns *importColumns, row []string) map[string]any {
+	types := make(map[string]string, len(schema))
+	for _, definition := range schema {
+		types[definition.Key] = definition.Type
+	}
+
+	attributes := make(map[string]any, len(columns.attributes))
+	for key, i := range columns.attributes {
+		if i >= len(row) {
+			continue
+		}
+		text := strings.TrimSpace(row[i])
+		if text == "" {
+			continue
+		}
+
+		var value any = text
+		switch types[key] {
+		case models.AttributeNumber:
+			if number, err := strconv.ParseFloat(text, 64); err == nil {
+				value = number
+			}
+		case models.AttributeBoolean:
+			if boolean, err := strconv.ParseBool(text); err == nil {
+				value = boolean
+			}
+		}
+		attributes[key] = value
+	}
+	return attributes
+}
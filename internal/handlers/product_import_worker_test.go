@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"testing"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/testutil"
+)
+
+func TestRunImportResumesAfterCheckpoint(t *testing.T) {
+	db := testutil.DB(t)
+	h := NewProductHandler(db, services.NewCategoryService(db), config.ProductConfig{MaxImages: 10, ImportMaxRows: 100})
+
+	user := models.User{Name: "Seller", Email: "seller@example.com", Password: "!"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	upload := models.FileUpload{FileID: "file-1", FileName: "cover.jpg", FileSize: 1, FileType: "image/jpeg",
+		FileURI: "http://files.local/file-1", FileThumbnailURI: "http://files.local/file-1-thumb", UserID: &user.ID}
+	if err := db.Create(&upload).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows 2 and 3 were imported by a worker that stopped before finishing
+	data := "sku,name,category,qty,price,fileId\n" +
+		"SKU-1,Kaos Polos,Clothes,1,1000,file-1\n" +
+		"SKU-2,Kaos Garis,Clothes,1,1000,file-1\n" +
+		"SKU-1,Kaos Lagi,Clothes,1,1000,file-1\n" +
+		"SKU-3,Kaos Batik,Clothes,1,1000,file-1\n"
+	job := models.ProductImport{
+		UserID:        user.ID,
+		FileName:      "products.csv",
+		Format:        models.ProductImportCSV,
+		Status:        models.ProductImportProcessing,
+		Data:          []byte(data),
+		TotalRows:     4,
+		ProcessedRows: 2,
+		CreatedRows:   2,
+		CheckpointRow: 3,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.runImport(&job); err != nil {
+		t.Fatal(err)
+	}
+
+	var skus []string
+	db.Model(&models.Product{}).Where("user_id = ?", user.ID).Order("sku").Pluck("sku", &skus)
+	if len(skus) != 1 || skus[0] != "SKU-3" {
+		t.Fatalf("expected only the rows after the checkpoint to be imported, got %v", skus)
+	}
+
+	var saved models.ProductImport
+	if err := db.First(&saved, job.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != models.ProductImportCompleted || saved.ProcessedRows != 4 || saved.CreatedRows != 3 || saved.FailedRows != 1 {
+		t.Fatalf("unexpected progress %+v", saved)
+	}
+	if len(saved.Errors) != 1 || saved.Errors[0].Row != 4 || saved.Errors[0].Error != "sku is already used in row 2" {
+		t.Fatalf("expected the duplicate of a row before the checkpoint to be reported, got %+v", saved.Errors)
+	}
+}
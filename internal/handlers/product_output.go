@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"strconv"
+
+	"tutuplapak/internal/models"
+)
+
+// newProductOutput builds a product of a listing
+func newProductOutput(product *models.Product, variants []models.ProductVariant, images []models.ProductImage) models.ProductOutput {
+	return models.ProductOutput{
+		ProductID:        strconv.FormatUint(uint64(product.ID), 10),
+		Name:             product.Name,
+		Category:         string(product.Category),
+		CategoryID:       product.CategoryID,
+		Quantity:         product.Qty,
+		Price:            product.Price,
+		SKU:              product.SKU,
+		FileID:           product.FileID,
+		FileURI:          product.FileURI,
+		FileThumbnailURI: product.FileThumbnailURI,
+		CreatedAt:        product.CreatedAt,
+		UpdatedAt:        product.UpdatedAt,
+		Options:          product.Options,
+		Variants:         variants,
+		Images:           images,
+		Description:      product.Description,
+		DescriptionHTML:  product.DescriptionHTML,
+		Attributes:       product.Attributes,
+		ArchivedAt:       product.ArchivedAt,
+		DeletedAt:        product.DeletedAt,
+	}
+}
+
+// newProductResponse builds the response of the product write endpoints
+func newProductResponse(product *models.Product) models.ProductResponse {
+	images := product.Images
+	if images == nil {
+		images = []models.ProductImage{}
+	}
+	return models.ProductResponse{
+		ProductID:        strconv.FormatUint(uint64(product.ID), 10),
+		Name:             product.Name,
+		Category:         string(product.Category),
+		CategoryID:       product.CategoryID,
+		Qty:              product.Qty,
+		Price:            product.Price,
+		SKU:              product.SKU,
+		FileID:           product.FileID,
+		FileURI:          product.FileURI,
+		FileThumbnailURI: product.FileThumbnailURI,
+		CreatedAt:        product.CreatedAt,
+		UpdatedAt:        product.UpdatedAt,
+		Options:          product.Options,
+		Variants:         product.Variants,
+		Images:           images,
+		Description:      product.Description,
+		DescriptionHTML:  product.DescriptionHTML,
+		Attributes:       product.Attributes,
+		ArchivedAt:       product.ArchivedAt,
+		DeletedAt:        product.DeletedAt,
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Markers ts_headline puts around matches; they cannot occur in product names,
+// so the name can be HTML-escaped before they are turned into <mark> tags.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// productSearch builds the SQL for the q parameter of GetProducts: a prefix
+// full-text match on products.search_vector, or a pg_trgm similarity match on
+// the name so that typos still find the product.
+type productSearch struct {
+	text    string
+	tsquery string
+}
+
+// newProductSearch returns nil when q is blank
+func newProductSearch(q string) *productSearch {
+	text := strings.TrimSpace(q)
+	if text == "" {
+		return nil
+	}
+
+	// Only letters and digits reach to_tsquery, so user input cannot break its syntax
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		terms = append(terms, word+":*")
+	}
+
+	return &productSearch{
+		text:    text,
+		tsquery: strings.Join(terms, " & "),
+	}
+}
+
+// filter restricts the query to matching products
+func (s *productSearch) filter(query *gorm.DB) *gorm.DB {
+	if s.tsquery == "" {
+		return query.Where("(name % ? OR ? <% name)", s.text, s.text)
+	}
+	return query.Where("(search_vector @@ to_tsquery('simple', ?) OR name % ? OR ? <% name)", s.tsquery, s.text, s.text)
+}
+
+// rankExpression is the relevance of a product to the search
+func (s *productSearch) rankExpression() (string, []any) {
+	if s.tsquery == "" {
+		return "similarity(name, ?)", []any{s.text}
+	}
+	return "(ts_rank(search_vector, to_tsquery('simple', ?)) + similarity(name, ?))", []any{s.tsquery, s.text}
+}
+
+// selectRanked adds the relevance and highlight columns
+func (s *productSearch) selectRanked(query *gorm.DB) *gorm.DB {
+	rank, args := s.rankExpression()
+	if s.tsquery == "" {
+		return query.Select("products.*, "+rank+" AS rank, name AS highlight", args...)
+	}
+	args = append(args, s.tsquery, "StartSel="+highlightStart+", StopSel="+highlightStop+", HighlightAll=true")
+	return query.Select("products.*, "+rank+" AS rank, ts_headline('simple', name, to_tsquery('simple', ?), ?) AS highlight", args...)
+}
+
+// highlightSnippet turns a ts_headline result into escaped HTML with <mark> around matches
+func highlightSnippet(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
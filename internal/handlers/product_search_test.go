@@ -0,0 +1,52 @@
+package handlers
+
+import "testing"
+
+func TestNewProductSearch(t *testing.T) {
+	if search := newProductSearch("   "); search != nil {
+		t.Fatalf("expected no search for a blank q, got %+v", search)
+	}
+
+	tests := []struct {
+		q       string
+		text    string
+		tsquery string
+	}{
+		{"kaos", "kaos", "kaos:*"},
+		{"  Kaos Polos ", "Kaos Polos", "kaos:* & polos:*"},
+		// Operators and quotes cannot reach to_tsquery
+		{"kaos & !polos:* | 'x'", "kaos & !polos:* | 'x'", "kaos:* & polos:* & x:*"},
+		{"sepatu-2024", "sepatu-2024", "sepatu:* & 2024:*"},
+		// Without letters or digits only the trigram match is left
+		{"&|!", "&|!", ""},
+	}
+	for _, tt := range tests {
+		search := newProductSearch(tt.q)
+		if search == nil {
+			t.Fatalf("expected a search for %q", tt.q)
+		}
+		if search.text != tt.text || search.tsquery != tt.tsquery {
+			t.Errorf("newProductSearch(%q) = {%q, %q}, want {%q, %q}", tt.q, search.text, search.tsquery, tt.text, tt.tsquery)
+		}
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		headline string
+		want     string
+	}{
+		{"", ""},
+		{"Kaos Polos", "Kaos Polos"},
+		{highlightStart + "Kaos" + highlightStop + " Polos", "<mark>Kaos</mark> Polos"},
+		// The name itself is escaped, only the markers become tags
+		{"<script>alert(1)</script> " + highlightStart + "Kaos" + highlightStop,
+			"&lt;script&gt;alert(1)&lt;/script&gt; <mark>Kaos</mark>"},
+		{highlightStart + "T&J" + highlightStop + " \"Polos\" <mark>", "<mark>T&amp;J</mark> &#34;Polos&#34; &lt;mark&gt;"},
+	}
+	for _, tt := range tests {
+		if got := highlightSnippet(tt.headline); got != tt.want {
+			t.Errorf("highlightSnippet(%q) = %q, want %q", tt.headline, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"tutuplapak/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var errVariantNotFound = errors.New("variant not found")
+
+func invalidProductInput(message string) *models.ErrorResponse {
+	return &models.ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    http.StatusBadRequest,
+	}
+}
+
+// validateVariants checks that every variant picks exactly one value of each
+// option and that no two variants share a combination or SKU. Products
+// without variants need their own qty and price.
+func validateVariants(qty, price uint, options []models.ProductOption, variants []models.ProductVariantInput) *models.ErrorResponse {
+	if len(variants) == 0 {
+		if len(options) > 0 {
+			return invalidProductInput("options need at least one variant")
+		}
+		// An empty variants list passes the required_without binding
+		if qty < 1 || price < 100 {
+			return invalidProductInput("qty and price are required for products without variants")
+		}
+		return nil
+	}
+	if len(options) == 0 {
+		return invalidProductInput("variants need at least one option")
+	}
+
+	values := make(map[string]map[string]bool, len(options))
+	for _, option := range options {
+		if _, exists := values[option.Name]; exists {
+			return invalidProductInput("Duplicate option: " + option.Name)
+		}
+		values[option.Name] = make(map[string]bool, len(option.Values))
+		for _, value := range option.Values {
+			if values[option.Name][value] {
+				return invalidProductInput("Duplicate value " + value + " of option " + option.Name)
+			}
+			values[option.Name][value] = true
+		}
+	}
+
+	combinations := make(map[string]bool, len(variants))
+	skus := make(map[string]bool, len(variants))
+	var totalQty uint
+	for _, variant := range variants {
+		sku := strings.TrimSpace(variant.SKU)
+		if skus[sku] {
+			return invalidProductInput("Duplicate variant sku: " + sku)
+		}
+		skus[sku] = true
+
+		if len(variant.Options) != len(options) {
+			return invalidProductInput("Variant " + sku + " must set exactly one value for each option")
+		}
+		parts := make([]string, 0, len(options))
+		for _, option := range options {
+			value, ok := variant.Options[option.Name]
+			if !ok || !values[option.Name][value] {
+				return invalidProductInput("Variant " + sku + " has no valid value for option " + option.Name)
+			}
+			parts = append(parts, value)
+		}
+		combination := strings.Join(parts, "\x00")
+		if combinations[combination] {
+			return invalidProductInput("Variant " + sku + " repeats the options of another variant")
+		}
+		combinations[combination] = true
+
+		totalQty += variant.Qty
+	}
+
+	if totalQty == 0 {
+		return invalidProductInput("At least one variant must be in stock")
+	}
+	return nil
+}
+
+// summarizeVariants returns the stock and starting price a product with these variants shows
+func summarizeVariants(variants []models.ProductVariantInput) (qty uint, price uint) {
+	for i, variant := range variants {
+		qty += variant.Qty
+		if i == 0 || variant.Price < price {
+			price = variant.Price
+		}
+	}
+	return qty, price
+}
+
+// checkVariantSKUs rejects a product or variant SKU that another product of
+// the seller already uses, as its own SKU or a variant's
+func (h *ProductHandler) checkVariantSKUs(userID, productID uint, sku string, variants []models.ProductVariantInput) *models.ErrorResponse {
+	skus := []string{strings.TrimSpace(sku)}
+	for _, variant := range variants {
+		skus = append(skus, strings.TrimSpace(variant.SKU))
+	}
+
+	var count int64
+	err := h.db.Model(&models.Product{}).
+		Where("user_id = ? AND id <> ?", userID, productID).
+		Where("sku IN ? OR id IN (?)", skus,
+			h.db.Model(&models.ProductVariant{}).Select("product_id").Where("sku IN ?", skus)).
+		Count(&count).Error
+	if err != nil {
+		return serverErrorResponse()
+	}
+	if count > 0 {
+		return &models.ErrorResponse{
+			Success: false,
+			Error:   "sku already exists",
+			Code:    http.StatusConflict,
+		}
+	}
+	return nil
+}
+
+// variantFileIDs lists the images the variants refer to
+func variantFileIDs(variants []models.ProductVariantInput) []string {
+	var fileIDs []string
+	for _, variant := range variants {
+		if variant.FileID != "" {
+			fileIDs = append(fileIDs, variant.FileID)
+		}
+	}
+	return fileIDs
+}
+
+// replaceVariants makes the product's variants match the input: variants
+// named by variantId are updated, the others are created and variants left
+// out are removed. Purchases keep the variant id and price they were made at.
+func replaceVariants(tx *gorm.DB, productID uint, inputs []models.ProductVariantInput, files map[string]models.FileUpload) ([]models.ProductVariant, error) {
+	var existing []models.ProductVariant
+	if err := tx.Where("product_id = ?", productID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.ProductVariant, len(existing))
+	for _, variant := range existing {
+		byID[variant.ID] = variant
+	}
+
+	variants := make([]models.ProductVariant, 0, len(inputs))
+	kept := make(map[uint]bool, len(inputs))
+	for i, input := range inputs {
+		variant := models.ProductVariant{ProductID: productID}
+		if input.VariantID != nil {
+			current, ok := byID[*input.VariantID]
+			if !ok {
+				return nil, errVariantNotFound
+			}
+			variant = current
+			kept[variant.ID] = true
+		}
+
+		variant.SKU = strings.TrimSpace(input.SKU)
+		variant.Options = input.Options
+		variant.Qty = input.Qty
+		variant.Price = input.Price
+		variant.FileID = input.FileID
+		variant.FileURI = files[input.FileID].FileURI
+		variant.FileThumbnailURI = files[input.FileID].FileThumbnailURI
+		variant.Position = i
+		variants = append(variants, variant)
+	}
+
+	var removed []uint
+	for _, variant := range existing {
+		if !kept[variant.ID] {
+			removed = append(removed, variant.ID)
+		}
+	}
+	if len(removed) > 0 {
+		if err := tx.Delete(&models.ProductVariant{}, removed).Error; err != nil {
+			return nil, err
+		}
+	}
+	for i := range variants {
+		if err := tx.Save(&variants[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+// loadVariants returns the variants of the given products keyed by product ID
+func loadVariants(db *gorm.DB, productIDs []uint) (map[uint][]models.ProductVariant, error) {
+	variants := make(map[uint][]models.ProductVariant)
+	if len(productIDs) == 0 {
+		return variants, nil
+	}
+
+	var rows []models.ProductVariant
+	if err := db.Where("product_id IN ?", productIDs).Order("position, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		variants[row.ProductID] = append(variants[row.ProductID], row)
+	}
+	return variants, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -40,7 +41,8 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 	}
 
 	if req.SenderContactType == models.ContactTypePhone {
-		if validationErr := utils.PhoneValidation(req.SenderContactDetail); validationErr != nil {
+		phone, validationErr := utils.NormalizePhone(req.SenderContactDetail)
+		if validationErr != nil {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Success: false,
 				Error:   validationErr.Error,
@@ -48,7 +50,9 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 			})
 			return
 		}
+		req.SenderContactDetail = phone
 	} else if req.SenderContactType == models.ContactTypeEmail {
+		req.SenderContactDetail = utils.CanonicalEmail(req.SenderContactDetail)
 		if err := utils.EmailValidation(req.SenderContactDetail); err != nil {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Success: false,
@@ -68,6 +72,8 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 
 	var productIDs []uint
 	productQuantityMap := make(map[uint]uint)
+	var variantIDs []uint
+	variantQuantityMap := make(map[uint]uint)
 
 	for _, item := range req.PurchasedItems {
 		if item.Quantity < 2 {
@@ -89,13 +95,32 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 			return
 		}
 
-		productIDs = append(productIDs, uint(productID))
-		productQuantityMap[uint(productID)] = item.Quantity
+		// Several variants of one product may be bought together, so quantities add up
+		if _, exists := productQuantityMap[uint(productID)]; !exists {
+			productIDs = append(productIDs, uint(productID))
+		}
+		productQuantityMap[uint(productID)] += item.Quantity
+
+		if item.VariantID != "" {
+			variantID, err := strconv.ParseUint(item.VariantID, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{
+					Success: false,
+					Error:   "Invalid variant ID",
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			if _, exists := variantQuantityMap[uint(variantID)]; !exists {
+				variantIDs = append(variantIDs, uint(variantID))
+			}
+			variantQuantityMap[uint(variantID)] += item.Quantity
+		}
 	}
 
 	// Batch fetch all products in one query
 	var products []models.Product
-	if err := h.db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+	if err := h.db.Where("id IN ? AND is_active = ?", productIDs, true).Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   "Database error",
@@ -113,6 +138,57 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 		return
 	}
 
+	variants, err := loadVariants(h.db, productIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Database error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	variantMap := make(map[uint]models.ProductVariant)
+	for _, productVariants := range variants {
+		for _, variant := range productVariants {
+			variantMap[variant.ID] = variant
+		}
+	}
+
+	// Products with variants are bought by variant, and a variant must belong to its product
+	for _, item := range req.PurchasedItems {
+		productID, _ := strconv.ParseUint(item.ProductID, 10, 32)
+		if item.VariantID == "" {
+			if len(variants[uint(productID)]) > 0 {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{
+					Success: false,
+					Error:   "variantId is required for product ID " + item.ProductID,
+					Code:    http.StatusBadRequest,
+				})
+				return
+			}
+			continue
+		}
+		variantID, _ := strconv.ParseUint(item.VariantID, 10, 32)
+		if variant, exists := variantMap[uint(variantID)]; !exists || variant.ProductID != uint(productID) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "One or more variants not found",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+	for _, variantID := range variantIDs {
+		if variantMap[variantID].Qty < variantQuantityMap[variantID] {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Insufficient variant quantity for variant ID " + strconv.FormatUint(uint64(variantID), 10),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
 	// Create product map and validate inventory
 	productMap := make(map[uint]models.Product)
 	for _, product := range products {
@@ -146,10 +222,15 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 		return
 	}
 
-	// Decrease product stock based on requested quantities
+	// Decrease product stock based on requested quantities. The stock is
+	// checked again in the same statement, so concurrent purchases cannot
+	// both take the last items.
 	for _, product := range products {
 		requestedQty := productQuantityMap[product.ID]
-		if err := tx.Model(&product).Update("qty", product.Qty-requestedQty).Error; err != nil {
+		result := tx.Model(&models.Product{}).
+			Where("id = ? AND qty >= ?", product.ID, requestedQty).
+			Update("qty", gorm.Expr("qty - ?", requestedQty))
+		if result.Error != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Success: false,
@@ -158,6 +239,39 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 			})
 			return
 		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Insufficient product quantity for product ID " + strconv.FormatUint(uint64(product.ID), 10),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+	for _, variantID := range variantIDs {
+		requestedQty := variantQuantityMap[variantID]
+		result := tx.Model(&models.ProductVariant{}).
+			Where("id = ? AND qty >= ?", variantID, requestedQty).
+			Update("qty", gorm.Expr("qty - ?", requestedQty))
+		if result.Error != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Failed to update variant quantity",
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Insufficient variant quantity for variant ID " + strconv.FormatUint(uint64(variantID), 10),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
 	}
 
 	sellerIDs := make(map[uint]bool)
@@ -196,9 +310,6 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 		productID, _ := strconv.ParseUint(item.ProductID, 10, 32)
 		product := productMap[uint(productID)]
 
-		itemTotalPrice := product.Price * item.Quantity
-		totalPrice += itemTotalPrice
-
 		purchasedItem := models.PurchasedItemResponse{
 			ProductID:        item.ProductID,
 			Name:             product.Name,
@@ -212,12 +323,32 @@ func (h *PurchaseHandler) PurchaseProducts(c *gin.Context) {
 			CreatedAt:        product.CreatedAt.Format(time.RFC3339),
 			UpdatedAt:        product.UpdatedAt.Format(time.RFC3339),
 		}
+		var variantID *uint
+		if item.VariantID != "" {
+			id, _ := strconv.ParseUint(item.VariantID, 10, 32)
+			variant := variantMap[uint(id)]
+			variantID = &variant.ID
+
+			purchasedItem.VariantID = item.VariantID
+			purchasedItem.Options = variant.Options
+			purchasedItem.Price = variant.Price
+			purchasedItem.SKU = variant.SKU
+			if variant.FileID != "" {
+				purchasedItem.FileID = variant.FileID
+				purchasedItem.FileURI = variant.FileURI
+				purchasedItem.FileThumbnailURI = variant.FileThumbnailURI
+			}
+		}
 		purchasedItems = append(purchasedItems, purchasedItem)
 
+		itemTotalPrice := purchasedItem.Price * item.Quantity
+		totalPrice += itemTotalPrice
+
 		purchaseItemsToCreate = append(purchaseItemsToCreate, models.PurchaseItem{
 			ProductID: uint(productID),
+			VariantID: variantID,
 			Quantity:  item.Quantity,
-			Price:     product.Price,
+			Price:     purchasedItem.Price,
 		})
 
 		if seller, exists := sellerMap[product.UserID]; exists {
@@ -441,3 +572,100 @@ func (h *PurchaseHandler) ProcessPurchase(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{"success": true})
 }
+
+// sellerPurchases restricts a purchase query to orders containing the seller's products
+func sellerPurchases(db *gorm.DB, sellerID uint) *gorm.DB {
+	sold := db.Model(&models.PurchaseItem{}).
+		Select("purchase_items.purchase_id").
+		Joins("JOIN products ON products.id = purchase_items.product_id").
+		Where("products.user_id = ?", sellerID)
+	return db.Where("id IN (?)", sold).
+		Preload("PurchaseItems", "product_id IN (?)", db.Model(&models.Product{}).Select("id").Where("user_id = ?", sellerID))
+}
+
+// ListPurchases returns the orders for the caller's products, newest first,
+// with only the caller's items (GET /v1/purchase?limit=20&offset=0)
+func (h *PurchaseHandler) ListPurchases(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid limit",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid offset",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	purchases := []models.Purchase{}
+	if err := sellerPurchases(h.db, userID.(uint)).
+		Order("created_at DESC, id").
+		Limit(limit).
+		Offset(offset).
+		Find(&purchases).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, purchases)
+}
+
+// GetPurchase returns one order for the caller's products with only the
+// caller's items (GET /v1/purchase/:purchaseId)
+func (h *PurchaseHandler) GetPurchase(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	// Other sellers' orders are reported as missing, as are malformed ids
+	var purchase models.Purchase
+	err := sellerPurchases(h.db, userID.(uint)).
+		Where("id::text = ?", c.Param("purchaseId")).
+		First(&purchase).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "Purchase not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, purchase)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// confirmPassword checks the password, or the reauthentication token users
+// without a password get from a fresh identity provider login
+// (POST /v1/user/oidc/:provider/reauth). On failure it writes the response and
+// returns false.
+func confirmPassword(c *gin.Context, reauth *services.ReauthService, user *models.User, password, reauthToken, invalidMessage string) bool {
+	if reauthToken == "" {
+		if err := utils.VerifyPassword(password, user.Password); err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Success: false,
+				Error:   invalidMessage,
+				Code:    http.StatusUnauthorized,
+			})
+			return false
+		}
+		return true
+	}
+
+	if err := reauth.Consume(user.ID, reauthToken); err != nil {
+		if errors.Is(err, services.ErrReauthTokenInvalid) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid or expired reauthentication, please log in at your identity provider again",
+				Code:    http.StatusUnauthorized,
+			})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return false
+	}
+	return true
+}
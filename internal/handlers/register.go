@@ -3,9 +3,8 @@ package handlers
 import (
 	"errors"
 	"net/http"
-	"strings"
-	"tutuplapak/internal/middleware"
 	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
 	"tutuplapak/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -14,13 +13,19 @@ import (
 )
 
 type RegisterHandler struct {
-	db *gorm.DB
+	db            *gorm.DB
+	refreshTokens *services.RefreshTokenService
+	access        *services.AccessService
+	audit         *services.AuditService
 }
 
-// NewRegisterHandler initializes RegisterHandler with the given DB
-func NewRegisterHandler(db *gorm.DB) *RegisterHandler {
+// NewRegisterHandler initializes RegisterHandler with the given DB, refresh token store, role lookup and audit log
+func NewRegisterHandler(db *gorm.DB, refreshTokens *services.RefreshTokenService, access *services.AccessService, audit *services.AuditService) *RegisterHandler {
 	return &RegisterHandler{
-		db: db,
+		db:            db,
+		refreshTokens: refreshTokens,
+		access:        access,
+		audit:         audit,
 	}
 }
 
@@ -36,6 +41,8 @@ func (h *RegisterHandler) RegisterEmail(context *gin.Context) {
 		return
 	}
 
+	inputUser.Email = utils.CanonicalEmail(inputUser.Email)
+
 	// Validate email and password input
 	if err := utils.Validate(&inputUser); err != nil {
 		response := models.ErrorResponse{
@@ -67,7 +74,7 @@ func (h *RegisterHandler) RegisterEmail(context *gin.Context) {
 
 	// Check duplicate email
 	var existing models.User
-	if err := h.db.Where("LOWER(email) = ?", strings.ToLower(inputUser.Email)).First(&existing).Error; err == nil {
+	if err := h.db.Where("LOWER(email) = ?", inputUser.Email).First(&existing).Error; err == nil {
 		response := models.ErrorResponse{
 			Success: false,
 			Error:   "Email already registered",
@@ -88,21 +95,20 @@ func (h *RegisterHandler) RegisterEmail(context *gin.Context) {
 	}
 
 	// Generate JWT Token
-	token, err := middleware.GenerateToken(user)
-	if err != nil {
-		response := models.ErrorResponse{
-			Success: false,
-			Error:   "Internal server error",
-			Code:    http.StatusInternalServerError,
-		}
-		context.JSON(http.StatusInternalServerError, response)
+	tokens, errResponse := issueTokenPair(context, h.refreshTokens, h.access, user, resolveDeviceID(context, inputUser.DeviceID))
+	if errResponse != nil {
+		context.JSON(errResponse.Code, errResponse)
 		return
 	}
+	recordAudit(h.audit, context, models.AuditUserRegistered, &user.ID, map[string]any{"channel": models.ContactTypeEmail})
+	auditTokenIssued(h.audit, context, user.ID, tokens, "register")
 
 	context.JSON(http.StatusCreated, gin.H{
-		"email": user.Email,
-		"phone": "", // empty string if first registering
-		"token": token,
+		"email":        user.Email,
+		"phone":        "", // empty string if first registering
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"deviceId":     tokens.DeviceID,
 	})
 }
 
@@ -120,8 +126,9 @@ func (h *RegisterHandler) RegisterPhone(context *gin.Context) {
 		return
 	}
 
-	// Validate Phone Number
-	if err := utils.PhoneValidation(inputUser.Phone); err != nil {
+	// Validate Phone Number and store it in E.164 form
+	phone, validationErr := utils.NormalizePhone(inputUser.Phone)
+	if validationErr != nil {
 		response := models.ErrorResponse{
 			Success: false,
 			Error:   "Validation Error",
@@ -130,6 +137,7 @@ func (h *RegisterHandler) RegisterPhone(context *gin.Context) {
 		context.JSON(http.StatusBadRequest, response)
 		return
 	}
+	inputUser.Phone = phone
 
 	// Validate Password
 	if err := utils.PasswordValidation(inputUser.Password); err != nil {
@@ -180,20 +188,19 @@ func (h *RegisterHandler) RegisterPhone(context *gin.Context) {
 	}
 
 	// Generate JWT Token
-	token, err := middleware.GenerateToken(user)
-	if err != nil {
-		response := models.ErrorResponse{
-			Success: false,
-			Error:   "Internal server error",
-			Code:    http.StatusInternalServerError,
-		}
-		context.JSON(http.StatusInternalServerError, response)
+	tokens, errResponse := issueTokenPair(context, h.refreshTokens, h.access, user, resolveDeviceID(context, inputUser.DeviceID))
+	if errResponse != nil {
+		context.JSON(errResponse.Code, errResponse)
 		return
 	}
+	recordAudit(h.audit, context, models.AuditUserRegistered, &user.ID, map[string]any{"channel": models.ContactTypePhone})
+	auditTokenIssued(h.audit, context, user.ID, tokens, "register")
 
 	context.JSON(http.StatusCreated, gin.H{
-		"phone": user.Phone,
-		"email": "",
-		"token": token,
+		"phone":        user.Phone,
+		"email":        "",
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"deviceId":     tokens.DeviceID,
 	})
 }
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SessionHandler struct {
+	refreshTokens *services.RefreshTokenService
+	audit         *services.AuditService
+}
+
+func NewSessionHandler(refreshTokens *services.RefreshTokenService, audit *services.AuditService) *SessionHandler {
+	return &SessionHandler{
+		refreshTokens: refreshTokens,
+		audit:         audit,
+	}
+}
+
+// ListSessions returns the devices the user is logged in on (GET /v1/user/sessions)
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	sessions, err := h.refreshTokens.ListSessions(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	currentSessionID := c.GetString("session_id")
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, models.SessionResponse{
+			Session: session,
+			Current: session.ID == currentSessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession logs out one of the user's devices (DELETE /v1/user/sessions/:sessionId)
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+	userIDUint := userID.(uint)
+
+	sessionID := c.Param("sessionId")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid session ID",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.refreshTokens.RevokeSession(userIDUint, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "Session not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	recordAudit(h.audit, c, models.AuditSessionRevoked, &userIDUint, map[string]any{
+		"sessionId": sessionID,
+	})
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Session revoked",
+	})
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TwoFactorHandler struct {
+	db        *gorm.DB
+	twoFactor *services.TwoFactorService
+	reauth    *services.ReauthService
+	audit     *services.AuditService
+}
+
+func NewTwoFactorHandler(db *gorm.DB, twoFactor *services.TwoFactorService, reauth *services.ReauthService, audit *services.AuditService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		db:        db,
+		twoFactor: twoFactor,
+		reauth:    reauth,
+		audit:     audit,
+	}
+}
+
+// twoFactorError maps two-factor service errors to responses
+func twoFactorError(c *gin.Context, err error) {
+	var throttled *services.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		setRetryAfter(c, throttled.RetryAfter)
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Success: false,
+			Error:   "Two-factor authentication temporarily locked due to too many invalid codes",
+			Code:    http.StatusTooManyRequests,
+		})
+	case errors.Is(err, services.ErrTwoFactorCodeInvalid):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid two-factor code",
+			Code:    http.StatusBadRequest,
+		})
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Two-factor authentication is not enrolled",
+			Code:    http.StatusNotFound,
+		})
+	case errors.Is(err, services.ErrTwoFactorAlreadyActive):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Success: false,
+			Error:   "Two-factor authentication is already enabled",
+			Code:    http.StatusConflict,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+	}
+}
+
+// Enroll creates a TOTP secret to scan into an authenticator app (POST /v1/user/2fa/enroll)
+func (h *TwoFactorHandler) Enroll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	enrollment, err := h.twoFactor.Enroll(&user)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Activate turns on two-factor login after the first valid code (POST /v1/user/2fa/activate)
+func (h *TwoFactorHandler) Activate(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide the 6 digit code",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	userIDUint := userID.(uint)
+	codes, err := h.twoFactor.Activate(userIDUint, req.Code)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	recordAudit(h.audit, c, models.AuditTwoFactorEnabled, &userIDUint, nil)
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable turns off two-factor login, requiring a code and the password or a
+// reauthentication token (POST /v1/user/2fa/disable)
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide your password and the 6 digit code",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if !confirmPassword(c, h.reauth, &user, req.Password, req.ReauthToken, "Invalid password") {
+		return
+	}
+
+	if err := h.twoFactor.Disable(user.ID, req.Code); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	recordAudit(h.audit, c, models.AuditTwoFactorDisabled, &user.ID, nil)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code (POST /v1/user/2fa/recovery-codes)
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide the 6 digit code",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	userIDUint := userID.(uint)
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(userIDUint, req.Code)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	recordAudit(h.audit, c, models.AuditRecoveryCodesReplaced, &userIDUint, nil)
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
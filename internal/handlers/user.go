@@ -2,25 +2,48 @@ package handlers
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
+	"time"
 
 	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
 	"tutuplapak/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	db            *gorm.DB
+	verifications *services.VerificationService
+	refreshTokens *services.RefreshTokenService
+	reauth        *services.ReauthService
+	audit         *services.AuditService
 }
 
 // NewUserHandler creates a new user handler with dependency injection
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(db *gorm.DB, verifications *services.VerificationService, refreshTokens *services.RefreshTokenService, reauth *services.ReauthService, audit *services.AuditService) *UserHandler {
+	return &UserHandler{
+		db:            db,
+		verifications: verifications,
+		refreshTokens: refreshTokens,
+		reauth:        reauth,
+		audit:         audit,
+	}
+}
+
+func newUserResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		Email:             user.Email,
+		Phone:             user.Phone,
+		FileID:            user.FileID,
+		FileURI:           user.FileURI,
+		FileThumbnailURI:  user.FileThumbnailURI,
+		BankAccountName:   user.BankAccountName,
+		BankAccountHolder: user.BankAccountHolder,
+		BankAccountNumber: user.BankAccountNumber,
+	}
 }
 
 // GetUser returns current user profile (GET /v1/user)
@@ -56,21 +79,11 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	// Map to response model with only needed fields
-	userResponse := models.UserResponse{
-		Email:             user.Email,
-		Phone:             user.Phone,
-		FileID:            user.FileID,
-		FileURI:           user.FileURI,
-		FileThumbnailURI:  user.FileThumbnailURI,
-		BankAccountName:   user.BankAccountName,
-		BankAccountHolder: user.BankAccountHolder,
-		BankAccountNumber: user.BankAccountNumber,
-	}
-
-	c.JSON(http.StatusOK, userResponse)
+	c.JSON(http.StatusOK, newUserResponse(&user))
 }
 
+// LinkEmail sends a verification code to the email (POST /v1/user/link/email).
+// The email is only linked after VerifyLinkEmail succeeds.
 func (h *UserHandler) LinkEmail(c *gin.Context) {
 	var payload models.LinkEmailRequest
 
@@ -84,6 +97,7 @@ func (h *UserHandler) LinkEmail(c *gin.Context) {
 		return
 	}
 
+	payload.Email = utils.CanonicalEmail(payload.Email)
 	if err := utils.EmailValidation(payload.Email); err != nil {
 		response := models.ErrorResponse{
 			Success: false,
@@ -94,57 +108,12 @@ func (h *UserHandler) LinkEmail(c *gin.Context) {
 		return
 	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		fmt.Println("user_id not found in context")
-		return
-	}
-
-	var user models.User
-
-	if err := h.db.Model(&user).
-		Where("id = ?", userID).
-		Update("email", payload.Email).Error; err != nil {
-
-		var pgErr *pgconn.PgError
-
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			c.JSON(http.StatusConflict, models.ErrorResponse{
-				Success: false,
-				Error:   "Email already registered",
-				Code:    http.StatusConflict,
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   "Server Error",
-			Code:    http.StatusInternalServerError,
-		})
-		return
-	}
-
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   "Failed to fetch updated user",
-			Code:    http.StatusInternalServerError,
-		})
-		return
-	}
-
-	userResponse := models.UserResponse{
-		Email:             user.Email,
-		Phone:             user.Phone,
-		FileID:            user.FileID,
-		FileURI:           user.FileURI,
-		FileThumbnailURI:  user.FileThumbnailURI,
-		BankAccountName:   user.BankAccountName,
-		BankAccountHolder: user.BankAccountHolder,
-		BankAccountNumber: user.BankAccountNumber,
-	}
+	h.startContactVerification(c, models.ContactTypeEmail, "email", payload.Email, "Email already registered")
+}
 
-	c.JSON(http.StatusOK, userResponse)
+// VerifyLinkEmail links the email once the code is confirmed (POST /v1/user/link/email/verify)
+func (h *UserHandler) VerifyLinkEmail(c *gin.Context) {
+	h.completeContactVerification(c, models.ContactTypeEmail, "email", "Email already registered")
 }
 
 // UpdateUser updates user profile (PUT /v1/user)
@@ -213,6 +182,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		user.FileThumbnailURI = fileUpload.FileURI
 	}
 
+	previous := user
 	user.BankAccountName = req.BankAccountName
 	user.BankAccountHolder = req.BankAccountHolder
 	user.BankAccountNumber = req.BankAccountNumber
@@ -226,22 +196,65 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	userResponse := models.UserResponse{
-		Email:             user.Email,
-		Phone:             user.Phone,
-		FileID:            user.FileID,
-		FileURI:           user.FileURI,
-		FileThumbnailURI:  user.FileThumbnailURI,
-		BankAccountName:   user.BankAccountName,
-		BankAccountHolder: user.BankAccountHolder,
-		BankAccountNumber: user.BankAccountNumber,
+	if previous.BankAccountName != user.BankAccountName ||
+		previous.BankAccountHolder != user.BankAccountHolder ||
+		previous.BankAccountNumber != user.BankAccountNumber {
+		recordAudit(h.audit, c, models.AuditBankAccountChanged, &user.ID, map[string]any{
+			"previous": map[string]string{
+				"bankAccountName":   previous.BankAccountName,
+				"bankAccountHolder": previous.BankAccountHolder,
+				"bankAccountNumber": maskAccountNumber(previous.BankAccountNumber),
+			},
+			"current": map[string]string{
+				"bankAccountName":   user.BankAccountName,
+				"bankAccountHolder": user.BankAccountHolder,
+				"bankAccountNumber": maskAccountNumber(user.BankAccountNumber),
+			},
+		})
+	}
+	if previous.FileID != user.FileID {
+		recordAudit(h.audit, c, models.AuditProfileUpdated, &user.ID, map[string]any{
+			"fileId": user.FileID,
+		})
 	}
 
-	c.JSON(http.StatusOK, userResponse)
+	c.JSON(http.StatusOK, newUserResponse(&user))
 }
 
-// LinkPhone (POST /v1/user/link/phone)
+// LinkPhone sends a verification code to the phone (POST /v1/user/link/phone).
+// The phone is only linked after VerifyLinkPhone succeeds.
 func (h *UserHandler) LinkPhone(c *gin.Context) {
+	var req models.LinkPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Validation error",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	phone, validationErr := utils.NormalizePhone(req.Phone)
+	if validationErr != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid phone number format",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	req.Phone = phone
+
+	h.startContactVerification(c, models.ContactTypePhone, "phone", req.Phone, "Phone number already linked to another account")
+}
+
+// VerifyLinkPhone links the phone once the code is confirmed (POST /v1/user/link/phone/verify)
+func (h *UserHandler) VerifyLinkPhone(c *gin.Context) {
+	h.completeContactVerification(c, models.ContactTypePhone, "phone", "Phone number already linked to another account")
+}
+
+// startContactVerification rejects contacts owned by someone else, then sends a code to the target
+func (h *UserHandler) startContactVerification(c *gin.Context, channel models.ContactType, column, target, conflictMessage string) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
@@ -251,53 +264,210 @@ func (h *UserHandler) LinkPhone(c *gin.Context) {
 		})
 		return
 	}
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
 
-	var req models.LinkPhoneRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+	var owner models.User
+	if err := h.db.Where(column+" = ? AND id <> ?", target, userIDUint).First(&owner).Error; err == nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
 			Success: false,
-			Error:   "Validation error",
-			Code:    http.StatusBadRequest,
+			Error:   conflictMessage,
+			Code:    http.StatusConflict,
+		})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	verification, err := h.verifications.Start(c.Request.Context(), userIDUint, channel, target)
+	if err != nil {
+		var cooldown *services.CooldownError
+		if errors.As(err, &cooldown) {
+			setRetryAfter(c, cooldown.RetryAfter)
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Success: false,
+				Error:   "Verification code was sent recently, please wait before requesting another",
+				Code:    http.StatusTooManyRequests,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to send verification code",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	recordAudit(h.audit, c, models.AuditContactLinkRequested, &userIDUint, map[string]any{
+		"channel": channel,
+		"target":  target,
+	})
+
+	c.JSON(http.StatusAccepted, models.VerificationSentResponse{
+		Channel:     verification.Channel,
+		Target:      verification.Target,
+		ExpiresAt:   verification.ExpiresAt,
+		ResendAfter: verification.LastSentAt.Add(h.verifications.ResendCooldown()),
+	})
+}
+
+// completeContactVerification checks the code and writes the verified contact onto the user
+func (h *UserHandler) completeContactVerification(c *gin.Context, channel models.ContactType, column, conflictMessage string) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+			Code:    http.StatusUnauthorized,
 		})
 		return
 	}
 
-	if err := utils.PhoneValidation(req.Phone); err != nil {
+	var req models.VerifyContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Success: false,
-			Error:   "Invalid phone number format",
+			Error:   "Invalid input: please provide the 6 digit code",
 			Code:    http.StatusBadRequest,
 		})
 		return
 	}
 
+	target, err := h.verifications.Verify(userIDUint, channel, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrVerificationNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "No pending verification, please request a new code",
+				Code:    http.StatusNotFound,
+			})
+		case errors.Is(err, services.ErrVerificationExpired):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Verification code has expired, please request a new code",
+				Code:    http.StatusBadRequest,
+			})
+		case errors.Is(err, services.ErrInvalidCode):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "Invalid verification code",
+				Code:    http.StatusBadRequest,
+			})
+		case errors.Is(err, services.ErrTooManyAttempts):
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Success: false,
+				Error:   "Too many invalid attempts, please request a new code",
+				Code:    http.StatusTooManyRequests,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Server error",
+				Code:    http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	updates := map[string]any{column: target}
+	if channel == models.ContactTypeEmail {
+		updates["email_verified_at"] = time.Now()
+	}
+
 	var user models.User
-	if err := h.db.Model(&models.User{}).
-		Clauses(clause.Returning{}).
-		Where("id = ?", userID).
-		Update("phone", req.Phone).
-		Scan(&user).Error; err != nil {
+	if err := h.db.Model(&user).
+		Where("id = ?", userIDUint).
+		Updates(updates).Error; err != nil {
 
-		// Handle nomor sudah dipakai user lain
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
 			c.JSON(http.StatusConflict, models.ErrorResponse{
 				Success: false,
-				Error:   "Phone number already linked to another account",
+				Error:   conflictMessage,
 				Code:    http.StatusConflict,
 			})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
 
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Success: false,
-				Error:   "User not found",
-				Code:    http.StatusNotFound,
-			})
-			return
-		}
+	if err := h.db.First(&user, userIDUint).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to fetch updated user",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	recordAudit(h.audit, c, models.AuditContactLinked, &userIDUint, map[string]any{
+		"channel": channel,
+		"target":  target,
+	})
 
+	c.JSON(http.StatusOK, newUserResponse(&user))
+}
+
+// ChangePassword replaces the password after checking the current one, or a
+// reauthentication token for users without one, and logs out every other
+// session (PUT /v1/user/password)
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "Expired / invalid / missing request token",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+	userIDUint := userID.(uint)
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid input: please provide your current password or a reauthentication token, and the new password",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := utils.PasswordValidation(req.NewPassword); err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userIDUint).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   "Server error",
@@ -306,15 +476,57 @@ func (h *UserHandler) LinkPhone(c *gin.Context) {
 		return
 	}
 
-	userResponse := models.UserResponse{
-		Email:             user.Email,
-		Phone:             user.Phone,
-		FileID:            user.FileID,
-		FileURI:           user.FileURI,
-		FileThumbnailURI:  user.FileThumbnailURI,
-		BankAccountName:   user.BankAccountName,
-		BankAccountHolder: user.BankAccountHolder,
-		BankAccountNumber: user.BankAccountNumber,
+	if !confirmPassword(c, h.reauth, &user, req.CurrentPassword, req.ReauthToken, "Invalid current password") {
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "New password must be different from the current password",
+			Code:    http.StatusBadRequest,
+		})
+		return
 	}
-	c.JSON(http.StatusOK, userResponse)
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Internal server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if err := h.db.Model(&user).Update("password", hashedPassword).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Server error",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	revoked, err := h.refreshTokens.RevokeOtherSessions(userIDUint, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Password changed but other sessions could not be logged out",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	recordAudit(h.audit, c, models.AuditPasswordChanged, &userIDUint, map[string]any{
+		"revokedSessions": revoked,
+	})
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password changed, other sessions have been logged out",
+		Data: gin.H{
+			"revokedSessions": revoked,
+		},
+	})
 }
@@ -4,36 +4,44 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"strconv"
 	"time"
 	"tutuplapak/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// AccessTokenTTL is how long a signed access token stays valid
+const AccessTokenTTL = 30 * time.Minute
+
 // Generate Token for Login and Register
-func GenerateToken(user *models.User) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// log.Println("JWT_SECRET not set in environment")
-		return "", fmt.Errorf("JWT_SECRET not set")
+func GenerateToken(user *models.User, sessionID string, access models.Access) (string, error) {
+	if keyManager == nil || keyManager.Active() == nil {
+		return "", fmt.Errorf("no signing key configured")
 	}
+	key := keyManager.Active()
 
-	expTime := time.Now().Add(30 * time.Minute)
+	expTime := time.Now().Add(AccessTokenTTL)
 
 	claims := &models.JWTClaim{
-		ID:    user.ID,
-		Email: user.Email,
+		ID:          user.ID,
+		Email:       user.Email,
+		SessionID:   sessionID,
+		Roles:       access.Roles,
+		Permissions: access.Permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			ExpiresAt: jwt.NewNumericDate(expTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   string(rune(user.ID)),
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
 
-	signed, err := token.SignedString([]byte(secret))
+	signed, err := token.SignedString(key.Private)
 	if err != nil {
 		log.Println("Failed to sign JWT:", err)
 		return "", err
@@ -44,14 +52,23 @@ func GenerateToken(user *models.User) (string, error) {
 
 // Parse Token
 func ParseToken(tokenString string) (*models.JWTClaim, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return nil, fmt.Errorf("JWT_SECRET not set")
+	if keyManager == nil {
+		return nil, fmt.Errorf("no signing key configured")
 	}
 
 	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keyManager.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		// Never let the token pick a different algorithm than the key was made for
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.Public, nil
+	}, jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA, AlgorithmHS256}))
 
 	if err != nil {
 		return nil, err
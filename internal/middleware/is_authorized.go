@@ -1,17 +1,44 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"tutuplapak/internal/models"
+	"tutuplapak/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Authorization
-func IsAuthorized() gin.HandlerFunc {
+// apiKeyHeader is an alternative to sending an API key as a bearer token
+const apiKeyHeader = "X-API-Key"
+
+// Authenticator validates bearer tokens against the signing key and the revocation list
+type Authenticator struct {
+	revocations *services.RevocationService
+	apiKeys     *services.APIKeyService
+	sessions    *services.RefreshTokenService
+}
+
+func NewAuthenticator(revocations *services.RevocationService, apiKeys *services.APIKeyService, sessions *services.RefreshTokenService) *Authenticator {
+	return &Authenticator{
+		revocations: revocations,
+		apiKeys:     apiKeys,
+		sessions:    sessions,
+	}
+}
+
+// Authorization. API keys are only accepted when the route lists the scopes
+// it needs and the key holds all of them; access tokens are accepted everywhere.
+func (a *Authenticator) IsAuthorized(scopes ...string) gin.HandlerFunc {
 	return func(context *gin.Context) {
 
+		if apiKey := context.GetHeader(apiKeyHeader); apiKey != "" {
+			a.authorizeAPIKey(context, apiKey, scopes)
+			return
+		}
+
 		// Check for authorization header
 		authHeader := context.GetHeader("Authorization")
 		if authHeader == "" {
@@ -31,9 +58,14 @@ func IsAuthorized() gin.HandlerFunc {
 			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 
+		if services.IsAPIKey(tokenString) {
+			a.authorizeAPIKey(context, tokenString, scopes)
+			return
+		}
+
 		// Parse and validate JWT
 		claims, err := ParseToken(tokenString)
-		if err != nil {
+		if err != nil || claims.ExpiresAt == nil || a.revocations.IsRevoked(claims) {
 			response := models.ErrorResponse{
 				Success: false,
 				Error:   "Invalid or expired token",
@@ -47,7 +79,58 @@ func IsAuthorized() gin.HandlerFunc {
 		// Store user info
 		context.Set("user_id", claims.ID)
 		context.Set("email", claims.Email)
+		context.Set("session_id", claims.SessionID)
+		context.Set("jti", claims.TokenID())
+		context.Set("token_expires_at", claims.ExpiresAt.Time)
+		context.Set("roles", claims.Roles)
+		context.Set("permissions", claims.Permissions)
+
+		if claims.SessionID != "" {
+			if err := a.sessions.Touch(claims.SessionID, context.ClientIP()); err != nil {
+				log.Printf("Failed to update session last seen: %v", err)
+			}
+		}
 
 		context.Next()
 	}
 }
+
+// authorizeAPIKey authenticates a request made with an API key
+func (a *Authenticator) authorizeAPIKey(context *gin.Context, rawKey string, scopes []string) {
+	key, err := a.apiKeys.Authenticate(rawKey)
+	if err != nil {
+		status, message := http.StatusUnauthorized, "Invalid, expired or revoked API key"
+		if !errors.Is(err, services.ErrAPIKeyInvalid) {
+			status, message = http.StatusInternalServerError, "Server error"
+		}
+		context.JSON(status, models.ErrorResponse{
+			Success: false,
+			Error:   message,
+			Code:    status,
+		})
+		context.Abort()
+		return
+	}
+
+	allowed := len(scopes) > 0
+	for _, scope := range scopes {
+		if !key.HasScope(scope) {
+			allowed = false
+		}
+	}
+	if !allowed {
+		context.JSON(http.StatusForbidden, models.ErrorResponse{
+			Success: false,
+			Error:   "API key does not have the scope required for this endpoint",
+			Code:    http.StatusForbidden,
+		})
+		context.Abort()
+		return
+	}
+
+	context.Set("user_id", key.UserID)
+	context.Set("api_key_id", key.ID)
+	context.Set("scopes", key.Scopes)
+
+	context.Next()
+}
@@ -0,0 +1,408 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tutuplapak/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmHS256 = "HS256"
+
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+	rsaKeyBits       = 2048
+)
+
+// SigningKey is a key used to sign or verify access tokens.
+// Verification-only keys have no private part.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.PrivateKey
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// JWK is the public representation of a signing key (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyManager holds every key accepted for verification and the one used for signing.
+// Asymmetric keys are PKCS#8 PEM files in a directory; public-only PKIX files are
+// loaded as verification keys so tokens from other issuers or old keys still validate.
+type KeyManager struct {
+	cfg config.SigningConfig
+
+	mu     sync.RWMutex
+	keys   map[string]*SigningKey
+	active *SigningKey
+}
+
+// errNoSigningKey means the keys directory holds no private key to sign with
+var errNoSigningKey = errors.New("no signing key")
+
+// keyManager is the key set used by GenerateToken and ParseToken
+var keyManager *KeyManager
+
+// UseKeys installs the key manager used to sign and verify access tokens
+func UseKeys(km *KeyManager) {
+	keyManager = km
+}
+
+func NewKeyManager(cfg config.SigningConfig, secret string) (*KeyManager, error) {
+	km := &KeyManager{
+		cfg:  cfg,
+		keys: make(map[string]*SigningKey),
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmHS256:
+		if secret == "" {
+			return nil, fmt.Errorf("JWT_SECRET not set")
+		}
+		key := &SigningKey{ID: "hs256", Algorithm: AlgorithmHS256, Private: []byte(secret), Public: []byte(secret), CreatedAt: time.Now()}
+		km.keys[key.ID] = key
+		km.active = key
+		return km, nil
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+
+	// Replicas that generated their own keys could not verify each other's tokens,
+	// so keys are only created when a single instance asks for it
+	if !cfg.GenerateKeys {
+		if err := km.Reload(); err != nil {
+			return nil, fmt.Errorf("%w; mount the signing keys from a secret into JWT_KEYS_DIR, "+
+				"set JWT_KEYS_GENERATE=true for a single local instance or use HS256", err)
+		}
+		return km, nil
+	}
+
+	if cfg.ActiveKeyID != "" {
+		return nil, errors.New("JWT_ACTIVE_KEY_ID cannot be combined with JWT_KEYS_GENERATE")
+	}
+	if err := os.MkdirAll(cfg.KeysDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create keys directory: %w", err)
+	}
+
+	// First start: generate a key so the service can sign right away
+	if err := km.Reload(); errors.Is(err, errNoSigningKey) {
+		if _, err := km.Rotate(); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return km, nil
+}
+
+// Active returns the current signing key
+func (km *KeyManager) Active() *SigningKey {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.active
+}
+
+// Key returns the verification key with the given id
+func (km *KeyManager) Key(kid string) (*SigningKey, bool) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	key, ok := km.keys[kid]
+	return key, ok
+}
+
+// Reload reads every key from the keys directory. The key named by
+// ActiveKeyID, or else the newest private key matching the configured
+// algorithm, becomes the signing key. Without one the current keys are kept.
+func (km *KeyManager) Reload() error {
+	if km.cfg.Algorithm == AlgorithmHS256 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(km.cfg.KeysDir)
+	if err != nil {
+		return fmt.Errorf("failed to read keys directory: %w", err)
+	}
+
+	keys := make(map[string]*SigningKey)
+	var active *SigningKey
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), privateKeySuffix) {
+			continue
+		}
+
+		key, err := loadKeyFile(filepath.Join(km.cfg.KeysDir, entry.Name()))
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", entry.Name(), err)
+			continue
+		}
+		if existing, ok := keys[key.ID]; ok && existing.Private != nil {
+			continue
+		}
+		keys[key.ID] = key
+
+		if key.Private == nil || key.Algorithm != km.cfg.Algorithm {
+			continue
+		}
+		if km.cfg.ActiveKeyID != "" {
+			if key.ID == km.cfg.ActiveKeyID {
+				active = key
+			}
+		} else if active == nil || key.CreatedAt.After(active.CreatedAt) {
+			active = key
+		}
+	}
+
+	if active == nil {
+		if km.cfg.ActiveKeyID != "" {
+			return fmt.Errorf("%w: no %s private key %q in %s", errNoSigningKey, km.cfg.Algorithm, km.cfg.ActiveKeyID, km.cfg.KeysDir)
+		}
+		return fmt.Errorf("%w: no %s private key in %s", errNoSigningKey, km.cfg.Algorithm, km.cfg.KeysDir)
+	}
+
+	km.mu.Lock()
+	km.keys = keys
+	km.active = active
+	km.mu.Unlock()
+	return nil
+}
+
+// Rotate generates a new signing key, writes it to disk and makes it active.
+// Older keys stay available for verification until they are pruned.
+func (km *KeyManager) Rotate() (*SigningKey, error) {
+	now := time.Now().UTC()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	kid := now.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+
+	var (
+		private crypto.PrivateKey
+		public  crypto.PublicKey
+	)
+	switch km.cfg.Algorithm {
+	case AlgorithmRS256:
+		rsaKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private, public = rsaKey, &rsaKey.PublicKey
+	case AlgorithmEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private, public = priv, pub
+	default:
+		return nil, fmt.Errorf("key rotation is not supported for %s", km.cfg.Algorithm)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(km.cfg.KeysDir, kid+privateKeySuffix)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+
+	key := &SigningKey{ID: kid, Algorithm: km.cfg.Algorithm, Private: private, Public: public, CreatedAt: now}
+
+	km.mu.Lock()
+	km.keys[kid] = key
+	km.active = key
+	km.mu.Unlock()
+
+	log.Printf("Rotated JWT signing key, new kid %s", kid)
+	return key, nil
+}
+
+// Start reloads the keys directory every check interval so keys added to a
+// mounted secret are picked up. With GenerateKeys it also rotates the signing
+// key once it is older than the rotation interval and prunes retired keys.
+func (km *KeyManager) Start(ctx context.Context) {
+	if km.cfg.Algorithm == AlgorithmHS256 {
+		return
+	}
+	rotate := km.cfg.GenerateKeys && km.cfg.RotationInterval > 0
+
+	go func() {
+		ticker := time.NewTicker(km.cfg.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := km.Reload(); err != nil {
+					log.Printf("Failed to reload signing keys: %v", err)
+					continue
+				}
+				if !rotate {
+					continue
+				}
+				if time.Since(km.Active().CreatedAt) >= km.cfg.RotationInterval {
+					if _, err := km.Rotate(); err != nil {
+						log.Printf("Failed to rotate signing key: %v", err)
+					}
+				}
+				km.prune()
+			}
+		}
+	}()
+}
+
+// prune deletes generated keys that have been retired for longer than the retention period
+func (km *KeyManager) prune() {
+	cutoff := time.Now().Add(-(km.cfg.RotationInterval + km.cfg.Retention))
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	for kid, key := range km.keys {
+		if key == km.active || key.Private == nil || key.CreatedAt.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(km.cfg.KeysDir, kid+privateKeySuffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove retired signing key %s: %v", kid, err)
+			continue
+		}
+		delete(km.keys, kid)
+	}
+}
+
+// JWKS returns the public verification keys. Symmetric keys are never published.
+func (km *KeyManager) JWKS() JWKSet {
+	km.mu.RLock()
+	keys := make([]*SigningKey, 0, len(km.keys))
+	for _, key := range km.keys {
+		keys = append(keys, key)
+	}
+	km.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range keys {
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: AlgorithmRS256,
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: AlgorithmEdDSA,
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	return set
+}
+
+// loadKeyFile parses a PKCS#8 private key or, for *.pub.pem files, a PKIX public key.
+// The file name without its suffix is the key id.
+func loadKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	name := filepath.Base(path)
+	key := &SigningKey{CreatedAt: info.ModTime()}
+
+	if strings.HasSuffix(name, publicKeySuffix) {
+		key.ID = strings.TrimSuffix(name, publicKeySuffix)
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = pub
+	} else {
+		key.ID = strings.TrimSuffix(name, privateKeySuffix)
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = priv
+		key.Public = priv.(crypto.Signer).Public()
+	}
+
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = AlgorithmRS256
+	case ed25519.PublicKey:
+		key.Algorithm = AlgorithmEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.Public)
+	}
+
+	return key, nil
+}
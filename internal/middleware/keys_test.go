@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tutuplapak/internal/config"
+)
+
+func writeEdDSAKey(t *testing.T, dir, kid string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+privateKeySuffix), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewKeyManagerRefusesToStartWithoutKeys(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewKeyManager(config.SigningConfig{Algorithm: AlgorithmEdDSA, KeysDir: dir}, "")
+	if !errors.Is(err, errNoSigningKey) {
+		t.Fatalf("expected errNoSigningKey, got %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no generated keys, found %d files", len(entries))
+	}
+}
+
+func TestNewKeyManagerGeneratesKeysWhenAllowed(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	km, err := NewKeyManager(config.SigningConfig{Algorithm: AlgorithmEdDSA, KeysDir: dir, GenerateKeys: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if km.Active() == nil || km.Active().Private == nil {
+		t.Fatal("expected a generated signing key")
+	}
+
+	// A second instance sharing the directory signs with the same key
+	other, err := NewKeyManager(config.SigningConfig{Algorithm: AlgorithmEdDSA, KeysDir: dir}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Active().ID != km.Active().ID {
+		t.Fatalf("expected kid %s, got %s", km.Active().ID, other.Active().ID)
+	}
+}
+
+func TestNewKeyManagerUsesActiveKeyID(t *testing.T) {
+	dir := t.TempDir()
+	writeEdDSAKey(t, dir, "old")
+	writeEdDSAKey(t, dir, "new")
+
+	km, err := NewKeyManager(config.SigningConfig{Algorithm: AlgorithmEdDSA, KeysDir: dir, ActiveKeyID: "old"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if km.Active().ID != "old" {
+		t.Fatalf("expected kid old, got %s", km.Active().ID)
+	}
+	if _, ok := km.Key("new"); !ok {
+		t.Fatal("expected the other key to verify tokens")
+	}
+	if len(km.JWKS().Keys) != 2 {
+		t.Fatalf("expected 2 published keys, got %d", len(km.JWKS().Keys))
+	}
+
+	if _, err := NewKeyManager(config.SigningConfig{Algorithm: AlgorithmEdDSA, KeysDir: dir, ActiveKeyID: "missing"}, ""); !errors.Is(err, errNoSigningKey) {
+		t.Fatalf("expected errNoSigningKey for a missing active key, got %v", err)
+	}
+}
+
+func TestReloadKeepsKeysWhenSigningKeyDisappears(t *testing.T) {
+	dir := t.TempDir()
+	writeEdDSAKey(t, dir, "current")
+
+	km, err := NewKeyManager(config.SigningConfig{Algorithm: AlgorithmEdDSA, KeysDir: dir}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "current"+privateKeySuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := km.Reload(); !errors.Is(err, errNoSigningKey) {
+		t.Fatalf("expected errNoSigningKey, got %v", err)
+	}
+	if km.Active() == nil || km.Active().ID != "current" {
+		t.Fatal("expected the previous signing key to stay active")
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"tutuplapak/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission rejects requests whose token lacks any of the given permissions.
+// It must run after IsAuthorized.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		granted := make(map[string]bool)
+		for _, permission := range context.GetStringSlice("permissions") {
+			granted[permission] = true
+		}
+
+		for _, permission := range permissions {
+			if !granted[permission] {
+				context.JSON(http.StatusForbidden, models.ErrorResponse{
+					Success: false,
+					Error:   "You do not have permission to perform this action",
+					Code:    http.StatusForbidden,
+				})
+				context.Abort()
+				return
+			}
+		}
+
+		context.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// FileDeletion is a scheduled removal of an uploaded file and its thumbnail from object storage
+type FileDeletion struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	FileID    string     `json:"-" gorm:"uniqueIndex;not null"`
+	UserID    *uint      `json:"-" gorm:"index"`
+	RunAfter  time.Time  `json:"-" gorm:"index;not null"`
+	Attempts  int        `json:"-" gorm:"not null;default:0"`
+	LastError string     `json:"-" gorm:"type:text"`
+	DoneAt    *time.Time `json:"-" gorm:"index"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// DeleteAccountRequest confirms the deletion with the password, or with a
+// reauthToken from a fresh identity provider login for users without one
+type DeleteAccountRequest struct {
+	Password    string `json:"password" binding:"required_without=ReauthToken"`
+	ReauthToken string `json:"reauthToken"`
+}
+
+// AccountExport is the personal data archive returned by GET /v1/user/export
+type AccountExport struct {
+	ExportedAt time.Time             `json:"exportedAt"`
+	Profile    AccountExportProfile  `json:"profile"`
+	Products   []Product             `json:"products"`
+	Files      []FileUpload          `json:"files"`
+	Purchases  AccountExportPurchase `json:"purchases"`
+}
+
+type AccountExportProfile struct {
+	ID                uint      `json:"id"`
+	Name              string    `json:"name"`
+	Email             string    `json:"email"`
+	Phone             string    `json:"phone"`
+	FileID            string    `json:"fileId"`
+	FileURI           string    `json:"fileUri"`
+	BankAccountName   string    `json:"bankAccountName"`
+	BankAccountHolder string    `json:"bankAccountHolder"`
+	BankAccountNumber string    `json:"bankAccountNumber"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// AccountExportPurchase splits purchases into orders placed with the user's
+// contact details and orders for the user's products
+type AccountExportPurchase struct {
+	AsBuyer  []Purchase `json:"asBuyer"`
+	AsSeller []Purchase `json:"asSeller"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Scopes an API key can be granted
+const (
+	ScopeProductWrite  = "product:write"
+	ScopePurchaseRead  = "purchase:read"
+	ScopePurchaseWrite = "purchase:write"
+)
+
+// APIKey is a long-lived credential a user mints for integrations.
+// Only the SHA-256 hash of the key is stored; the prefix identifies it in listings and logs.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"type:varchar(64);not null"`
+	Prefix     string     `json:"prefix" gorm:"type:varchar(32);uniqueIndex;not null"`
+	KeyHash    string     `json:"-" gorm:"type:char(64);not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json;type:text;not null"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// HasScope reports whether the key was granted the scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,min=1,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=product:write purchase:read purchase:write"`
+	ExpiresAt *time.Time `json:"expiresAt" binding:"omitempty"`
+}
+
+// CreateAPIKeyResponse carries the raw key, which is shown only once
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Audit event types
+const (
+	AuditLoginSucceeded        = "login.succeeded"
+	AuditLoginFailed           = "login.failed"
+	AuditLoginTwoFactorFailed  = "login.two_factor_failed"
+	AuditUserRegistered        = "user.registered"
+	AuditTokenIssued           = "token.issued"
+	AuditTokenRefreshed        = "token.refreshed"
+	AuditLogout                = "session.logout"
+	AuditLogoutAll             = "session.logout_all"
+	AuditSessionRevoked        = "session.revoked"
+	AuditContactLinkRequested  = "contact.link_requested"
+	AuditContactLinked         = "contact.linked"
+	AuditIdentityLinked        = "identity.linked"
+	AuditReauthenticated       = "identity.reauthenticated"
+	AuditProfileUpdated        = "profile.updated"
+	AuditBankAccountChanged    = "profile.bank_account_changed"
+	AuditPasswordChanged       = "password.changed"
+	AuditTwoFactorEnabled      = "two_factor.enabled"
+	AuditTwoFactorDisabled     = "two_factor.disabled"
+	AuditRecoveryCodesReplaced = "two_factor.recovery_codes_replaced"
+	AuditAccountExported       = "account.exported"
+	AuditAccountDeleted        = "account.deleted"
+)
+
+// AuditPersonalPayloadKeys are the payload entries holding contact details.
+// They are removed, together with the IP and user agent, when the account is
+// deleted; the database refuses any other change to an event.
+var AuditPersonalPayloadKeys = []string{"identifier", "target"}
+
+// AuditEvent is an append-only record of a security relevant action.
+// UserID is the account the event concerns, ActorID the authenticated caller, if any.
+type AuditEvent struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UserID    *uint          `json:"-" gorm:"index:idx_audit_events_user_created"`
+	ActorID   *uint          `json:"actorId"`
+	Type      string         `json:"type" gorm:"type:varchar(64);index;not null"`
+	IP        string         `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent string         `json:"userAgent" gorm:"type:text"`
+	Payload   map[string]any `json:"payload" gorm:"serializer:json;type:jsonb"`
+	CreatedAt time.Time      `json:"createdAt" gorm:"index:idx_audit_events_user_created"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Category is a product category. Categories form a tree through ParentID;
+// products may be filed under any level.
+type Category struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	ParentID  *uint      `json:"parentId" gorm:"index"`
+	Slug      string     `json:"slug" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Name      string     `json:"name" gorm:"type:varchar(64);not null"`
+	SortOrder int        `json:"sortOrder" gorm:"not null;default:0"`
+	Children  []Category `json:"children,omitempty" gorm:"-"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+
+	// Attributes are the product attributes of this category; subcategories
+	// also get the attributes of their ancestors
+	Attributes []AttributeDefinition `json:"attributes" gorm:"serializer:json;type:jsonb"`
+}
+
+// CategoryInput creates or replaces a category; the slug is derived from the
+// name when left empty
+type CategoryInput struct {
+	ParentID   *uint                 `json:"parentId"`
+	Slug       string                `json:"slug" binding:"omitempty,max=64"`
+	Name       string                `json:"name" binding:"required,min=1,max=64"`
+	SortOrder  int                   `json:"sortOrder"`
+	Attributes []AttributeDefinition `json:"attributes" binding:"omitempty,max=30,dive"`
+}
+
+// Attribute value types
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+	AttributeDate    = "date"
+)
+
+// AttributeDefinition describes one typed product attribute, such as the
+// expiry date of food or the brand of clothes
+type AttributeDefinition struct {
+	Key      string `json:"key" binding:"required,max=32"`
+	Label    string `json:"label" binding:"required,max=64"`
+	Type     string `json:"type" binding:"required,oneof=string number boolean enum date"`
+	Required bool   `json:"required"`
+	// Options are the allowed values of an enum
+	Options []string `json:"options,omitempty" binding:"omitempty,max=50,dive,required,max=64"`
+	// Min and Max bound numbers; MaxLength bounds strings and defaults to 255
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	MaxLength int      `json:"maxLength,omitempty" binding:"omitempty,min=1,max=1000"`
+	Unit      string   `json:"unit,omitempty" binding:"omitempty,max=16"`
+}
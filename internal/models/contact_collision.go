@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ContactCollision records users whose email or phone become identical once
+// canonicalized. Their rows are left untouched until an operator merges or fixes them.
+type ContactCollision struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	Channel    ContactType `json:"channel" gorm:"type:varchar(10);uniqueIndex:idx_contact_collision;not null"`
+	Canonical  string      `json:"canonical" gorm:"uniqueIndex:idx_contact_collision;not null"`
+	UserIDs    []uint      `json:"userIds" gorm:"serializer:json;type:text;not null"`
+	DetectedAt time.Time   `json:"detectedAt"`
+	ResolvedAt *time.Time  `json:"resolvedAt"`
+}
@@ -14,6 +14,10 @@ const (
 	Tools     ProductCategory = "Tools"
 )
 
+// DefaultCategories are created on first start and used to map the category
+// strings stored before categories moved into their own table
+var DefaultCategories = []ProductCategory{Food, Beverage, Clothes, Furniture, Tools}
+
 type ContactType string
 
 const (
@@ -25,22 +29,34 @@ const (
 type LoginEmailInput struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8,max=32"`
+	DeviceID string `json:"deviceId" binding:"omitempty,max=64"`
 }
 
 type PhoneUser struct {
 	Phone    string `json:"phone" binding:"required"`
 	Password string `json:"password" binding:"required,min=8,max=32"`
+	DeviceID string `json:"deviceId" binding:"omitempty,max=64"`
 }
 
 type LoginPhoneInput struct {
 	Phone    string `json:"phone" binding:"required"`
 	Password string `json:"password" binding:"required,min=8,max=32"`
+	DeviceID string `json:"deviceId" binding:"omitempty,max=64"`
+}
+
+// LoginInput is used by POST /v1/login; the identifier is an email or a phone number
+type LoginInput struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Password   string `json:"password" binding:"required,min=8,max=32"`
+	DeviceID   string `json:"deviceId" binding:"omitempty,max=64"`
 }
 
 type LoginPhoneOutput struct {
-	Phone string `json:"phone"`
-	Email string `json:"email"`
-	Token string `json:"token"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	DeviceID     string `json:"deviceId"`
 }
 
 type LinkPhoneRequest struct {
@@ -53,40 +69,112 @@ type LinkEmailRequest struct {
 
 type ProductInput struct {
 	Name     string          `json:"name" binding:"required,min=4,max=32"`
-	Category ProductCategory `json:"category" binding:"required,oneof=Food Beverage Clothes Furniture Tools"` // Validate both at compile time and runtime
-	Qty      uint            `json:"qty" binding:"required,min=1"`
-	Price    uint            `json:"price" binding:"required,min=100"`
+	Category ProductCategory `json:"category" binding:"required,max=64"` // A category slug or name, checked against the categories table
+	Qty      uint            `json:"qty" binding:"required_without=Variants,omitempty,min=1"`
+	Price    uint            `json:"price" binding:"required_without=Variants,omitempty,min=100"`
 	SKU      string          `json:"sku" binding:"required,max=32"`
-	FileID   string            `json:"fileId" binding:"required,min=1"`
+	FileID   string          `json:"fileId" binding:"required,min=1"`
+
+	// Options and Variants describe a product sold in several variants, such as
+	// sizes; qty and price may then be left out and are taken from the variants
+	Options  []ProductOption       `json:"options" binding:"omitempty,max=3,dive"`
+	Variants []ProductVariantInput `json:"variants" binding:"omitempty,max=100,dive"`
+	// FileIDs is the image gallery in display order; fileId is its cover and is added if missing
+	FileIDs []string `json:"fileIds" binding:"omitempty,dive,required"`
+	// Description is Markdown; Attributes are checked against the category's attribute schema
+	Description string         `json:"description" binding:"omitempty,max=5000"`
+	Attributes  map[string]any `json:"attributes"`
 }
 
 type ProductOutput struct {
 	ProductID        string    `json:"productId"`
 	Name             string    `json:"name"`
 	Category         string    `json:"category"`
+	CategoryID       uint      `json:"categoryId"`
 	Quantity         uint      `json:"quantity"`
 	Price            uint      `json:"price"`
 	SKU              string    `json:"sku"`
-	FileID           string      `json:"fileId"`
+	FileID           string    `json:"fileId"`
 	FileURI          string    `json:"fileUri"`
 	FileThumbnailURI string    `json:"fileThumbnailUri"`
 	CreatedAt        time.Time `json:"createdAt"`
 	UpdatedAt        time.Time `json:"updatedAt"`
+	// Highlight is the product name with search matches wrapped in <mark>, only set for q searches
+	Highlight string `json:"highlight,omitempty"`
+
+	Options  []ProductOption  `json:"options,omitempty"`
+	Variants []ProductVariant `json:"variants,omitempty"`
+	Images   []ProductImage   `json:"images"`
+
+	Description     string         `json:"description"`
+	DescriptionHTML string         `json:"descriptionHtml"`
+	Attributes      map[string]any `json:"attributes"`
+
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	DeletedAt  *time.Time `json:"deletedAt,omitempty"`
 }
 
 type ProductQueryParams struct {
-	Limit     int             `form:"limit" binding:"omitempty,min=1,max=100"`
-	Offset    int             `form:"offset" binding:"omitempty,min=0"`
-	ProductID string          `form:"productId" binding:"omitempty"`
-	SKU       string          `form:"sku" binding:"omitempty"`
-	Category  ProductCategory `form:"category" binding:"omitempty,oneof=Food Beverage Clothes Furniture Tools"`
-	SortBy    string          `form:"sortBy" binding:"omitempty,oneof=newest oldest cheapest expensive"`
+	Limit     int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset    int    `form:"offset" binding:"omitempty,min=0"`
+	ProductID string `form:"productId" binding:"omitempty"`
+	SKU       string `form:"sku" binding:"omitempty"`
+	// Category may be repeated or comma separated to match any of several categories
+	Category []string `form:"category" binding:"omitempty,max=10"`
+	SortBy   string   `form:"sortBy" binding:"omitempty,oneof=newest oldest cheapest expensive relevance"`
+	Query    string   `form:"q" binding:"omitempty,max=100"`
+	// Cursor switches to keyset pagination; offset is ignored when it is set
+	Cursor   string `form:"cursor" binding:"omitempty,max=512"`
+	MinPrice *uint  `form:"minPrice"`
+	MaxPrice *uint  `form:"maxPrice"`
+	SellerID string `form:"sellerId" binding:"omitempty"`
+	InStock  *bool  `form:"inStock"`
+	// CreatedAfter and CreatedBefore take RFC 3339 timestamps or YYYY-MM-DD dates
+	CreatedAfter  string `form:"createdAfter" binding:"omitempty"`
+	CreatedBefore string `form:"createdBefore" binding:"omitempty"`
+
+	// Attribute filters come from attr[key]=a,b, attrMin[key]=n and attrMax[key]=n
+	Attributes    map[string]string `form:"-"`
+	AttributesMin map[string]string `form:"-"`
+	AttributesMax map[string]string `form:"-"`
+}
+
+// ArchivedProductQueryParams pages through the caller's archived or deleted products
+type ArchivedProductQueryParams struct {
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset int    `form:"offset" binding:"omitempty,min=0"`
+	Status string `form:"status" binding:"omitempty,oneof=archived deleted"`
 }
 
 type ProductListResponse struct {
 	Success bool            `json:"success"`
 	Data    []ProductOutput `json:"data"`
-	Total   int64           `json:"total"`
-	Limit   int             `json:"limit"`
-	Offset  int             `json:"offset"`
+	// Total is only counted in offset mode
+	Total      *int64 `json:"total,omitempty"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+	// Facets are only computed in offset mode
+	Facets *ProductFacets `json:"facets,omitempty"`
+}
+
+// ProductFacets count the matching products per category and price bucket.
+// Each facet ignores its own filter, so the counts show what selecting
+// another category or price range would return.
+type ProductFacets struct {
+	Categories   []CategoryFacet    `json:"categories"`
+	PriceBuckets []PriceBucketFacet `json:"priceBuckets"`
+}
+
+type CategoryFacet struct {
+	Category string `json:"category"`
+	Count    int64  `json:"count"`
+}
+
+// PriceBucketFacet covers prices from Min to Max inclusive; Max is null for the last bucket
+type PriceBucketFacet struct {
+	Min   uint  `json:"min"`
+	Max   *uint `json:"max"`
+	Count int64 `json:"count"`
 }
@@ -3,8 +3,17 @@ package models
 import "github.com/golang-jwt/jwt/v5"
 
 // JWT Payload
+// The token id (jti) is carried by RegisteredClaims.ID
 type JWTClaim struct {
-	ID    uint   `json:"id"`
-	Email string `json:"email"`
+	ID          uint     `json:"id"`
+	Email       string   `json:"email"`
+	SessionID   string   `json:"sid,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// TokenID returns the jti claim, which is shadowed by the user ID field
+func (c *JWTClaim) TokenID() string {
+	return c.RegisteredClaims.ID
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// LoginAttempt is an audit record of a single login attempt
+type LoginAttempt struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	Identifier string    `json:"identifier" gorm:"type:varchar(255);index;not null"`
+	UserID     *uint     `json:"-" gorm:"index"`
+	IP         string    `json:"ip" gorm:"type:varchar(64);index:idx_login_attempts_ip_created;not null"`
+	UserAgent  string    `json:"userAgent" gorm:"type:text"`
+	Success    bool      `json:"success" gorm:"not null"`
+	Reason     string    `json:"reason" gorm:"type:varchar(32)"`
+	CreatedAt  time.Time `json:"createdAt" gorm:"index:idx_login_attempts_ip_created"`
+}
+
+// LoginThrottle tracks consecutive failed logins for one account identifier
+type LoginThrottle struct {
+	Identifier   string `gorm:"primaryKey;type:varchar(255)"`
+	FailedCount  int    `gorm:"not null;default:0"`
+	LockedUntil  *time.Time
+	LastFailedAt *time.Time
+	UpdatedAt    time.Time
+}
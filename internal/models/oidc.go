@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// OIDCIdentity links an account at an external identity provider to a user
+type OIDCIdentity struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"-" gorm:"index;not null"`
+	Provider    string    `json:"provider" gorm:"type:varchar(64);not null;uniqueIndex:idx_oidc_identities_provider_subject"`
+	Subject     string    `json:"-" gorm:"type:varchar(255);not null;uniqueIndex:idx_oidc_identities_provider_subject"`
+	Email       string    `json:"email"`
+	LastLoginAt time.Time `json:"lastLoginAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// OIDCLoginState remembers a started authorization request until the provider
+// redirects back. The state is stored hashed; the PKCE verifier and nonce
+// never leave the server. LinkUserID is the logged in user of a link or, with
+// Reauth, of a reauthentication.
+type OIDCLoginState struct {
+	ID           uint      `json:"-" gorm:"primaryKey"`
+	StateHash    string    `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Provider     string    `json:"-" gorm:"type:varchar(64);not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"`
+	Nonce        string    `json:"-" gorm:"not null"`
+	DeviceID     string    `json:"-" gorm:"type:varchar(64)"`
+	LinkUserID   *uint     `json:"-"`
+	Reauth       bool      `json:"-" gorm:"not null;default:false"`
+	ExpiresAt    time.Time `json:"-" gorm:"index;not null"`
+	CreatedAt    time.Time `json:"-"`
+}
+
+// ReauthToken is a single-use proof that a user just logged in again at an
+// identity provider. It replaces the password on sensitive requests of users
+// who never had one.
+type ReauthToken struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	UserID    uint       `json:"-" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// OIDCClaims are the ID token claims used to find or create the user
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string    `json:"authorizationUrl"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+}
+
+type ReauthResponse struct {
+	ReauthToken string    `json:"reauthToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type OIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use token allowing a user to choose a new password.
+// Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	UserID    uint       `json:"-" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// PasswordResetAttempt records a reset request for rate limiting, whether or
+// not an account uses the contact. Only the SHA-256 hash of the contact is stored.
+type PasswordResetAttempt struct {
+	ID          uint      `gorm:"primaryKey"`
+	IP          string    `gorm:"type:varchar(64);index:idx_password_reset_attempts_ip_created;not null"`
+	ContactHash string    `gorm:"type:char(64);index:idx_password_reset_attempts_contact_created;not null"`
+	CreatedAt   time.Time `gorm:"index:idx_password_reset_attempts_ip_created;index:idx_password_reset_attempts_contact_created"`
+}
+
+type RequestPasswordResetRequest struct {
+	ContactType   ContactType `json:"contactType" binding:"required,oneof=phone email"`
+	ContactDetail string      `json:"contactDetail" binding:"required"`
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=32"`
+}
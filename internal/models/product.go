@@ -6,7 +6,7 @@ type Product struct {
 	ID               uint            `json:"productId" gorm:"primaryKey"`
 	UserID           uint            `json:"-" gorm:"index;not null"`
 	Name             string          `json:"name" gorm:"type:varchar(32);not null"`
-	Category         ProductCategory `json:"category" gorm:"type:varchar(16);not null"`
+	Category         ProductCategory `json:"category" gorm:"column:category;-:migration"`
 	Qty              uint            `json:"qty" gorm:"not null;check:qty > 0"`
 	Price            uint            `json:"price" gorm:"not null;check:price >= 100"`
 	SKU              string          `json:"sku" gorm:"type:varchar(32);not null"`
@@ -15,16 +15,45 @@ type Product struct {
 	FileThumbnailURI string          `json:"fileThumbnailUri" gorm:"type:text"`
 	CreatedAt        time.Time       `json:"createdAt"`
 	UpdatedAt        time.Time       `json:"updatedAt"`
+
+	// IsActive is false for archived and deleted products and for products of
+	// deleted accounts; they stay resolvable for purchase history
+	IsActive   bool       `json:"-" gorm:"column:is_active;not null;default:true"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty" gorm:"index"`
+	DeletedAt  *time.Time `json:"deletedAt,omitempty" gorm:"index"`
+	// CategoryID is the category the product is filed under. Category holds its
+	// display name, kept in sync on rename; that column is managed by the data
+	// migrations because the search vector is generated from it.
+	CategoryID uint `json:"categoryId" gorm:"index;not null;default:0"`
+
+	// Options and Variants are empty for products sold as a single item
+	Options  []ProductOption  `json:"options,omitempty" gorm:"serializer:json;type:jsonb"`
+	Variants []ProductVariant `json:"variants,omitempty" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE"`
+	Images   []ProductImage   `json:"images,omitempty" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE"`
+
+	// Description is Markdown written by the seller; DescriptionHTML is its sanitized rendering
+	Description     string         `json:"description" gorm:"type:text;not null;default:''"`
+	DescriptionHTML string         `json:"descriptionHtml" gorm:"type:text;not null;default:''"`
+	Attributes      map[string]any `json:"attributes,omitempty" gorm:"serializer:json;type:jsonb"`
 }
 
 // Request payload for update
 type UpdateProductRequest struct {
 	Name     string `json:"name" binding:"required,min=4,max=32"`
-	Category string `json:"category" binding:"required,oneof=Food Beverage Clothes Furniture Tools"`
-	Qty      uint   `json:"qty" binding:"required,min=1"`
-	Price    uint   `json:"price" binding:"required,min=100"`
+	Category string `json:"category" binding:"required,max=64"`
+	Qty      uint   `json:"qty" binding:"required_without=Variants,omitempty,min=1"`
+	Price    uint   `json:"price" binding:"required_without=Variants,omitempty,min=100"`
 	SKU      string `json:"sku" binding:"required,min=1,max=32"`
 	FileID   string `json:"fileId" binding:"required"`
+
+	// Variants replace the current ones; qty and price are then taken from them
+	Options  []ProductOption       `json:"options" binding:"omitempty,max=3,dive"`
+	Variants []ProductVariantInput `json:"variants" binding:"omitempty,max=100,dive"`
+	// FileIDs replaces the gallery when set; fileId stays the cover and is added if missing
+	FileIDs []string `json:"fileIds" binding:"omitempty,dive,required"`
+	// Description and Attributes are kept when left out
+	Description *string        `json:"description" binding:"omitempty,max=5000"`
+	Attributes  map[string]any `json:"attributes"`
 }
 
 // Response payload
@@ -32,6 +61,7 @@ type ProductResponse struct {
 	ProductID        string    `json:"productId"`
 	Name             string    `json:"name"`
 	Category         string    `json:"category"`
+	CategoryID       uint      `json:"categoryId"`
 	Qty              uint      `json:"qty"`
 	Price            uint      `json:"price"`
 	SKU              string    `json:"sku"`
@@ -40,4 +70,15 @@ type ProductResponse struct {
 	FileThumbnailURI string    `json:"fileThumbnailUri"`
 	CreatedAt        time.Time `json:"createdAt"`
 	UpdatedAt        time.Time `json:"updatedAt"`
+
+	Options  []ProductOption  `json:"options,omitempty"`
+	Variants []ProductVariant `json:"variants,omitempty"`
+	Images   []ProductImage   `json:"images"`
+
+	Description     string         `json:"description"`
+	DescriptionHTML string         `json:"descriptionHtml"`
+	Attributes      map[string]any `json:"attributes"`
+
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	DeletedAt  *time.Time `json:"deletedAt,omitempty"`
 }
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// ProductImage is one image of a product gallery. The cover image is the one
+// whose file is also the product's own FileID.
+type ProductImage struct {
+	ID               uint      `json:"-" gorm:"primaryKey"`
+	ProductID        uint      `json:"-" gorm:"not null;uniqueIndex:idx_product_images_product_file"`
+	FileID           string    `json:"fileId" gorm:"not null;uniqueIndex:idx_product_images_product_file"`
+	FileURI          string    `json:"fileUri" gorm:"type:text"`
+	FileThumbnailURI string    `json:"fileThumbnailUri" gorm:"type:text"`
+	Position         int       `json:"position" gorm:"not null;default:0"`
+	IsCover          bool      `json:"isCover" gorm:"-"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// AddProductImageRequest appends an image to the gallery
+type AddProductImageRequest struct {
+	FileID string `json:"fileId" binding:"required"`
+	Cover  bool   `json:"cover"`
+}
+
+// ReorderProductImagesRequest lists every image of the gallery in its new order
+type ReorderProductImagesRequest struct {
+	FileIDs     []string `json:"fileIds" binding:"required,min=1,dive,required"`
+	CoverFileID string   `json:"coverFileId"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+type ProductImportStatus string
+
+const (
+	ProductImportPending    ProductImportStatus = "pending"
+	ProductImportProcessing ProductImportStatus = "processing"
+	ProductImportCompleted  ProductImportStatus = "completed"
+	ProductImportFailed     ProductImportStatus = "failed"
+)
+
+type ProductImportFormat string
+
+const (
+	ProductImportCSV  ProductImportFormat = "csv"
+	ProductImportXLSX ProductImportFormat = "xlsx"
+)
+
+// ProductImport is a spreadsheet of products uploaded by a seller and
+// imported row by row in the background
+type ProductImport struct {
+	ID       uint                `json:"importId" gorm:"primaryKey"`
+	UserID   uint                `json:"-" gorm:"index;not null"`
+	FileName string              `json:"fileName" gorm:"type:varchar(255);not null"`
+	Format   ProductImportFormat `json:"format" gorm:"type:varchar(8);not null"`
+	// Upsert updates products whose SKU already exists instead of reporting them
+	Upsert bool                `json:"upsert" gorm:"not null;default:false"`
+	Status ProductImportStatus `json:"status" gorm:"type:varchar(16);index;not null"`
+	// Data is the uploaded file; it is cleared once the import has run
+	Data []byte `json:"-" gorm:"type:bytea"`
+
+	TotalRows     int                  `json:"totalRows" gorm:"not null;default:0"`
+	ProcessedRows int                  `json:"processedRows" gorm:"not null;default:0"`
+	CreatedRows   int                  `json:"createdRows" gorm:"not null;default:0"`
+	UpdatedRows   int                  `json:"updatedRows" gorm:"not null;default:0"`
+	FailedRows    int                  `json:"failedRows" gorm:"not null;default:0"`
+	Errors        []ProductImportError `json:"-" gorm:"serializer:json;type:jsonb"`
+	// CheckpointRow is the last row whose outcome has been saved; a job taken
+	// over by another worker resumes after it
+	CheckpointRow int `json:"-" gorm:"not null;default:0"`
+	// Error is set when the whole import failed rather than single rows
+	Error string `json:"error,omitempty" gorm:"type:text"`
+
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// ProductImportError explains why a row was not imported; Row counts the
+// header as row 1, like spreadsheet programs do
+type ProductImportError struct {
+	Row   int    `json:"row"`
+	SKU   string `json:"sku"`
+	Error string `json:"error"`
+}
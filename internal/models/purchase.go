@@ -22,6 +22,9 @@ type PurchaseItem struct {
 	CreatedAt  time.Time `json:"createdAt"`
 	UpdatedAt  time.Time `json:"updatedAt"`
 	Product    Product   `json:"product" gorm:"foreignKey:ProductID"`
+
+	// VariantID is not a foreign key so the item survives the variant being removed
+	VariantID *uint `json:"variantId,omitempty" gorm:"index"`
 }
 
 type PurchasePaymentProof struct {
@@ -34,6 +37,7 @@ type PurchasePaymentProof struct {
 
 type PurchasedItems struct {
 	ProductID string `json:"productId" binding:"required"`
+	VariantID string `json:"variantId" binding:"omitempty"` // Required for products with variants
 	Quantity  uint   `json:"qty" binding:"required,min=2"`
 }
 
@@ -74,4 +78,7 @@ type PurchasedItemResponse struct {
 	FileThumbnailURI string `json:"fileThumbnailUri"`
 	CreatedAt        string `json:"createdAt"`
 	UpdatedAt        string `json:"updatedAt"`
+
+	VariantID string            `json:"variantId,omitempty"`
+	Options   map[string]string `json:"options,omitempty"`
 }
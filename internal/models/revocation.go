@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type RevocationKind string
+
+const (
+	// RevocationKindToken revokes a single access token by its jti
+	RevocationKindToken RevocationKind = "token"
+	// RevocationKindSession revokes every access token issued for a session
+	RevocationKindSession RevocationKind = "session"
+	// RevocationKindUser revokes every access token of a user issued before RevokedAt
+	RevocationKindUser RevocationKind = "user"
+)
+
+// TokenRevocation invalidates access tokens before they expire.
+// Rows are only needed until ExpiresAt, after which the tokens they cover are expired anyway.
+type TokenRevocation struct {
+	ID        uint           `json:"-" gorm:"primaryKey"`
+	Kind      RevocationKind `json:"kind" gorm:"type:varchar(16);not null;uniqueIndex:idx_token_revocations_subject"`
+	Subject   string         `json:"subject" gorm:"type:varchar(64);not null;uniqueIndex:idx_token_revocations_subject"`
+	UserID    uint           `json:"-" gorm:"index;not null"`
+	RevokedAt time.Time      `json:"revokedAt" gorm:"not null"`
+	ExpiresAt time.Time      `json:"expiresAt" gorm:"index;not null"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+)
+
+// Permissions checked by middleware.RequirePermission
+const (
+	PermissionUsersRead        = "users:read"
+	PermissionRolesManage      = "roles:manage"
+	PermissionCategoriesManage = "categories:manage"
+)
+
+// RolePermissions lists what each role may do. Users without a role only
+// have access to their own resources.
+var RolePermissions = map[Role][]string{
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionRolesManage,
+		PermissionCategoriesManage,
+	},
+	RoleModerator: {
+		PermissionUsersRead,
+	},
+}
+
+// UserRole grants a role to a user
+type UserRole struct {
+	UserID    uint      `json:"-" gorm:"primaryKey"`
+	Role      Role      `json:"role" gorm:"primaryKey;type:varchar(32)"`
+	GrantedBy *uint     `json:"grantedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Access is the set of roles and permissions carried in an access token
+type Access struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+type SetRolesRequest struct {
+	Roles []Role `json:"roles" binding:"omitempty,dive,oneof=admin moderator"`
+}
+
+// AdminUserResponse is a user as seen from the admin endpoints
+type AdminUserResponse struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"createdAt"`
+}
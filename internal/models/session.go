@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Session is a server-side login session bound to a single device.
+// All refresh tokens issued for a session belong to the same token family.
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	DeviceID   string     `json:"deviceId" gorm:"type:varchar(64);not null"`
+	DeviceName string     `json:"deviceName" gorm:"type:varchar(128)"`
+	IP         string     `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent  string     `json:"userAgent" gorm:"type:text"`
+	LastSeenAt *time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// SessionClient describes the device a session was started or last used from
+type SessionClient struct {
+	DeviceName string
+	IP         string
+	UserAgent  string
+}
+
+// SessionResponse is a session as listed by GET /v1/user/sessions
+type SessionResponse struct {
+	Session
+	Current bool `json:"current"`
+}
+
+// RefreshToken is a single-use token that can be exchanged for a new access token.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	SessionID string     `json:"-" gorm:"type:uuid;index;not null"`
+	UserID    uint       `json:"-" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"-"`
+	RevokedAt *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+	DeviceID     string `json:"deviceId" binding:"required,max=64"`
+}
+
+// TokenPair is returned by every endpoint that authenticates a user
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	DeviceID     string `json:"deviceId"`
+	SessionID    string `json:"-"`
+}
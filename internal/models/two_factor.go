@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// TwoFactor holds a user's TOTP enrollment. The secret is encrypted at rest
+// and the enrollment only counts once EnabledAt is set. FailedAttempts counts
+// invalid codes since the last valid one and may lock it until LockedUntil.
+type TwoFactor struct {
+	UserID          uint       `json:"-" gorm:"primaryKey"`
+	SecretEncrypted string     `json:"-" gorm:"type:text;not null"`
+	EnabledAt       *time.Time `json:"enabledAt"`
+	LastUsedStep    int64      `json:"-" gorm:"not null;default:0"`
+	FailedAttempts  int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil     *time.Time `json:"-"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the authenticator is lost
+type RecoveryCode struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	UserID    uint       `json:"-" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"type:char(64);not null"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// LoginChallenge is issued instead of a token pair when the password was
+// correct but the account still needs a second factor. Identifier is the login
+// throttle key, which is only reset once the second factor passes.
+type LoginChallenge struct {
+	ID         uint       `json:"-" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	TokenHash  string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	DeviceID   string     `json:"-" gorm:"type:varchar(64);not null"`
+	Identifier string     `json:"-" gorm:"type:varchar(255);not null;default:''"`
+	Attempts   int        `json:"-" gorm:"not null;default:0"`
+	ExpiresAt  time.Time  `json:"-" gorm:"not null"`
+	UsedAt     *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+	// QRPayload is the text to encode in the QR code shown to the user
+	QRPayload string `json:"qrPayload"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password    string `json:"password" binding:"required_without=ReauthToken"`
+	ReauthToken string `json:"reauthToken"`
+	Code        string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"twoFactorRequired"`
+	ChallengeToken    string    `json:"challengeToken"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// LoginTwoFactorRequest completes a challenge with either a TOTP code or a recovery code
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode   string `json:"recoveryCode" binding:"required_without=Code,omitempty,max=32"`
+}
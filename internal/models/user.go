@@ -20,6 +20,13 @@ type User struct {
 	ImageURI          string    `json:"imageUri" gorm:"type:text"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
+
+	// EmailVerifiedAt is set once the user proved they own Email, by a code or
+	// through an identity provider. Only verified emails are linked to providers.
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	// AnonymizedAt is set when the account was deleted and its personal data removed
+	AnonymizedAt *time.Time `json:"-"`
 }
 
 // InputUser represents the input for user registration
@@ -36,6 +43,14 @@ type UpdateUserRequest struct {
 	BankAccountNumber string `json:"bankAccountNumber" binding:"required,min=4,max=32"`
 }
 
+// ChangePasswordRequest represents the request payload for PUT /v1/user/password
+// Users without a password send a reauthToken from a fresh identity provider login instead
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required_without=ReauthToken"`
+	ReauthToken     string `json:"reauthToken"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
 // UserResponse represents the response payload for GET /v1/user
 type UserResponse struct {
 	Email             string `json:"email"`
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ProductOption is an axis products vary along, such as size or color
+type ProductOption struct {
+	Name   string   `json:"name" binding:"required,min=1,max=32"`
+	Values []string `json:"values" binding:"required,min=1,max=50,dive,required,max=32"`
+}
+
+// ProductVariant is one purchasable combination of a product's option values.
+// A product with variants keeps the summed stock and lowest price of its
+// variants in its own qty and price, so listings and filters keep working.
+type ProductVariant struct {
+	ID               uint              `json:"variantId" gorm:"primaryKey"`
+	ProductID        uint              `json:"-" gorm:"index;not null"`
+	SKU              string            `json:"sku" gorm:"type:varchar(32);not null;index"`
+	Options          map[string]string `json:"options" gorm:"serializer:json;type:jsonb;not null"`
+	Qty              uint              `json:"qty" gorm:"not null"`
+	Price            uint              `json:"price" gorm:"not null;check:price >= 100"`
+	FileID           string            `json:"fileId"`
+	FileURI          string            `json:"fileUri" gorm:"type:text"`
+	FileThumbnailURI string            `json:"fileThumbnailUri" gorm:"type:text"`
+	Position         int               `json:"-" gorm:"not null;default:0"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+}
+
+// ProductVariantInput creates a variant, or updates the one with VariantID
+type ProductVariantInput struct {
+	VariantID *uint             `json:"variantId"`
+	SKU       string            `json:"sku" binding:"required,min=1,max=32"`
+	Options   map[string]string `json:"options" binding:"required,min=1"`
+	Qty       uint              `json:"qty"`
+	Price     uint              `json:"price" binding:"required,min=100"`
+	FileID    string            `json:"fileId"`
+}
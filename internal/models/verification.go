@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ContactVerification is a pending one-time code proving ownership of an email or phone.
+// A user has at most one pending verification per channel.
+type ContactVerification struct {
+	ID         uint        `json:"-" gorm:"primaryKey"`
+	UserID     uint        `json:"-" gorm:"not null;uniqueIndex:idx_contact_verifications_user_channel"`
+	Channel    ContactType `json:"channel" gorm:"type:varchar(8);not null;uniqueIndex:idx_contact_verifications_user_channel"`
+	Target     string      `json:"target" gorm:"type:varchar(255);not null"`
+	CodeHash   string      `json:"-" gorm:"type:char(64);not null"`
+	Attempts   int         `json:"-" gorm:"not null;default:0"`
+	ExpiresAt  time.Time   `json:"expiresAt" gorm:"not null"`
+	LastSentAt time.Time   `json:"-" gorm:"not null"`
+	CreatedAt  time.Time   `json:"-"`
+	UpdatedAt  time.Time   `json:"-"`
+}
+
+type VerifyContactRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type VerificationSentResponse struct {
+	Channel     ContactType `json:"channel"`
+	Target      string      `json:"target"`
+	ExpiresAt   time.Time   `json:"expiresAt"`
+	ResendAfter time.Time   `json:"resendAfter"`
+}
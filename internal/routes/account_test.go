@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+func TestAccountExportOnlyContainsOwnData(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("buyer@example.com")
+	api.registerEmail("other@example.com")
+
+	var export models.AccountExport
+	expectStatus(t, api.request(http.MethodGet, "/v1/user/export", login.Token, nil, &export), http.StatusOK)
+	if export.Profile.Email != "buyer@example.com" {
+		t.Fatalf("expected the caller's profile, got %+v", export.Profile)
+	}
+	if export.Profile.ID != api.user("buyer@example.com").ID {
+		t.Fatal("expected the caller's user id")
+	}
+}
+
+func TestAccountDeleteRequiresPasswordAndAnonymizes(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("buyer@example.com")
+	user := api.user("buyer@example.com")
+
+	// Leave traces of the user in the login and audit tables
+	rec := api.request(http.MethodPost, "/v1/login", "", models.LoginInput{Identifier: "buyer@example.com", Password: "wrongpassword"}, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = api.request(http.MethodDelete, "/v1/user", login.Token, models.DeleteAccountRequest{Password: "wrongpassword"}, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = api.request(http.MethodDelete, "/v1/user", login.Token, models.DeleteAccountRequest{ReauthToken: "made-up"}, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = api.request(http.MethodDelete, "/v1/user", login.Token, models.DeleteAccountRequest{Password: testPassword}, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var deleted models.User
+	if err := api.db.First(&deleted, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Email != "" || deleted.AnonymizedAt == nil {
+		t.Fatalf("expected the user to be anonymized, got email %q", deleted.Email)
+	}
+
+	var attempts, throttles int64
+	api.db.Model(&models.LoginAttempt{}).Where("user_id = ? OR identifier = ?", user.ID, "email:buyer@example.com").Count(&attempts)
+	api.db.Model(&models.LoginThrottle{}).Where("identifier = ?", "email:buyer@example.com").Count(&throttles)
+	if attempts != 0 || throttles != 0 {
+		t.Fatalf("expected login attempts and throttles to be removed, got %d and %d", attempts, throttles)
+	}
+
+	var sessions []models.Session
+	api.db.Where("user_id = ?", user.ID).Find(&sessions)
+	for _, session := range sessions {
+		if session.IP != "" || session.UserAgent != "" || session.DeviceName != "" {
+			t.Fatalf("expected session %s to be scrubbed, got %+v", session.ID, session)
+		}
+	}
+
+	var events []models.AuditEvent
+	api.db.Where("user_id = ?", user.ID).Find(&events)
+	audited := false
+	for _, event := range events {
+		audited = audited || event.Type == models.AuditAccountDeleted
+		if event.IP != "" || event.UserAgent != "" || event.Payload["identifier"] != nil || event.Payload["target"] != nil {
+			t.Fatalf("expected audit event %d to be anonymized, got %+v", event.ID, event)
+		}
+	}
+	if !audited {
+		t.Fatal("expected the deletion to be audited")
+	}
+	if err := api.db.Where("user_id = ?", user.ID).Delete(&models.AuditEvent{}).Error; err == nil {
+		t.Fatal("expected audit events to stay undeletable")
+	}
+
+	// Every credential of the account stops working
+	expectStatus(t, api.request(http.MethodGet, "/v1/user/", login.Token, nil, nil), http.StatusUnauthorized)
+	refresh := models.RefreshTokenRequest{RefreshToken: login.RefreshToken, DeviceID: login.DeviceID}
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/refresh", "", refresh, nil), http.StatusUnauthorized)
+	rec = api.request(http.MethodPost, "/v1/login", "", models.LoginInput{Identifier: "buyer@example.com", Password: testPassword}, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// The address is free for a new account
+	api.registerEmail("buyer@example.com")
+}
@@ -0,0 +1,301 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/database"
+	"tutuplapak/internal/handlers"
+	"tutuplapak/internal/middleware"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/oidctest"
+	"tutuplapak/internal/services"
+	"tutuplapak/internal/testutil"
+	"tutuplapak/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	testPassword    = "password123"
+	testRedirectURL = "http://localhost/v1/login/oidc/test/callback"
+)
+
+// testAPI is the full router wired like main.go against a test database and
+// an in-process identity provider
+type testAPI struct {
+	t      *testing.T
+	db     *gorm.DB
+	router *gin.Engine
+	idp    *oidctest.Server
+	cfg    *config.Config
+}
+
+func newTestAPI(t *testing.T, configure ...func(*config.Config)) *testAPI {
+	t.Helper()
+	db := testutil.DB(t)
+	gin.SetMode(gin.TestMode)
+
+	idp, err := oidctest.NewServer("tutuplapak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	cfg := &config.Config{
+		JWTSecret: "test-jwt-secret",
+		Auth: config.AuthConfig{
+			RefreshTokenTTL: time.Hour,
+			Signing:         config.SigningConfig{Algorithm: "HS256"},
+		},
+		PasswordReset: config.PasswordResetConfig{
+			TokenTTL:      time.Hour,
+			Window:        time.Hour,
+			MaxPerIP:      10,
+			MaxPerContact: 3,
+		},
+		Notification: config.NotificationConfig{
+			Sender:     "file",
+			OutboxPath: filepath.Join(t.TempDir(), "outbox.log"),
+		},
+		Verification: config.VerificationConfig{
+			CodeTTL:        10 * time.Minute,
+			MaxAttempts:    5,
+			ResendCooldown: time.Minute,
+		},
+		Login: config.LoginProtectionConfig{
+			BackoffThreshold: 100,
+			BackoffBase:      time.Second,
+			BackoffMax:       time.Second,
+			MaxFailures:      100,
+			LockoutDuration:  time.Minute,
+			IPMaxFailures:    100,
+			IPWindow:         time.Minute,
+		},
+		TwoFactor: config.TwoFactorConfig{
+			Issuer:          "tutuplapak-test",
+			EncryptionKey:   "test-2fa-key",
+			ChallengeTTL:    5 * time.Minute,
+			MaxAttempts:     5,
+			MaxFailures:     10,
+			LockoutDuration: 15 * time.Minute,
+		},
+		OIDC: config.OIDCConfig{
+			Providers: []config.OIDCProviderConfig{{
+				Name:        "test",
+				Issuer:      idp.Issuer,
+				ClientID:    "tutuplapak",
+				RedirectURL: testRedirectURL,
+				Scopes:      []string{"openid", "email", "profile"},
+			}},
+			StateTTL: 10 * time.Minute,
+		},
+		Product: config.ProductConfig{
+			MaxImages:      10,
+			ImportMaxRows:  100,
+			ImportMaxBytes: 1 << 20,
+		},
+	}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	// Cheap password hashing keeps the suite fast
+	utils.UsePasswordParams(utils.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+
+	keyManager, err := middleware.NewKeyManager(cfg.Auth.Signing, cfg.JWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleware.UseKeys(keyManager)
+
+	revocationService := services.NewRevocationService(db, middleware.AccessTokenTTL)
+	if err := revocationService.Load(); err != nil {
+		t.Fatal(err)
+	}
+	refreshTokenService := services.NewRefreshTokenService(db, cfg.Auth.RefreshTokenTTL, revocationService)
+	apiKeyService := services.NewAPIKeyService(db)
+	authenticator := middleware.NewAuthenticator(revocationService, apiKeyService, refreshTokenService)
+	accessService := services.NewAccessService(db)
+	auditService := services.NewAuditService(db)
+	accountService := services.NewAccountService(db, refreshTokenService)
+
+	sender, err := services.NewSender(cfg.Notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verificationService := services.NewVerificationService(db, sender, cfg.Verification)
+	passwordResetService := services.NewPasswordResetService(db, sender, refreshTokenService, cfg.PasswordReset)
+	twoFactorService, err := services.NewTwoFactorService(db, cfg.TwoFactor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oidcService := services.NewOIDCService(db, cfg.OIDC)
+	reauthService := services.NewReauthService(db)
+	categoryService := services.NewCategoryService(db)
+
+	loginHandler := handlers.NewLoginHandler(db, refreshTokenService, accessService, services.NewLoginGuard(db, cfg.Login), twoFactorService, auditService)
+
+	router := gin.New()
+	SetupRoutes(router,
+		handlers.NewHealthHandler(),
+		handlers.NewUserHandler(db, verificationService, refreshTokenService, reauthService, auditService),
+		handlers.NewRegisterHandler(db, refreshTokenService, accessService, auditService),
+		loginHandler,
+		handlers.NewFileHandler(nil),
+		handlers.NewProductHandler(db, categoryService, cfg.Product),
+		handlers.NewPurchaseHandler(db),
+		handlers.NewAuthHandler(db, refreshTokenService, accessService, revocationService, auditService),
+		authenticator,
+		handlers.NewJWKSHandler(keyManager),
+		handlers.NewPasswordResetHandler(passwordResetService),
+		handlers.NewTwoFactorHandler(db, twoFactorService, reauthService, auditService),
+		handlers.NewAdminHandler(db, accessService, revocationService),
+		handlers.NewAPIKeyHandler(apiKeyService),
+		handlers.NewAuditHandler(auditService),
+		handlers.NewSessionHandler(refreshTokenService, auditService),
+		handlers.NewAccountHandler(db, accountService, nil, reauthService, auditService),
+		handlers.NewOIDCHandler(oidcService, loginHandler, reauthService, auditService),
+		handlers.NewCategoryHandler(categoryService),
+	)
+
+	return &testAPI{t: t, db: database.DB, router: router, idp: idp, cfg: cfg}
+}
+
+// request sends a JSON request, with a bearer token when one is given, and
+// decodes the response into out when it is not nil
+func (a *testAPI) request(method, path, token string, body, out any) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.serve(req, out)
+}
+
+func (a *testAPI) serve(req *http.Request, out any) *httptest.ResponseRecorder {
+	a.t.Helper()
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	if out != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			a.t.Fatalf("decode %s %s response %q: %v", req.Method, req.URL.Path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+// expectStatus fails the test when the response has another status
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+}
+
+// registerEmail creates a password user and returns its login
+func (a *testAPI) registerEmail(email string) models.LoginPhoneOutput {
+	a.t.Helper()
+	var out models.LoginPhoneOutput
+	rec := a.request(http.MethodPost, "/v1/register/email", "", models.LoginEmailInput{Email: email, Password: testPassword}, &out)
+	expectStatus(a.t, rec, http.StatusCreated)
+	return out
+}
+
+// user loads a user by email straight from the database
+func (a *testAPI) user(email string) models.User {
+	a.t.Helper()
+	var user models.User
+	if err := a.db.Where("email = ?", email).First(&user).Error; err != nil {
+		a.t.Fatalf("load user %s: %v", email, err)
+	}
+	return user
+}
+
+// oidcFlow follows an authorization URL returned by one of the begin
+// endpoints at the identity provider and replays the redirect on the router,
+// sending the state cookie only when withCookie is set
+func (a *testAPI) oidcFlow(begin *httptest.ResponseRecorder, withCookie bool, out any) *httptest.ResponseRecorder {
+	a.t.Helper()
+	expectStatus(a.t, begin, http.StatusOK)
+	var authorization models.OIDCAuthorizationResponse
+	if err := json.Unmarshal(begin.Body.Bytes(), &authorization); err != nil {
+		a.t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authorization.AuthorizationURL)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		a.t.Fatalf("expected the provider to redirect, got %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	if withCookie {
+		for _, cookie := range begin.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+	}
+	return a.serve(req, out)
+}
+
+// upload records a file as uploaded by the user, standing in for POST /v1/file
+func (a *testAPI) upload(userID uint, fileID string) {
+	a.t.Helper()
+	upload := models.FileUpload{
+		FileID:           fileID,
+		FileName:         fileID + ".jpg",
+		FileSize:         1,
+		FileType:         "image/jpeg",
+		FileURI:          "http://files.local/" + fileID,
+		FileThumbnailURI: "http://files.local/" + fileID + "-thumb",
+		UserID:           &userID,
+	}
+	if err := a.db.Create(&upload).Error; err != nil {
+		a.t.Fatalf("upload %s: %v", fileID, err)
+	}
+}
+
+// productInput is a valid product with the given SKU and cover
+func productInput(sku, fileID string) models.ProductInput {
+	return models.ProductInput{
+		Name:     "Kaos Polos " + sku,
+		Category: models.Clothes,
+		Qty:      5,
+		Price:    10000,
+		SKU:      sku,
+		FileID:   fileID,
+	}
+}
+
+// createProduct creates a product through the API and returns it
+func (a *testAPI) createProduct(token string, input models.ProductInput) models.ProductOutput {
+	a.t.Helper()
+	var out models.ProductOutput
+	expectStatus(a.t, a.request(http.MethodPost, "/v1/product/", token, input, &out), http.StatusCreated)
+	return out
+}
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+func TestLogoutRevokesAccessAndRefreshTokens(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("buyer@example.com")
+
+	expectStatus(t, api.request(http.MethodGet, "/v1/user/", login.Token, nil, nil), http.StatusOK)
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/logout", login.Token, nil, nil), http.StatusOK)
+
+	expectStatus(t, api.request(http.MethodGet, "/v1/user/", login.Token, nil, nil), http.StatusUnauthorized)
+	refresh := models.RefreshTokenRequest{RefreshToken: login.RefreshToken, DeviceID: login.DeviceID}
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/refresh", "", refresh, nil), http.StatusUnauthorized)
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	api := newTestAPI(t)
+	first := api.registerEmail("buyer@example.com")
+	var second models.LoginPhoneOutput
+	rec := api.request(http.MethodPost, "/v1/login/email", "", models.LoginEmailInput{Email: "buyer@example.com", Password: testPassword, DeviceID: "second-device"}, &second)
+	expectStatus(t, rec, http.StatusOK)
+
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/logout/all", first.Token, nil, nil), http.StatusOK)
+
+	for _, login := range []models.LoginPhoneOutput{first, second} {
+		expectStatus(t, api.request(http.MethodGet, "/v1/user/", login.Token, nil, nil), http.StatusUnauthorized)
+		refresh := models.RefreshTokenRequest{RefreshToken: login.RefreshToken, DeviceID: login.DeviceID}
+		expectStatus(t, api.request(http.MethodPost, "/v1/auth/refresh", "", refresh, nil), http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshTokenIsSingleUse(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("buyer@example.com")
+	refresh := models.RefreshTokenRequest{RefreshToken: login.RefreshToken, DeviceID: login.DeviceID}
+
+	var rotated models.TokenPair
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/refresh", "", refresh, &rotated), http.StatusOK)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatal("expected a new refresh token")
+	}
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/refresh", "", refresh, nil), http.StatusUnauthorized)
+}
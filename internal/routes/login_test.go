@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+func TestLoginNormalizesEmail(t *testing.T) {
+	api := newTestAPI(t)
+	api.registerEmail("Buyer@Example.com")
+	api.user("buyer@example.com")
+
+	for _, identifier := range []string{"buyer@example.com", "BUYER@example.COM", " Buyer@Example.com "} {
+		rec := api.request(http.MethodPost, "/v1/login", "", models.LoginInput{Identifier: identifier, Password: testPassword}, nil)
+		expectStatus(t, rec, http.StatusOK)
+	}
+
+	// The same address in another case cannot register a second account
+	rec := api.request(http.MethodPost, "/v1/register/email", "", models.LoginEmailInput{Email: "BUYER@example.com", Password: testPassword}, nil)
+	expectStatus(t, rec, http.StatusConflict)
+}
+
+func TestLoginNormalizesPhone(t *testing.T) {
+	api := newTestAPI(t)
+	rec := api.request(http.MethodPost, "/v1/register/phone", "", models.PhoneUser{Phone: "0812-3456-7890", Password: testPassword}, nil)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var user models.User
+	if err := api.db.Where("phone = ?", "+6281234567890").First(&user).Error; err != nil {
+		t.Fatalf("expected the phone to be stored in E.164 form: %v", err)
+	}
+
+	for _, phone := range []string{"+6281234567890", "081234567890", "+62 812 3456 7890"} {
+		rec := api.request(http.MethodPost, "/v1/login/phone", "", models.LoginPhoneInput{Phone: phone, Password: testPassword}, nil)
+		expectStatus(t, rec, http.StatusOK)
+		rec = api.request(http.MethodPost, "/v1/login", "", models.LoginInput{Identifier: phone, Password: testPassword}, nil)
+		expectStatus(t, rec, http.StatusOK)
+	}
+}
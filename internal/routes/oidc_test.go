@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/oidctest"
+)
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	api := newTestAPI(t)
+	api.idp.SetIdentity(oidctest.Identity{Subject: "sub-1", Email: "New.Buyer@Example.com", EmailVerified: true, Name: "New Buyer"})
+
+	var login models.LoginPhoneOutput
+	rec := api.oidcFlow(api.request(http.MethodGet, "/v1/login/oidc/test", "", nil, nil), true, &login)
+	expectStatus(t, rec, http.StatusOK)
+	if login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("expected tokens, got %+v", login)
+	}
+
+	user := api.user("new.buyer@example.com")
+	if user.EmailVerifiedAt == nil {
+		t.Fatal("expected the provider's verified email to be marked verified")
+	}
+
+	// The same identity logs in to the same account
+	rec = api.oidcFlow(api.request(http.MethodGet, "/v1/login/oidc/test", "", nil, nil), true, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var count int64
+	api.db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected one user, got %d", count)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := api.oidcFlow(api.request(http.MethodGet, "/v1/login/oidc/test", "", nil, nil), false, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	var count int64
+	api.db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no user to be created, got %d", count)
+	}
+}
+
+func TestOIDCCallbackRejectsReplayedState(t *testing.T) {
+	api := newTestAPI(t)
+	begin := api.request(http.MethodGet, "/v1/login/oidc/test", "", nil, nil)
+	expectStatus(t, api.oidcFlow(begin, true, nil), http.StatusOK)
+
+	// The state was consumed by the first callback
+	expectStatus(t, api.oidcFlow(begin, true, nil), http.StatusBadRequest)
+}
+
+func TestOIDCLoginDoesNotAutoLinkUnverifiedLocalEmail(t *testing.T) {
+	api := newTestAPI(t)
+	api.registerEmail("victim@example.com")
+	api.idp.SetIdentity(oidctest.Identity{Subject: "attacker", Email: "victim@example.com", EmailVerified: true})
+
+	rec := api.oidcFlow(api.request(http.MethodGet, "/v1/login/oidc/test", "", nil, nil), true, nil)
+	expectStatus(t, rec, http.StatusConflict)
+
+	var identities int64
+	api.db.Model(&models.OIDCIdentity{}).Count(&identities)
+	if identities != 0 {
+		t.Fatalf("expected no identity to be linked, got %d", identities)
+	}
+}
+
+func TestOIDCLoginAutoLinksVerifiedLocalEmail(t *testing.T) {
+	api := newTestAPI(t)
+	api.registerEmail("buyer@example.com")
+	user := api.user("buyer@example.com")
+	api.db.Model(&user).Update("email_verified_at", user.CreatedAt)
+
+	// A provider that does not vouch for the email gets a separate account
+	api.idp.SetIdentity(oidctest.Identity{Subject: "sub-1", Email: "buyer@example.com", EmailVerified: false})
+	rec := api.oidcFlow(api.request(http.MethodGet, "/v1/login/oidc/test", "", nil, nil), true, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var unverified models.OIDCIdentity
+	if err := api.db.Where("subject = ?", "sub-1").First(&unverified).Error; err != nil {
+		t.Fatal(err)
+	}
+	if unverified.UserID == user.ID {
+		t.Fatal("expected an unverified provider email not to link the local account")
+	}
+
+	api.idp.SetIdentity(oidctest.Identity{Subject: "sub-2", Email: "buyer@example.com", EmailVerified: true})
+	rec = api.oidcFlow(api.request(http.MethodGet, "/v1/login/oidc/test", "", nil, nil), true, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var identity models.OIDCIdentity
+	if err := api.db.Where("subject = ?", "sub-2").First(&identity).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != user.ID {
+		t.Fatalf("expected the identity to link user %d, got %d", user.ID, identity.UserID)
+	}
+}
+
+func TestOIDCLinkAndReauth(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	user := api.user("seller@example.com")
+	api.idp.SetIdentity(oidctest.Identity{Subject: "seller-sub", Email: "other@example.com", EmailVerified: true})
+
+	// Reauthentication needs a linked identity
+	rec := api.oidcFlow(api.request(http.MethodPost, "/v1/user/oidc/test/reauth", login.Token, nil, nil), true, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = api.oidcFlow(api.request(http.MethodPost, "/v1/user/oidc/test/link", login.Token, nil, nil), true, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var identity models.OIDCIdentity
+	if err := api.db.Where("subject = ?", "seller-sub").First(&identity).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != user.ID {
+		t.Fatalf("expected the identity to link user %d, got %d", user.ID, identity.UserID)
+	}
+
+	var reauth models.ReauthResponse
+	rec = api.oidcFlow(api.request(http.MethodPost, "/v1/user/oidc/test/reauth", login.Token, nil, nil), true, &reauth)
+	expectStatus(t, rec, http.StatusOK)
+	if reauth.ReauthToken == "" {
+		t.Fatal("expected a reauthentication token")
+	}
+
+	// The token replaces the password once
+	change := models.ChangePasswordRequest{ReauthToken: reauth.ReauthToken, NewPassword: "newpassword1"}
+	expectStatus(t, api.request(http.MethodPut, "/v1/user/password", login.Token, change, nil), http.StatusOK)
+	expectStatus(t, api.request(http.MethodPut, "/v1/user/password", login.Token, change, nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+)
+
+// resetTokens waits for the background deliveries and counts the user's reset tokens
+func (a *testAPI) resetTokens(userID uint, want int64) int64 {
+	a.t.Helper()
+	var count int64
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		a.db.Model(&models.PasswordResetToken{}).Where("user_id = ?", userID).Count(&count)
+		if count >= want {
+			break
+		}
+	}
+	return count
+}
+
+func TestPasswordResetAnswersAlikeForUnknownContacts(t *testing.T) {
+	api := newTestAPI(t)
+	api.registerEmail("buyer@example.com")
+
+	known := api.request(http.MethodPost, "/v1/password/reset", "", models.RequestPasswordResetRequest{ContactType: models.ContactTypeEmail, ContactDetail: "buyer@example.com"}, nil)
+	unknown := api.request(http.MethodPost, "/v1/password/reset", "", models.RequestPasswordResetRequest{ContactType: models.ContactTypeEmail, ContactDetail: "nobody@example.com"}, nil)
+	expectStatus(t, known, http.StatusAccepted)
+	expectStatus(t, unknown, http.StatusAccepted)
+	if known.Body.String() != unknown.Body.String() {
+		t.Fatalf("expected the same answer, got %s and %s", known.Body.String(), unknown.Body.String())
+	}
+
+	if count := api.resetTokens(api.user("buyer@example.com").ID, 1); count != 1 {
+		t.Fatalf("expected one reset token, got %d", count)
+	}
+}
+
+func TestPasswordResetIsRateLimited(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.PasswordReset.MaxPerIP = 4
+		cfg.PasswordReset.MaxPerContact = 2
+	})
+	api.registerEmail("buyer@example.com")
+	reset := models.RequestPasswordResetRequest{ContactType: models.ContactTypeEmail, ContactDetail: "buyer@example.com"}
+
+	// Over the contact limit the request is accepted but no token is sent
+	for i := 0; i < 4; i++ {
+		expectStatus(t, api.request(http.MethodPost, "/v1/password/reset", "", reset, nil), http.StatusAccepted)
+	}
+	userID := api.user("buyer@example.com").ID
+	api.resetTokens(userID, 3)
+	if count := api.resetTokens(userID, 2); count != 2 {
+		t.Fatalf("expected two reset tokens, got %d", count)
+	}
+
+	rec := api.request(http.MethodPost, "/v1/password/reset", "", reset, nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+}
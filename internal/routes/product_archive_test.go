@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+// listArchived fetches the seller's archived or, with status deleted, deleted products
+func (a *testAPI) listArchived(token, status string) []string {
+	a.t.Helper()
+	var out models.ProductListResponse
+	path := "/v1/product/archived"
+	if status != "" {
+		path += "?status=" + status
+	}
+	expectStatus(a.t, a.request(http.MethodGet, path, token, nil, &out), http.StatusOK)
+	return productSKUs(out.Data)
+}
+
+func TestArchiveRestoreAndDeleteProduct(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "cover")
+	buyer := api.registerEmail("buyer@example.com")
+
+	product := api.createProduct(login.Token, productInput("ARSIP", "cover"))
+	api.createProduct(login.Token, productInput("AKTIF", "cover"))
+	path := "/v1/product/" + product.ProductID
+
+	// visible reports whether the product shows up in public listings and lookups
+	visible := func() bool {
+		t.Helper()
+		all := productSKUs(api.listProducts(url.Values{"limit": {"10"}}).Data)
+		byID := api.listProducts(url.Values{"productId": {product.ProductID}}).Data
+		bySKU := api.listProducts(url.Values{"sku": {"ARSIP"}}).Data
+		listed := slices.Contains(all, "ARSIP")
+		if listed != (len(byID) == 1) || listed != (len(bySKU) == 1) {
+			t.Fatalf("listing and lookups disagree: %v, %d by id, %d by sku", all, len(byID), len(bySKU))
+		}
+		return listed
+	}
+	item := models.PurchasedItems{ProductID: product.ProductID, Quantity: 2}
+	if !visible() {
+		t.Fatal("expected the new product to be listed")
+	}
+
+	// Archiving hides the product until it is restored
+	var archived models.ProductResponse
+	expectStatus(t, api.request(http.MethodPost, path+"/archive", login.Token, nil, &archived), http.StatusOK)
+	if archived.ProductID != product.ProductID || archived.Qty != product.Quantity {
+		t.Fatalf("expected the archived product back, got %+v", archived)
+	}
+	expectStatus(t, api.request(http.MethodPost, path+"/archive", login.Token, nil, nil), http.StatusOK)
+	if visible() {
+		t.Fatal("expected the archived product to be hidden")
+	}
+	if total := api.listProducts(nil).Total; *total != 1 {
+		t.Fatalf("expected a total of 1 without the archived product, got %d", *total)
+	}
+	expectStatus(t, api.purchase(buyer.Token, item), http.StatusBadRequest)
+	if skus := api.listArchived(login.Token, ""); !slices.Equal(skus, []string{"ARSIP"}) {
+		t.Fatalf("expected the product among the archived ones, got %v", skus)
+	}
+	if skus := api.listArchived(login.Token, "deleted"); len(skus) != 0 {
+		t.Fatalf("expected no deleted products, got %v", skus)
+	}
+
+	// Only the seller can archive or restore
+	expectStatus(t, api.request(http.MethodPost, path+"/archive", buyer.Token, nil, nil), http.StatusNotFound)
+	expectStatus(t, api.request(http.MethodPost, path+"/restore", buyer.Token, nil, nil), http.StatusNotFound)
+	if skus := api.listArchived(buyer.Token, ""); len(skus) != 0 {
+		t.Fatalf("expected the buyer to have no archived products, got %v", skus)
+	}
+
+	expectStatus(t, api.request(http.MethodPost, path+"/restore", login.Token, nil, nil), http.StatusOK)
+	if !visible() {
+		t.Fatal("expected the restored product to be listed")
+	}
+	expectStatus(t, api.request(http.MethodPost, path+"/restore", login.Token, nil, nil), http.StatusConflict)
+	if skus := api.listArchived(login.Token, ""); len(skus) != 0 {
+		t.Fatalf("expected no archived products after the restore, got %v", skus)
+	}
+
+	// Deleting keeps the row for purchase history but hides it everywhere else
+	expectStatus(t, api.request(http.MethodDelete, path, login.Token, nil, nil), http.StatusOK)
+	if visible() {
+		t.Fatal("expected the deleted product to be hidden")
+	}
+	expectStatus(t, api.purchase(buyer.Token, item), http.StatusBadRequest)
+	expectStatus(t, api.request(http.MethodDelete, path, login.Token, nil, nil), http.StatusNotFound)
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, updateInput(product, "cover"), nil), http.StatusNotFound)
+	expectStatus(t, api.request(http.MethodPost, path+"/archive", login.Token, nil, nil), http.StatusNotFound)
+	expectStatus(t, api.request(http.MethodPost, path+"/images", login.Token, models.AddProductImageRequest{FileID: "cover"}, nil), http.StatusNotFound)
+	if skus := api.listArchived(login.Token, "deleted"); !slices.Equal(skus, []string{"ARSIP"}) {
+		t.Fatalf("expected the product among the deleted ones, got %v", skus)
+	}
+	if skus := api.listArchived(login.Token, ""); len(skus) != 0 {
+		t.Fatalf("expected a deleted product not to count as archived, got %v", skus)
+	}
+
+	// The SKU stays taken so the product can come back
+	expectStatus(t, api.request(http.MethodPost, "/v1/product/", login.Token, productInput("ARSIP", "cover"), nil), http.StatusConflict)
+
+	expectStatus(t, api.request(http.MethodPost, path+"/restore", login.Token, nil, nil), http.StatusOK)
+	if !visible() {
+		t.Fatal("expected the restored product to be listed")
+	}
+	expectStatus(t, api.purchase(buyer.Token, item), http.StatusCreated)
+
+	var count int64
+	api.db.Model(&models.Product{}).Where("user_id = ?", seller.ID).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected both products to still exist, got %d", count)
+	}
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestProductCursorPaging(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "cover")
+
+	// P2 and P3 share a price, so the page boundary between them needs the id tie-break
+	for i, price := range []uint{1000, 2000, 2000, 3000, 4000} {
+		input := productInput("P"+string(rune('1'+i)), "cover")
+		input.Price = price
+		api.createProduct(login.Token, input)
+	}
+
+	page := func(cursor string) ([]string, string, string) {
+		t.Helper()
+		out := api.listProducts(url.Values{"sortBy": {"cheapest"}, "limit": {"2"}, "cursor": {cursor}})
+		return productSKUs(out.Data), out.PrevCursor, out.NextCursor
+	}
+	expectPage := func(skus []string, want ...string) {
+		t.Helper()
+		if !slices.Equal(skus, want) {
+			t.Fatalf("expected page %v, got %v", want, skus)
+		}
+	}
+
+	first := api.listProducts(url.Values{"sortBy": {"cheapest"}, "limit": {"2"}})
+	expectPage(productSKUs(first.Data), "P1", "P2")
+	if first.PrevCursor != "" || first.NextCursor == "" || first.Total == nil || *first.Total != 5 {
+		t.Fatalf("expected only a next cursor and a total of 5 on the first page, got %+v", first)
+	}
+
+	// Forward to the end
+	skus, prev, next := page(first.NextCursor)
+	expectPage(skus, "P3", "P4")
+	if prev == "" || next == "" {
+		t.Fatal("expected both cursors on the middle page")
+	}
+	skus, last, end := page(next)
+	expectPage(skus, "P5")
+	if last == "" || end != "" {
+		t.Fatal("expected only a previous cursor on the last page")
+	}
+
+	// And back to the start
+	skus, prev, next = page(last)
+	expectPage(skus, "P3", "P4")
+	if prev == "" || next == "" {
+		t.Fatal("expected both cursors on the middle page going back")
+	}
+	skus, start, next := page(prev)
+	expectPage(skus, "P1", "P2")
+	if start != "" || next == "" {
+		t.Fatal("expected only a next cursor back on the first page")
+	}
+
+	// Cursor mode skips the count and facets
+	out := api.listProducts(url.Values{"sortBy": {"cheapest"}, "limit": {"2"}, "cursor": {first.NextCursor}})
+	if out.Total != nil || out.Facets != nil {
+		t.Fatal("expected no total or facets in cursor mode")
+	}
+
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"cheapest","k":"cheap","id":1}`))
+	for _, query := range []url.Values{
+		{"sortBy": {"cheapest"}, "cursor": {"not-a-cursor"}},
+		{"sortBy": {"cheapest"}, "cursor": {tampered}},
+		// A cursor only works with the sortBy it was issued for
+		{"sortBy": {"expensive"}, "cursor": {first.NextCursor}},
+		{"cursor": {first.NextCursor}},
+	} {
+		expectStatus(t, api.request(http.MethodGet, "/v1/product/?"+query.Encode(), "", nil, nil), http.StatusBadRequest)
+	}
+}
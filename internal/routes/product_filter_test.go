@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+func TestProductFiltersAndFacets(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "cover")
+
+	for _, product := range []struct {
+		sku      string
+		category models.ProductCategory
+		price    uint
+	}{
+		{"C1", models.Clothes, 5000},
+		{"C2", models.Clothes, 10000},
+		{"C3", models.Clothes, 60000},
+		{"F1", models.Food, 20000},
+		{"F2", models.Food, 500000},
+	} {
+		input := productInput(product.sku, "cover")
+		input.Category = product.category
+		input.Price = product.price
+		api.createProduct(login.Token, input)
+	}
+
+	out := api.listProducts(url.Values{"category": {"clothes"}, "minPrice": {"10000"}, "sortBy": {"cheapest"}})
+	if skus := productSKUs(out.Data); !slices.Equal(skus, []string{"C2", "C3"}) || *out.Total != 2 {
+		t.Fatalf("expected C2 and C3, got %v", skus)
+	}
+
+	// The category facet ignores the category filter but keeps the price filter
+	if want := []models.CategoryFacet{{Category: "Clothes", Count: 2}, {Category: "Food", Count: 2}}; !slices.Equal(out.Facets.Categories, want) {
+		t.Fatalf("expected category facets %v, got %v", want, out.Facets.Categories)
+	}
+
+	// The price facet ignores the price filter but keeps the category filter
+	counts := make([]int64, 0, len(out.Facets.PriceBuckets))
+	for _, bucket := range out.Facets.PriceBuckets {
+		counts = append(counts, bucket.Count)
+	}
+	if want := []int64{1, 1, 1, 0, 0}; !slices.Equal(counts, want) {
+		t.Fatalf("expected price bucket counts %v, got %v", want, counts)
+	}
+	buckets := out.Facets.PriceBuckets
+	if buckets[0].Min != 0 || buckets[0].Max == nil || *buckets[0].Max != 9999 || buckets[1].Min != 10000 {
+		t.Fatalf("unexpected first buckets %+v, %+v", buckets[0], buckets[1])
+	}
+	if last := buckets[len(buckets)-1]; last.Min != 500000 || last.Max != nil {
+		t.Fatalf("expected the last bucket to be open ended, got %+v", last)
+	}
+
+	// Both categories, given repeated or comma separated, with an inclusive price range
+	for _, query := range []url.Values{
+		{"category": {"clothes", "food"}, "minPrice": {"10000"}, "maxPrice": {"20000"}},
+		{"category": {"Clothes,food"}, "minPrice": {"10000"}, "maxPrice": {"20000"}},
+	} {
+		query.Set("sortBy", "cheapest")
+		out = api.listProducts(query)
+		if skus := productSKUs(out.Data); !slices.Equal(skus, []string{"C2", "F1"}) {
+			t.Fatalf("expected C2 and F1 for %s, got %v", query.Encode(), skus)
+		}
+	}
+
+	for _, query := range []url.Values{
+		{"minPrice": {"20001"}, "maxPrice": {"20000"}},
+		{"minPrice": {"-1"}},
+		{"maxPrice": {"cheap"}},
+		{"category": {"weapons"}},
+		{"sellerId": {"someone"}},
+		{"createdAfter": {"yesterday"}},
+		{"attrMin[size]": {"large"}},
+	} {
+		expectStatus(t, api.request(http.MethodGet, "/v1/product/?"+query.Encode(), "", nil, nil), http.StatusBadRequest)
+	}
+}
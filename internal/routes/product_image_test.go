@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+// galleryFileIDs lists the images of a product response in order
+func galleryFileIDs(product models.ProductResponse) []string {
+	fileIDs := make([]string, 0, len(product.Images))
+	for _, image := range product.Images {
+		fileIDs = append(fileIDs, image.FileID)
+	}
+	return fileIDs
+}
+
+func expectGallery(t *testing.T, product models.ProductResponse, cover string, fileIDs ...string) {
+	t.Helper()
+	if product.FileID != cover {
+		t.Fatalf("expected cover %s, got %s", cover, product.FileID)
+	}
+	if got := galleryFileIDs(product); !reflect.DeepEqual(got, fileIDs) {
+		t.Fatalf("expected gallery %v, got %v", fileIDs, got)
+	}
+	for _, image := range product.Images {
+		if image.IsCover != (image.FileID == cover) {
+			t.Fatalf("expected only %s to be marked as cover, got %+v", cover, product.Images)
+		}
+	}
+}
+
+func updateInput(product models.ProductOutput, fileID string) models.UpdateProductRequest {
+	return models.UpdateProductRequest{
+		Name:     product.Name,
+		Category: product.Category,
+		Qty:      product.Quantity,
+		Price:    product.Price,
+		SKU:      product.SKU,
+		FileID:   fileID,
+	}
+}
+
+func TestProductGallery(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	for _, fileID := range []string{"a1", "a2", "a3"} {
+		api.upload(seller.ID, fileID)
+	}
+
+	input := productInput("SKU-1", "a1")
+	input.FileIDs = []string{"a2"}
+	created := api.createProduct(login.Token, input)
+	path := "/v1/product/" + created.ProductID + "/images"
+
+	var product models.ProductResponse
+	expectStatus(t, api.request(http.MethodPost, path, login.Token, models.AddProductImageRequest{FileID: "a3"}, &product), http.StatusOK)
+	expectGallery(t, product, "a1", "a1", "a2", "a3")
+	expectStatus(t, api.request(http.MethodPost, path, login.Token, models.AddProductImageRequest{FileID: "a3"}, nil), http.StatusConflict)
+
+	// Every image has to be named exactly once
+	reorder := models.ReorderProductImagesRequest{FileIDs: []string{"a3", "a1"}}
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, reorder, nil), http.StatusBadRequest)
+	reorder = models.ReorderProductImagesRequest{FileIDs: []string{"a3", "a1", "a1"}}
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, reorder, nil), http.StatusBadRequest)
+
+	reorder = models.ReorderProductImagesRequest{FileIDs: []string{"a3", "a1", "a2"}, CoverFileID: "a3"}
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, reorder, &product), http.StatusOK)
+	expectGallery(t, product, "a3", "a3", "a1", "a2")
+
+	// Removing the cover makes the next image the cover
+	expectStatus(t, api.request(http.MethodDelete, path+"/a3", login.Token, nil, &product), http.StatusOK)
+	expectGallery(t, product, "a1", "a1", "a2")
+	expectStatus(t, api.request(http.MethodDelete, path+"/a3", login.Token, nil, nil), http.StatusNotFound)
+
+	expectStatus(t, api.request(http.MethodDelete, path+"/a2", login.Token, nil, &product), http.StatusOK)
+	expectGallery(t, product, "a1", "a1")
+	expectStatus(t, api.request(http.MethodDelete, path+"/a1", login.Token, nil, nil), http.StatusBadRequest)
+}
+
+func TestProductGalleryOnlyTakesOwnFiles(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	api.upload(api.user("seller@example.com").ID, "mine")
+	other := api.registerEmail("other@example.com")
+	api.upload(api.user("other@example.com").ID, "theirs")
+
+	input := productInput("SKU-1", "theirs")
+	expectStatus(t, api.request(http.MethodPost, "/v1/product/", login.Token, input, nil), http.StatusBadRequest)
+	input = productInput("SKU-1", "mine")
+	input.FileIDs = []string{"theirs"}
+	expectStatus(t, api.request(http.MethodPost, "/v1/product/", login.Token, input, nil), http.StatusBadRequest)
+
+	created := api.createProduct(login.Token, productInput("SKU-1", "mine"))
+	path := "/v1/product/" + created.ProductID
+	expectStatus(t, api.request(http.MethodPost, path+"/images", login.Token, models.AddProductImageRequest{FileID: "theirs"}, nil), http.StatusBadRequest)
+
+	// A new cover is checked even when the gallery is left alone
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, updateInput(created, "theirs"), nil), http.StatusBadRequest)
+	var images int64
+	api.db.Model(&models.ProductImage{}).Where("file_id = ?", "theirs").Count(&images)
+	if images != 0 {
+		t.Fatal("expected another seller's upload to stay out of the gallery")
+	}
+
+	// Only the owner can change the gallery
+	expectStatus(t, api.request(http.MethodPost, path+"/images", other.Token, models.AddProductImageRequest{FileID: "theirs"}, nil), http.StatusNotFound)
+	expectStatus(t, api.request(http.MethodDelete, path+"/images/mine", other.Token, nil, nil), http.StatusNotFound)
+}
+
+func TestUpdateProductAddsNewCoverToGallery(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "a1")
+	api.upload(seller.ID, "a2")
+
+	created := api.createProduct(login.Token, productInput("SKU-1", "a1"))
+	path := "/v1/product/" + created.ProductID
+
+	// Without fileIds the gallery is kept and the new cover goes in front
+	var product models.ProductResponse
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, updateInput(created, "a2"), &product), http.StatusOK)
+	expectGallery(t, product, "a2", "a2", "a1")
+
+	// A cover already in the gallery is not added twice
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, updateInput(created, "a1"), &product), http.StatusOK)
+	expectGallery(t, product, "a1", "a2", "a1")
+
+	// fileIds replaces the gallery
+	update := updateInput(created, "a1")
+	update.FileIDs = []string{"a1"}
+	expectStatus(t, api.request(http.MethodPut, path, login.Token, update, &product), http.StatusOK)
+	expectGallery(t, product, "a1", "a1")
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+// listProducts fetches GET /v1/product with the given query
+func (a *testAPI) listProducts(query url.Values) models.ProductListResponse {
+	a.t.Helper()
+	var out models.ProductListResponse
+	expectStatus(a.t, a.request(http.MethodGet, "/v1/product/?"+query.Encode(), "", nil, &out), http.StatusOK)
+	return out
+}
+
+// productSKUs lists the SKUs of a product page in order
+func productSKUs(products []models.ProductOutput) []string {
+	skus := make([]string, 0, len(products))
+	for _, product := range products {
+		skus = append(skus, product.SKU)
+	}
+	return skus
+}
+
+func TestProductSearch(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "cover")
+
+	for sku, name := range map[string]string{
+		"POLOS":  "Kaos Polos",
+		"POLO":   "Kemeja Polo Pria",
+		"BATIK":  "Kemeja Batik",
+		"SEPATU": "Sepatu Lari",
+		"HTML":   `Kaos "Polos" & Co`,
+	} {
+		input := productInput(sku, "cover")
+		input.Name = name
+		api.createProduct(login.Token, input)
+	}
+
+	// A prefix of every word must match
+	page := api.listProducts(url.Values{"q": {"polo pri"}, "limit": {"10"}})
+	if skus := productSKUs(page.Data); len(skus) != 1 || skus[0] != "POLO" {
+		t.Fatalf("expected only the polo shirt, got %v", skus)
+	}
+	if page.Data[0].Highlight != "Kemeja <mark>Polo</mark> <mark>Pria</mark>" {
+		t.Fatalf("unexpected highlight %q", page.Data[0].Highlight)
+	}
+
+	// A typo still finds the product through the trigram match
+	page = api.listProducts(url.Values{"q": {"sepatuu"}})
+	if skus := productSKUs(page.Data); len(skus) != 1 || skus[0] != "SEPATU" {
+		t.Fatalf("expected the typo to find the shoes, got %v", skus)
+	}
+
+	// The closest name ranks first, and relevance is the default order for q
+	page = api.listProducts(url.Values{"q": {"kaos polos"}, "limit": {"10"}})
+	if skus := productSKUs(page.Data); len(skus) != 2 || skus[0] != "POLOS" || skus[1] != "HTML" {
+		t.Fatalf("expected the plain name first, got %v", skus)
+	}
+	if *page.Total != 2 {
+		t.Fatalf("expected a total of 2, got %d", *page.Total)
+	}
+	// The rest of the name is escaped around the matches
+	if got := page.Data[1].Highlight; got != "<mark>Kaos</mark> &#34;<mark>Polos</mark>&#34; &amp; Co" {
+		t.Fatalf("expected the name to be escaped, got %q", got)
+	}
+
+	// Another order still only returns matches
+	page = api.listProducts(url.Values{"q": {"kemeja"}, "sortBy": {"oldest"}})
+	if skus := productSKUs(page.Data); len(skus) != 2 || skus[0] == skus[1] {
+		t.Fatalf("expected both shirts, got %v", skus)
+	}
+
+	// Input that is no valid tsquery syntax is not an error
+	page = api.listProducts(url.Values{"q": {"&|!:*"}})
+	if len(page.Data) != 0 {
+		t.Fatalf("expected no matches, got %v", productSKUs(page.Data))
+	}
+
+	page = api.listProducts(url.Values{"limit": {"10"}})
+	if len(page.Data) != 5 || page.Data[0].Highlight != "" {
+		t.Fatalf("expected all 5 products without highlights, got %d", len(page.Data))
+	}
+}
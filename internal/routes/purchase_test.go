@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+func TestPurchaseReadRequiresScope(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+
+	apiKey := func(scope string) string {
+		var created models.CreateAPIKeyResponse
+		rec := api.request(http.MethodPost, "/v1/user/api-keys", login.Token, models.CreateAPIKeyRequest{Name: scope, Scopes: []string{scope}}, &created)
+		expectStatus(t, rec, http.StatusCreated)
+		return created.Key
+	}
+
+	expectStatus(t, api.request(http.MethodGet, "/v1/purchase/", apiKey(models.ScopePurchaseWrite), nil, nil), http.StatusForbidden)
+
+	var purchases []models.Purchase
+	expectStatus(t, api.request(http.MethodGet, "/v1/purchase/", apiKey(models.ScopePurchaseRead), nil, &purchases), http.StatusOK)
+	if len(purchases) != 0 {
+		t.Fatalf("expected no purchases, got %d", len(purchases))
+	}
+	expectStatus(t, api.request(http.MethodGet, "/v1/purchase/00000000-0000-0000-0000-000000000000", login.Token, nil, nil), http.StatusNotFound)
+}
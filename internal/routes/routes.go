@@ -3,20 +3,46 @@ package routes
 import (
 	"tutuplapak/internal/handlers"
 	"tutuplapak/internal/middleware"
+	"tutuplapak/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configures all the routes for the application
-func SetupRoutes(router *gin.Engine, healthHandler *handlers.HealthHandler, userHandler *handlers.UserHandler, registerHandler *handlers.RegisterHandler, loginHandler *handlers.LoginHandler, fileHandler *handlers.FileHandler, productHandler *handlers.ProductHandler, purchaseHandler *handlers.PurchaseHandler) {
+func SetupRoutes(router *gin.Engine, healthHandler *handlers.HealthHandler, userHandler *handlers.UserHandler, registerHandler *handlers.RegisterHandler, loginHandler *handlers.LoginHandler, fileHandler *handlers.FileHandler, productHandler *handlers.ProductHandler, purchaseHandler *handlers.PurchaseHandler, authHandler *handlers.AuthHandler, authenticator *middleware.Authenticator, jwksHandler *handlers.JWKSHandler, passwordResetHandler *handlers.PasswordResetHandler, twoFactorHandler *handlers.TwoFactorHandler, adminHandler *handlers.AdminHandler, apiKeyHandler *handlers.APIKeyHandler, auditHandler *handlers.AuditHandler, sessionHandler *handlers.SessionHandler, accountHandler *handlers.AccountHandler, oidcHandler *handlers.OIDCHandler, categoryHandler *handlers.CategoryHandler) {
+	// Public verification keys for services validating our access tokens
+	router.GET("/.well-known/jwks.json", jwksHandler.JWKS)
+
 	// API version 1
 	v1 := router.Group("/v1")
 	{
 		// Login & register routes
 		login := v1.Group("/login")
 		{
+			login.POST("", loginHandler.Login)
 			login.POST("/phone", loginHandler.LoginPhone)
 			login.POST("/email", loginHandler.LoginEmail)
+			login.POST("/2fa", loginHandler.LoginTwoFactor)
+
+			// External identity providers (OpenID Connect)
+			login.GET("/oidc", oidcHandler.Providers)
+			login.GET("/oidc/:provider", oidcHandler.Begin)
+			login.GET("/oidc/:provider/callback", oidcHandler.Callback)
+		}
+
+		// Token lifecycle routes
+		auth := v1.Group("/auth")
+		{
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", authenticator.IsAuthorized(), authHandler.Logout)
+			auth.POST("/logout/all", authenticator.IsAuthorized(), authHandler.LogoutAll)
+		}
+
+		// Forgotten password routes
+		password := v1.Group("/password")
+		{
+			password.POST("/reset", passwordResetHandler.RequestReset)
+			password.POST("/reset/confirm", passwordResetHandler.ConfirmReset)
 		}
 
 		register := v1.Group("/register")
@@ -34,12 +60,38 @@ func SetupRoutes(router *gin.Engine, healthHandler *handlers.HealthHandler, user
 
 		// User profile routes (auth required)
 		userAuth := v1.Group("/user")
-		userAuth.Use(middleware.IsAuthorized())
+		userAuth.Use(authenticator.IsAuthorized())
 		{
 			userAuth.GET("/", userHandler.GetUser)
 			userAuth.POST("/link/phone", userHandler.LinkPhone)
 			userAuth.POST("/link/email", userHandler.LinkEmail)
+			userAuth.POST("/link/phone/verify", userHandler.VerifyLinkPhone)
+			userAuth.POST("/link/email/verify", userHandler.VerifyLinkEmail)
+			userAuth.GET("/oidc", oidcHandler.ListIdentities)
+			userAuth.POST("/oidc/:provider/link", oidcHandler.BeginLink)
+			userAuth.POST("/oidc/:provider/reauth", oidcHandler.BeginReauth)
 			userAuth.PUT("/", userHandler.UpdateUser)
+			userAuth.PUT("/password", userHandler.ChangePassword)
+			userAuth.GET("/security-events", auditHandler.ListSecurityEvents)
+
+			// Personal data export and account deletion
+			userAuth.GET("/export", accountHandler.Export)
+			userAuth.DELETE("", accountHandler.Delete)
+
+			// Devices the user is logged in on
+			userAuth.GET("/sessions", sessionHandler.ListSessions)
+			userAuth.DELETE("/sessions/:sessionId", sessionHandler.RevokeSession)
+
+			// Two-factor authentication management
+			userAuth.POST("/2fa/enroll", twoFactorHandler.Enroll)
+			userAuth.POST("/2fa/activate", twoFactorHandler.Activate)
+			userAuth.POST("/2fa/disable", twoFactorHandler.Disable)
+			userAuth.POST("/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+
+			// API keys for integrations, managed with an access token only
+			userAuth.GET("/api-keys", apiKeyHandler.List)
+			userAuth.POST("/api-keys", apiKeyHandler.Create)
+			userAuth.DELETE("/api-keys/:keyId", apiKeyHandler.Revoke)
 		}
 
 		// File upload routes
@@ -54,20 +106,54 @@ func SetupRoutes(router *gin.Engine, healthHandler *handlers.HealthHandler, user
 			// Public endpoint - no auth required
 			product.GET("/", productHandler.GetProducts)
 
-			// Protected endpoints - auth required
-			product.Use(middleware.IsAuthorized())
-			{
-				product.POST("/", productHandler.CreateProduct)
-				product.PUT("/:productId", productHandler.UpdateProduct)
-				product.DELETE("/:productId", productHandler.DeleteProduct)
-			}
+			// Protected endpoints - auth required, API keys need product:write
+			productWrite := authenticator.IsAuthorized(models.ScopeProductWrite)
+			product.POST("/", productWrite, productHandler.CreateProduct)
+			product.PUT("/:productId", productWrite, productHandler.UpdateProduct)
+			product.DELETE("/:productId", productWrite, productHandler.DeleteProduct)
+
+			// Archived and deleted products stay in purchase history and can be restored
+			product.GET("/archived", productWrite, productHandler.ListArchivedProducts)
+			product.POST("/:productId/archive", productWrite, productHandler.ArchiveProduct)
+			product.POST("/:productId/restore", productWrite, productHandler.RestoreProduct)
+
+			// CSV and XLSX imports run in the background; poll the import for progress
+			product.POST("/import", productWrite, productHandler.ImportProducts)
+			product.GET("/import/:importId", productWrite, productHandler.GetProductImport)
+			product.GET("/import/:importId/errors", productWrite, productHandler.GetProductImportErrors)
+
+			// Image gallery; the cover is also the product's own fileId
+			product.POST("/:productId/images", productWrite, productHandler.AddProductImage)
+			product.PUT("/:productId/images", productWrite, productHandler.ReorderProductImages)
+			product.DELETE("/:productId/images/:fileId", productWrite, productHandler.RemoveProductImage)
+		}
+
+		// Public category tree
+		v1.GET("/category", categoryHandler.List)
+
+		// Back-office routes, each guarded by the permission it needs
+		admin := v1.Group("/admin")
+		admin.Use(authenticator.IsAuthorized())
+		{
+			admin.GET("/users/:userId", middleware.RequirePermission(models.PermissionUsersRead), adminHandler.GetUser)
+			admin.PUT("/users/:userId/roles", middleware.RequirePermission(models.PermissionRolesManage), adminHandler.SetUserRoles)
+
+			manageCategories := middleware.RequirePermission(models.PermissionCategoriesManage)
+			admin.POST("/categories", manageCategories, categoryHandler.Create)
+			admin.PUT("/categories/:categoryId", manageCategories, categoryHandler.Update)
+			admin.DELETE("/categories/:categoryId", manageCategories, categoryHandler.Delete)
 		}
 
 		purchase := v1.Group("/purchase")
-		purchase.Use(middleware.IsAuthorized())
 		{
-			purchase.POST("/", purchaseHandler.PurchaseProducts)
-			purchase.POST("/:purchaseId", purchaseHandler.ProcessPurchase)
+			purchaseWrite := authenticator.IsAuthorized(models.ScopePurchaseWrite)
+			purchase.POST("/", purchaseWrite, purchaseHandler.PurchaseProducts)
+			purchase.POST("/:purchaseId", purchaseWrite, purchaseHandler.ProcessPurchase)
+
+			// Orders for the caller's products, API keys need purchase:read
+			purchaseRead := authenticator.IsAuthorized(models.ScopePurchaseRead)
+			purchase.GET("/", purchaseRead, purchaseHandler.ListPurchases)
+			purchase.GET("/:purchaseId", purchaseRead, purchaseHandler.GetPurchase)
 		}
 	}
 
@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+// loginDevice logs a user in again from a named device
+func (a *testAPI) loginDevice(email, deviceID, deviceName string) models.LoginPhoneOutput {
+	a.t.Helper()
+	body, err := json.Marshal(models.LoginEmailInput{Email: email, Password: testPassword, DeviceID: deviceID})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/login/email", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Name", deviceName)
+	req.Header.Set("User-Agent", deviceName+" browser")
+	var out models.LoginPhoneOutput
+	expectStatus(a.t, a.serve(req, &out), http.StatusOK)
+	return out
+}
+
+// sessions lists the sessions of the token's user by device ID
+func (a *testAPI) sessions(token string) map[string]models.SessionResponse {
+	a.t.Helper()
+	var list []models.SessionResponse
+	expectStatus(a.t, a.request(http.MethodGet, "/v1/user/sessions", token, nil, &list), http.StatusOK)
+	sessions := make(map[string]models.SessionResponse, len(list))
+	for _, session := range list {
+		sessions[session.DeviceID] = session
+	}
+	return sessions
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	api := newTestAPI(t)
+	api.registerEmail("buyer@example.com")
+	laptop := api.loginDevice("buyer@example.com", "laptop", "Laptop")
+	phone := api.loginDevice("buyer@example.com", "phone", "Phone")
+	other := api.registerEmail("other@example.com")
+
+	sessions := api.sessions(laptop.Token)
+	if len(sessions) != 3 {
+		t.Fatalf("expected the registration and two device sessions, got %d", len(sessions))
+	}
+	current, ok := sessions["laptop"]
+	if !ok || !current.Current || current.DeviceName != "Laptop" || current.UserAgent != "Laptop browser" || current.IP == "" {
+		t.Fatalf("expected the laptop session to be current with its device details, got %+v", current)
+	}
+	if sessions["phone"].Current || sessions["phone"].DeviceName != "Phone" {
+		t.Fatalf("expected the phone session not to be current, got %+v", sessions["phone"])
+	}
+	if _, ok := api.sessions(other.Token)["laptop"]; ok {
+		t.Fatal("expected another user not to see the laptop session")
+	}
+
+	// Another user cannot revoke the session, and IDs must be UUIDs
+	phonePath := "/v1/user/sessions/" + sessions["phone"].ID
+	expectStatus(t, api.request(http.MethodDelete, phonePath, other.Token, nil, nil), http.StatusNotFound)
+	expectStatus(t, api.request(http.MethodDelete, "/v1/user/sessions/phone", laptop.Token, nil, nil), http.StatusBadRequest)
+
+	expectStatus(t, api.request(http.MethodDelete, phonePath, laptop.Token, nil, nil), http.StatusOK)
+	expectStatus(t, api.request(http.MethodGet, "/v1/user/", phone.Token, nil, nil), http.StatusUnauthorized)
+	refresh := models.RefreshTokenRequest{RefreshToken: phone.RefreshToken, DeviceID: phone.DeviceID}
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/refresh", "", refresh, nil), http.StatusUnauthorized)
+	if _, ok := api.sessions(laptop.Token)["phone"]; ok {
+		t.Fatal("expected the revoked session to be gone from the list")
+	}
+
+	var events []models.AuditEvent
+	api.db.Where("type = ?", models.AuditSessionRevoked).Find(&events)
+	if len(events) == 0 {
+		t.Fatal("expected the revocation to be audited")
+	}
+}
+
+func TestPasswordChangeRevokesOtherSessions(t *testing.T) {
+	api := newTestAPI(t)
+	first := api.registerEmail("buyer@example.com")
+	laptop := api.loginDevice("buyer@example.com", "laptop", "Laptop")
+	phone := api.loginDevice("buyer@example.com", "phone", "Phone")
+
+	var out models.APIResponse
+	change := models.ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: "newpassword1"}
+	expectStatus(t, api.request(http.MethodPut, "/v1/user/password", laptop.Token, change, &out), http.StatusOK)
+	if revoked := out.Data.(map[string]any)["revokedSessions"]; revoked != float64(2) {
+		t.Fatalf("expected 2 revoked sessions, got %v", revoked)
+	}
+
+	for _, login := range []models.LoginPhoneOutput{first, phone} {
+		expectStatus(t, api.request(http.MethodGet, "/v1/user/", login.Token, nil, nil), http.StatusUnauthorized)
+	}
+
+	// The session the password was changed from stays logged in
+	sessions := api.sessions(laptop.Token)
+	if len(sessions) != 1 || !sessions["laptop"].Current {
+		t.Fatalf("expected only the current session to remain, got %+v", sessions)
+	}
+	refresh := models.RefreshTokenRequest{RefreshToken: laptop.RefreshToken, DeviceID: laptop.DeviceID}
+	expectStatus(t, api.request(http.MethodPost, "/v1/auth/refresh", "", refresh, nil), http.StatusOK)
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+)
+
+// enableTwoFactor enrolls and activates TOTP for the user of the access
+// token, returning the secret and the recovery codes
+func (a *testAPI) enableTwoFactor(token string) (string, []string) {
+	a.t.Helper()
+	var enrollment models.TwoFactorEnrollResponse
+	expectStatus(a.t, a.request(http.MethodPost, "/v1/user/2fa/enroll", token, nil, &enrollment), http.StatusOK)
+
+	var recovery models.RecoveryCodesResponse
+	activate := models.TwoFactorCodeRequest{Code: currentCode(a.t, enrollment.Secret)}
+	expectStatus(a.t, a.request(http.MethodPost, "/v1/user/2fa/activate", token, activate, &recovery), http.StatusOK)
+	if len(recovery.RecoveryCodes) == 0 {
+		a.t.Fatal("expected recovery codes")
+	}
+	return enrollment.Secret, recovery.RecoveryCodes
+}
+
+// challenge logs in with the password and returns the second factor challenge
+func (a *testAPI) challenge(email string) string {
+	a.t.Helper()
+	var challenge models.TwoFactorChallengeResponse
+	rec := a.request(http.MethodPost, "/v1/login", "", models.LoginInput{Identifier: email, Password: testPassword}, &challenge)
+	expectStatus(a.t, rec, http.StatusOK)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		a.t.Fatalf("expected a two-factor challenge, got %s", rec.Body.String())
+	}
+	return challenge.ChallengeToken
+}
+
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := utils.TOTPCode(secret, time.Now().Unix()/utils.TOTPPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// wrongCode returns a code that is not accepted in any step of the skew window
+func wrongCode(t *testing.T, secret string) string {
+	t.Helper()
+	step := time.Now().Unix() / utils.TOTPPeriod
+	valid := make(map[string]bool)
+	for offset := int64(-2); offset <= 2; offset++ {
+		code, err := utils.TOTPCode(secret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid[code] = true
+	}
+	for i := 0; ; i++ {
+		if code := fmt.Sprintf("%06d", i); !valid[code] {
+			return code
+		}
+	}
+}
+
+func TestLoginThrottleKeptUntilSecondFactor(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("buyer@example.com")
+	secret, _ := api.enableTwoFactor(login.Token)
+	identifier := "email:buyer@example.com"
+
+	rec := api.request(http.MethodPost, "/v1/login", "", models.LoginInput{Identifier: "buyer@example.com", Password: "wrongpassword"}, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	// The password alone does not clear the failures
+	challenge := api.challenge("buyer@example.com")
+	var throttle models.LoginThrottle
+	if err := api.db.Where("identifier = ?", identifier).First(&throttle).Error; err != nil {
+		t.Fatalf("expected the throttle to survive the password step: %v", err)
+	}
+	if throttle.FailedCount != 1 {
+		t.Fatalf("expected 1 failure, got %d", throttle.FailedCount)
+	}
+
+	complete := models.LoginTwoFactorRequest{ChallengeToken: challenge, Code: currentCode(t, secret)}
+	expectStatus(t, api.request(http.MethodPost, "/v1/login/2fa", "", complete, nil), http.StatusOK)
+
+	var remaining int64
+	api.db.Model(&models.LoginThrottle{}).Where("identifier = ?", identifier).Count(&remaining)
+	if remaining != 0 {
+		t.Fatal("expected the throttle to be cleared once the second factor passed")
+	}
+}
+
+func TestTwoFactorLockoutAfterFailedCodes(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.TwoFactor.MaxAttempts = 2
+		cfg.TwoFactor.MaxFailures = 3
+	})
+	login := api.registerEmail("buyer@example.com")
+	secret, _ := api.enableTwoFactor(login.Token)
+
+	// Failures are counted per user, across challenges
+	for i := 0; i < 3; i++ {
+		complete := models.LoginTwoFactorRequest{ChallengeToken: api.challenge("buyer@example.com"), Code: wrongCode(t, secret)}
+		expectStatus(t, api.request(http.MethodPost, "/v1/login/2fa", "", complete, nil), http.StatusUnauthorized)
+	}
+
+	complete := models.LoginTwoFactorRequest{ChallengeToken: api.challenge("buyer@example.com"), Code: currentCode(t, secret)}
+	rec := api.request(http.MethodPost, "/v1/login/2fa", "", complete, nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+
+	var events int64
+	api.db.Model(&models.AuditEvent{}).
+		Where("type = ? AND user_id = ?", models.AuditLoginTwoFactorFailed, api.user("buyer@example.com").ID).
+		Count(&events)
+	if events != 4 {
+		t.Fatalf("expected the failed codes and the locked attempt to be audited for the user, got %d", events)
+	}
+}
+
+func TestRecoveryCodeIsSingleUse(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("buyer@example.com")
+	_, codes := api.enableTwoFactor(login.Token)
+
+	complete := models.LoginTwoFactorRequest{ChallengeToken: api.challenge("buyer@example.com"), RecoveryCode: codes[0]}
+	expectStatus(t, api.request(http.MethodPost, "/v1/login/2fa", "", complete, nil), http.StatusOK)
+
+	complete = models.LoginTwoFactorRequest{ChallengeToken: api.challenge("buyer@example.com"), RecoveryCode: codes[0]}
+	expectStatus(t, api.request(http.MethodPost, "/v1/login/2fa", "", complete, nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,216 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+// variantInput is a product sold in sizes S and M, with L offered but not stocked
+func variantInput(sku, fileID string) models.ProductInput {
+	input := productInput(sku, fileID)
+	input.Qty, input.Price = 0, 0
+	input.Options = []models.ProductOption{{Name: "size", Values: []string{"S", "M", "L"}}}
+	input.Variants = []models.ProductVariantInput{
+		{SKU: sku + "-S", Options: map[string]string{"size": "S"}, Qty: 3, Price: 12000},
+		{SKU: sku + "-M", Options: map[string]string{"size": "M"}, Qty: 2, Price: 10000},
+	}
+	return input
+}
+
+// purchase buys the items with the given token
+func (a *testAPI) purchase(token string, items ...models.PurchasedItems) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.request(http.MethodPost, "/v1/purchase/", token, models.PurchaseRequest{
+		PurchasedItems:      items,
+		SenderName:          "Pembeli",
+		SenderContactType:   models.ContactTypeEmail,
+		SenderContactDetail: "buyer@example.com",
+	}, nil)
+}
+
+// variantQty loads the stock of a variant straight from the database
+func (a *testAPI) variantQty(id uint) uint {
+	a.t.Helper()
+	var variant models.ProductVariant
+	if err := a.db.First(&variant, id).Error; err != nil {
+		a.t.Fatalf("load variant %d: %v", id, err)
+	}
+	return variant.Qty
+}
+
+// productQty loads the stock of a product straight from the database
+func (a *testAPI) productQty(productID string) uint {
+	a.t.Helper()
+	var product models.Product
+	if err := a.db.First(&product, productID).Error; err != nil {
+		a.t.Fatalf("load product %s: %v", productID, err)
+	}
+	return product.Qty
+}
+
+func TestProductVariants(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "cover")
+
+	created := api.createProduct(login.Token, variantInput("KAOS", "cover"))
+	if created.Quantity != 5 || created.Price != 10000 {
+		t.Fatalf("expected the summed stock 5 and lowest price 10000, got %d and %d", created.Quantity, created.Price)
+	}
+	if len(created.Variants) != 2 {
+		t.Fatalf("expected 2 variants, got %d", len(created.Variants))
+	}
+	small, medium := created.Variants[0], created.Variants[1]
+	if small.SKU != "KAOS-S" || medium.SKU != "KAOS-M" {
+		t.Fatalf("expected the variants in input order, got %s and %s", small.SKU, medium.SKU)
+	}
+
+	duplicateSKU := variantInput("DUP", "cover")
+	duplicateSKU.Variants[1].SKU = duplicateSKU.Variants[0].SKU
+	expectStatus(t, api.request(http.MethodPost, "/v1/product/", login.Token, duplicateSKU, nil), http.StatusBadRequest)
+
+	unknownValue := variantInput("XL", "cover")
+	unknownValue.Variants[1].Options = map[string]string{"size": "XL"}
+	expectStatus(t, api.request(http.MethodPost, "/v1/product/", login.Token, unknownValue, nil), http.StatusBadRequest)
+
+	repeated := variantInput("REP", "cover")
+	repeated.Variants[1].Options = map[string]string{"size": "S"}
+	expectStatus(t, api.request(http.MethodPost, "/v1/product/", login.Token, repeated, nil), http.StatusBadRequest)
+
+	taken := variantInput("OTHER", "cover")
+	taken.Variants[0].SKU = "KAOS-S"
+	expectStatus(t, api.request(http.MethodPost, "/v1/product/", login.Token, taken, nil), http.StatusConflict)
+
+	// Keep S with new stock, drop M and add L
+	update := updateInput(created, "cover")
+	update.Qty, update.Price = 0, 0
+	update.Options = []models.ProductOption{{Name: "size", Values: []string{"S", "M", "L"}}}
+	update.Variants = []models.ProductVariantInput{
+		{VariantID: &small.ID, SKU: "KAOS-S", Options: map[string]string{"size": "S"}, Qty: 4, Price: 12000},
+		{SKU: "KAOS-L", Options: map[string]string{"size": "L"}, Qty: 1, Price: 15000},
+	}
+	var updated models.ProductResponse
+	expectStatus(t, api.request(http.MethodPut, "/v1/product/"+created.ProductID, login.Token, update, &updated), http.StatusOK)
+	if updated.Qty != 5 || updated.Price != 12000 {
+		t.Fatalf("expected the summed stock 5 and lowest price 12000, got %d and %d", updated.Qty, updated.Price)
+	}
+	if len(updated.Variants) != 2 || updated.Variants[0].ID != small.ID || updated.Variants[0].Qty != 4 || updated.Variants[1].SKU != "KAOS-L" {
+		t.Fatalf("expected S kept with stock 4 and L added, got %+v", updated.Variants)
+	}
+	var removed int64
+	api.db.Model(&models.ProductVariant{}).Where("id = ?", medium.ID).Count(&removed)
+	if removed != 0 {
+		t.Fatal("expected the left out variant to be deleted")
+	}
+
+	// A variant ID of another product cannot be taken over
+	other := api.createProduct(login.Token, variantInput("LAIN", "cover"))
+	update.Variants[1].VariantID = &other.Variants[0].ID
+	expectStatus(t, api.request(http.MethodPut, "/v1/product/"+created.ProductID, login.Token, update, nil), http.StatusBadRequest)
+
+	// Dropping the variants turns it back into a plain product
+	plain := updateInput(created, "cover")
+	plain.Qty, plain.Price = 7, 9000
+	expectStatus(t, api.request(http.MethodPut, "/v1/product/"+created.ProductID, login.Token, plain, &updated), http.StatusOK)
+	if len(updated.Variants) != 0 || updated.Qty != 7 {
+		t.Fatalf("expected a plain product with stock 7, got %d variants and stock %d", len(updated.Variants), updated.Qty)
+	}
+}
+
+func TestPurchaseDecrementsVariantStock(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "cover")
+	buyer := api.registerEmail("buyer@example.com")
+
+	product := api.createProduct(login.Token, variantInput("KAOS", "cover"))
+	small, medium := product.Variants[0], product.Variants[1]
+	smallID := strconv.FormatUint(uint64(small.ID), 10)
+	mediumID := strconv.FormatUint(uint64(medium.ID), 10)
+
+	expectStatus(t, api.purchase(buyer.Token, models.PurchasedItems{ProductID: product.ProductID, Quantity: 2}), http.StatusBadRequest)
+
+	other := api.createProduct(login.Token, variantInput("LAIN", "cover"))
+	otherID := strconv.FormatUint(uint64(other.Variants[0].ID), 10)
+	expectStatus(t, api.purchase(buyer.Token, models.PurchasedItems{ProductID: product.ProductID, VariantID: otherID, Quantity: 2}), http.StatusBadRequest)
+
+	expectStatus(t, api.purchase(buyer.Token, models.PurchasedItems{ProductID: product.ProductID, VariantID: smallID, Quantity: 2}), http.StatusCreated)
+	if qty := api.variantQty(small.ID); qty != 1 {
+		t.Fatalf("expected variant S to have 1 left, got %d", qty)
+	}
+	if qty := api.variantQty(medium.ID); qty != 2 {
+		t.Fatalf("expected variant M to keep 2, got %d", qty)
+	}
+	if qty := api.productQty(product.ProductID); qty != 3 {
+		t.Fatalf("expected the product to have 3 left, got %d", qty)
+	}
+
+	// Only one S is left, and a failed purchase changes no stock
+	expectStatus(t, api.purchase(buyer.Token,
+		models.PurchasedItems{ProductID: product.ProductID, VariantID: mediumID, Quantity: 2},
+		models.PurchasedItems{ProductID: product.ProductID, VariantID: smallID, Quantity: 2},
+	), http.StatusBadRequest)
+	if qty := api.variantQty(medium.ID); qty != 2 {
+		t.Fatalf("expected variant M to keep 2 after the failed purchase, got %d", qty)
+	}
+	if qty := api.productQty(product.ProductID); qty != 3 {
+		t.Fatalf("expected the product to keep 3 after the failed purchase, got %d", qty)
+	}
+}
+
+func TestConcurrentPurchasesDoNotOversell(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("seller@example.com")
+	seller := api.user("seller@example.com")
+	api.upload(seller.ID, "cover")
+	buyer := api.registerEmail("buyer@example.com")
+
+	input := productInput("KAOS", "cover")
+	input.Qty = 2
+	plain := api.createProduct(login.Token, input)
+	variants := api.createProduct(login.Token, variantInput("VAR", "cover"))
+	mediumID := strconv.FormatUint(uint64(variants.Variants[1].ID), 10)
+
+	for _, item := range []models.PurchasedItems{
+		{ProductID: plain.ProductID, Quantity: 2},
+		{ProductID: variants.ProductID, VariantID: mediumID, Quantity: 2},
+	} {
+		codes := make([]int, 5)
+		var wg sync.WaitGroup
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = api.purchase(buyer.Token, item).Code
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, code := range codes {
+			switch code {
+			case http.StatusCreated:
+				succeeded++
+			case http.StatusBadRequest:
+			default:
+				t.Fatalf("unexpected status %d", code)
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("expected exactly one purchase of the last 2 items of %s to succeed, got %d", item.ProductID, succeeded)
+		}
+	}
+	if qty := api.productQty(plain.ProductID); qty != 0 {
+		t.Fatalf("expected the plain product to be sold out, got %d", qty)
+	}
+	if qty := api.variantQty(variants.Variants[1].ID); qty != 0 {
+		t.Fatalf("expected variant M to be sold out, got %d", qty)
+	}
+}
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+)
+
+func TestLinkEmailCooldown(t *testing.T) {
+	api := newTestAPI(t)
+	login := api.registerEmail("buyer@example.com")
+	link := models.LinkEmailRequest{Email: "buyer@example.org"}
+
+	expectStatus(t, api.request(http.MethodPost, "/v1/user/link/email", login.Token, link, nil), http.StatusAccepted)
+	rec := api.request(http.MethodPost, "/v1/user/link/email", login.Token, link, nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+}
+
+func TestLinkEmailFailedSendDoesNotStartCooldown(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		// The outbox is a directory, so every send fails
+		cfg.Notification.OutboxPath = t.TempDir()
+	})
+	login := api.registerEmail("buyer@example.com")
+	link := models.LinkEmailRequest{Email: "buyer@example.org"}
+
+	expectStatus(t, api.request(http.MethodPost, "/v1/user/link/email", login.Token, link, nil), http.StatusInternalServerError)
+	var pending int64
+	api.db.Model(&models.ContactVerification{}).Count(&pending)
+	if pending != 0 {
+		t.Fatalf("expected no verification to be saved, got %d", pending)
+	}
+
+	// The retry is not held back by a code that never went out
+	expectStatus(t, api.request(http.MethodPost, "/v1/user/link/email", login.Token, link, nil), http.StatusInternalServerError)
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"tutuplapak/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type AccessService struct {
+	db *gorm.DB
+}
+
+func NewAccessService(db *gorm.DB) *AccessService {
+	return &AccessService{db: db}
+}
+
+// Resolve returns the roles of the user and the permissions they grant
+func (s *AccessService) Resolve(userID uint) (models.Access, error) {
+	var userRoles []models.UserRole
+	if err := s.db.Where("user_id = ?", userID).Find(&userRoles).Error; err != nil {
+		return models.Access{}, err
+	}
+
+	access := models.Access{Roles: []string{}, Permissions: []string{}}
+	seen := make(map[string]bool)
+	for _, userRole := range userRoles {
+		access.Roles = append(access.Roles, string(userRole.Role))
+		for _, permission := range models.RolePermissions[userRole.Role] {
+			if !seen[permission] {
+				seen[permission] = true
+				access.Permissions = append(access.Permissions, permission)
+			}
+		}
+	}
+	sort.Strings(access.Roles)
+	sort.Strings(access.Permissions)
+
+	return access, nil
+}
+
+// SetRoles replaces every role of the user
+func (s *AccessService) SetRoles(userID uint, roles []models.Role, grantedBy *uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+
+		seen := make(map[models.Role]bool)
+		now := time.Now()
+		for _, role := range roles {
+			if seen[role] {
+				continue
+			}
+			seen[role] = true
+
+			if err := tx.Create(&models.UserRole{
+				UserID:    userID,
+				Role:      role,
+				GrantedBy: grantedBy,
+				CreatedAt: now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Grant adds a single role to the user, keeping the existing ones
+func (s *AccessService) Grant(userID uint, role models.Role, grantedBy *uint) error {
+	var count int64
+	if err := s.db.Model(&models.UserRole{}).Where("user_id = ? AND role = ?", userID, role).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return s.db.Create(&models.UserRole{
+		UserID:    userID,
+		Role:      role,
+		GrantedBy: grantedBy,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// HasAdmin reports whether any user holds the admin role
+func (s *AccessService) HasAdmin() (bool, error) {
+	var count int64
+	err := s.db.Model(&models.UserRole{}).Where("role = ?", models.RoleAdmin).Count(&count).Error
+	return count > 0, err
+}
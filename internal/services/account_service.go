@@ -0,0 +1,368 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// deletedUserName replaces the name of an anonymized account
+const deletedUserName = "Deleted user"
+
+// unusablePassword is stored for anonymized accounts; it is never a valid hash
+const unusablePassword = "!"
+
+// AccountService exports and deletes a user's personal data
+type AccountService struct {
+	db            *gorm.DB
+	refreshTokens *RefreshTokenService
+}
+
+func NewAccountService(db *gorm.DB, refreshTokens *RefreshTokenService) *AccountService {
+	return &AccountService{
+		db:            db,
+		refreshTokens: refreshTokens,
+	}
+}
+
+// Export collects the user's profile, products, uploaded files and purchases
+func (s *AccountService) Export(userID uint) (*models.AccountExport, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	export := &models.AccountExport{
+		ExportedAt: time.Now(),
+		Profile: models.AccountExportProfile{
+			ID:                user.ID,
+			Name:              user.Name,
+			Email:             user.Email,
+			Phone:             user.Phone,
+			FileID:            user.FileID,
+			FileURI:           user.FileURI,
+			BankAccountName:   user.BankAccountName,
+			BankAccountHolder: user.BankAccountHolder,
+			BankAccountNumber: user.BankAccountNumber,
+			CreatedAt:         user.CreatedAt,
+			UpdatedAt:         user.UpdatedAt,
+		},
+		Products: []models.Product{},
+		Files:    []models.FileUpload{},
+		Purchases: models.AccountExportPurchase{
+			AsBuyer:  []models.Purchase{},
+			AsSeller: []models.Purchase{},
+		},
+	}
+
+	if err := s.db.Preload("Variants").Preload("Images").Where("user_id = ?", userID).Order("id").Find(&export.Products).Error; err != nil {
+		return nil, err
+	}
+
+	fileIDs := ownedFileIDs(&user, export.Products)
+	if err := s.db.Where("user_id = ? OR file_id IN ?", userID, nonEmpty(fileIDs)).
+		Order("created_at").Find(&export.Files).Error; err != nil {
+		return nil, err
+	}
+
+	sellerPurchases := s.db.Model(&models.PurchaseItem{}).
+		Select("purchase_items.purchase_id").
+		Joins("JOIN products ON products.id = purchase_items.product_id").
+		Where("products.user_id = ?", userID)
+	if err := s.db.Preload("PurchaseItems").
+		Where("id IN (?)", sellerPurchases).
+		Order("created_at").Find(&export.Purchases.AsSeller).Error; err != nil {
+		return nil, err
+	}
+
+	// Purchases carry no buyer account, only the contact details given at checkout
+	buyer := s.db.Where("1 = 0")
+	if user.Email != "" {
+		buyer = buyer.Or("sender_contact_type = ? AND sender_contact_detail = ?", models.ContactTypeEmail, user.Email)
+	}
+	if user.Phone != "" {
+		buyer = buyer.Or("sender_contact_type = ? AND sender_contact_detail = ?", models.ContactTypePhone, user.Phone)
+	}
+	if err := s.db.Preload("PurchaseItems").Where(buyer).
+		Order("created_at").Find(&export.Purchases.AsBuyer).Error; err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// Delete anonymizes the account: personal data is removed from the user row,
+// products are deactivated but kept for the purchase history of other users,
+// credentials are revoked and the user's files are queued for removal from
+// object storage.
+func (s *AccountService) Delete(userID uint) (int, error) {
+	now := time.Now()
+	scheduled := 0
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var products []models.Product
+		if err := tx.Preload("Variants").Preload("Images").Where("user_id = ?", userID).Find(&products).Error; err != nil {
+			return err
+		}
+
+		fileIDs, err := deletableFileIDs(tx, &user, products)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Product{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]any{
+				"is_active":          false,
+				"file_uri":           "",
+				"file_thumbnail_uri": "",
+			}).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{&models.ProductVariant{}, &models.ProductImage{}} {
+			if err := tx.Model(model).
+				Where("product_id IN (?)", tx.Model(&models.Product{}).Select("id").Where("user_id = ?", userID)).
+				Updates(map[string]any{
+					"file_uri":           "",
+					"file_thumbnail_uri": "",
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&user).Updates(map[string]any{
+			"name":                deletedUserName,
+			"email":               nil,
+			"phone":               nil,
+			"password":            unusablePassword,
+			"file_id":             "",
+			"file_uri":            "",
+			"file_thumbnail_uri":  "",
+			"bank_account_name":   "",
+			"bank_account_holder": "",
+			"bank_account_number": "",
+			"image_uri":           "",
+			"email_verified_at":   nil,
+			"anonymized_at":       now,
+		}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []any{
+			&models.TwoFactor{},
+			&models.RecoveryCode{},
+			&models.LoginChallenge{},
+			&models.ContactVerification{},
+			&models.PasswordResetToken{},
+			&models.UserRole{},
+			&models.OIDCIdentity{},
+			&models.ReauthToken{},
+			&models.ProductImport{},
+		} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.APIKey{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := scrubActivity(tx, &user); err != nil {
+			return err
+		}
+
+		for _, fileID := range fileIDs {
+			result := tx.Where("file_id = ?", fileID).
+				FirstOrCreate(&models.FileDeletion{
+					FileID:   fileID,
+					UserID:   &userID,
+					RunAfter: now,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			scheduled += int(result.RowsAffected)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.refreshTokens.RevokeAllSessions(userID); err != nil {
+		return scheduled, err
+	}
+
+	return scheduled, nil
+}
+
+// scrubActivity removes where and from what the user logged in: session
+// devices, login attempts and throttles, password reset requests, and the IP, user agent and contact
+// details of audit events about the user or naming the user's contacts.
+// The audit events themselves are kept.
+func scrubActivity(tx *gorm.DB, user *models.User) error {
+	var contacts, identifiers []string
+	if user.Email != "" {
+		contacts = append(contacts, user.Email)
+		identifiers = append(identifiers, string(models.ContactTypeEmail)+":"+user.Email)
+	}
+	if user.Phone != "" {
+		contacts = append(contacts, user.Phone)
+		identifiers = append(identifiers, string(models.ContactTypePhone)+":"+user.Phone)
+	}
+
+	if err := tx.Model(&models.Session{}).
+		Where("user_id = ?", user.ID).
+		Updates(map[string]any{
+			"device_name": "",
+			"ip":          "",
+			"user_agent":  "",
+		}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("user_id = ? OR identifier IN ?", user.ID, nonEmpty(identifiers)).
+		Delete(&models.LoginAttempt{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("identifier IN ?", nonEmpty(identifiers)).
+		Delete(&models.LoginThrottle{}).Error; err != nil {
+		return err
+	}
+	contactHashes := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		contactHashes[i] = utils.HashToken(identifier)
+	}
+	if err := tx.Where("contact_hash IN ?", nonEmpty(contactHashes)).
+		Delete(&models.PasswordResetAttempt{}).Error; err != nil {
+		return err
+	}
+
+	// payload - 'a' - 'b' drops each personal key
+	payload := "payload" + strings.Repeat(" - ?::text", len(models.AuditPersonalPayloadKeys))
+	keys := make([]any, len(models.AuditPersonalPayloadKeys))
+	for i, key := range models.AuditPersonalPayloadKeys {
+		keys[i] = key
+	}
+
+	return tx.Model(&models.AuditEvent{}).
+		Where("user_id = ? OR actor_id = ? OR payload->>'identifier' IN ? OR payload->>'target' IN ?",
+			user.ID, user.ID, nonEmpty(identifiers), nonEmpty(contacts)).
+		Updates(map[string]any{
+			"ip":         "",
+			"user_agent": "",
+			"payload":    gorm.Expr(payload, keys...),
+		}).Error
+}
+
+// deletableFileIDs returns the user's files that no other account still refers to
+func deletableFileIDs(tx *gorm.DB, user *models.User, products []models.Product) ([]string, error) {
+	candidates := ownedFileIDs(user, products)
+
+	var uploaded []string
+	if err := tx.Model(&models.FileUpload{}).
+		Where("user_id = ?", user.ID).
+		Pluck("file_id", &uploaded).Error; err != nil {
+		return nil, err
+	}
+	candidates = appendUnique(candidates, uploaded...)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var shared []string
+	if err := tx.Model(&models.Product{}).
+		Where("user_id <> ? AND file_id IN ?", user.ID, candidates).
+		Distinct().Pluck("file_id", &shared).Error; err != nil {
+		return nil, err
+	}
+	var sharedVariants []string
+	if err := tx.Model(&models.ProductVariant{}).
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Where("products.user_id <> ? AND product_variants.file_id IN ?", user.ID, candidates).
+		Distinct().Pluck("product_variants.file_id", &sharedVariants).Error; err != nil {
+		return nil, err
+	}
+	var sharedImages []string
+	if err := tx.Model(&models.ProductImage{}).
+		Joins("JOIN products ON products.id = product_images.product_id").
+		Where("products.user_id <> ? AND product_images.file_id IN ?", user.ID, candidates).
+		Distinct().Pluck("product_images.file_id", &sharedImages).Error; err != nil {
+		return nil, err
+	}
+	var sharedProfiles []string
+	if err := tx.Model(&models.User{}).
+		Where("id <> ? AND file_id IN ?", user.ID, candidates).
+		Distinct().Pluck("file_id", &sharedProfiles).Error; err != nil {
+		return nil, err
+	}
+
+	shared = append(append(shared, sharedVariants...), sharedImages...)
+	exclude := make(map[string]struct{}, len(shared)+len(sharedProfiles))
+	for _, id := range append(shared, sharedProfiles...) {
+		exclude[id] = struct{}{}
+	}
+
+	fileIDs := make([]string, 0, len(candidates))
+	for _, id := range candidates {
+		if _, ok := exclude[id]; !ok {
+			fileIDs = append(fileIDs, id)
+		}
+	}
+	return fileIDs, nil
+}
+
+// ownedFileIDs lists the files referenced by the user's profile, products, variants and galleries
+func ownedFileIDs(user *models.User, products []models.Product) []string {
+	fileIDs := appendUnique(nil, user.FileID)
+	for _, product := range products {
+		fileIDs = appendUnique(fileIDs, product.FileID)
+		for _, variant := range product.Variants {
+			fileIDs = appendUnique(fileIDs, variant.FileID)
+		}
+		for _, image := range product.Images {
+			fileIDs = appendUnique(fileIDs, image.FileID)
+		}
+	}
+	return fileIDs
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// nonEmpty keeps IN clauses valid when there is nothing to match
+func nonEmpty(values []string) []string {
+	if len(values) == 0 {
+		return []string{""}
+	}
+	return values
+}
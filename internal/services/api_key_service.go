@@ -0,0 +1,134 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPIKeyInvalid  = errors.New("api key is invalid, expired or revoked")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+const (
+	// APIKeyPrefix marks a credential as an API key rather than a JWT
+	APIKeyPrefix = "tlk_"
+
+	apiKeyIDBytes     = 6
+	apiKeySecretBytes = 32
+	// lastUsedInterval limits how often last_used_at is written for a busy key
+	lastUsedInterval = time.Minute
+)
+
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// IsAPIKey reports whether a credential looks like an API key
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// Create mints a key formatted as tlk_<id>_<secret> and returns it with its raw value
+func (s *APIKeyService) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	idBytes := make([]byte, apiKeyIDBytes)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	secret, err := utils.GenerateOpaqueToken(apiKeySecretBytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix := APIKeyPrefix + hex.EncodeToString(idBytes)
+	rawKey := prefix + "_" + secret
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(rawKey),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+
+	return key, rawKey, nil
+}
+
+// List returns every key of the user, newest first
+func (s *APIKeyService) List(userID uint) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke disables a key of the user immediately
+func (s *APIKeyService) Revoke(userID, keyID uint) error {
+	result := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RevokeAll disables every key of the user
+func (s *APIKeyService) RevokeAll(userID uint) error {
+	return s.db.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Authenticate resolves a raw key to its record and records its use
+func (s *APIKeyService) Authenticate(rawKey string) (*models.APIKey, error) {
+	rest := strings.TrimPrefix(rawKey, APIKeyPrefix)
+	id, _, found := strings.Cut(rest, "_")
+	if !found || id == "" {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	var key models.APIKey
+	if err := s.db.Where("prefix = ?", APIKeyPrefix+id).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyInvalid
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(rawKey)), []byte(key.KeyHash)) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		if err := s.db.Model(&key).Update("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"time"
+
+	"tutuplapak/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditLimit = 20
+	maxAuditLimit     = 100
+)
+
+// AuditService writes and reads the security audit log. Events are never
+// deleted and only account deletion may update them, to remove personal
+// data; the table enforces both at the database level.
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record appends an event to the log
+func (s *AuditService) Record(event *models.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	return s.db.Create(event).Error
+}
+
+// ListForUser returns the most recent events about the user, newest first
+func (s *AuditService) ListForUser(userID uint, limit, offset int) ([]models.AuditEvent, error) {
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	events := []models.AuditEvent{}
+	err := s.db.Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&events).Error
+	return events, err
+}
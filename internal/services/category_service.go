@@ -0,0 +1,324 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryNotFound      = errors.New("category not found")
+	ErrCategoryInvalidSlug   = errors.New("category slug must be lowercase letters, digits and hyphens")
+	ErrCategorySlugTaken     = errors.New("category slug is already used")
+	ErrCategoryInvalidParent = errors.New("category parent does not exist or is the category itself or one of its subcategories")
+	ErrCategoryInUse         = errors.New("category has subcategories or products")
+	ErrCategoryAttributes    = errors.New("invalid attribute definition")
+)
+
+type CategoryService struct {
+	db *gorm.DB
+}
+
+func NewCategoryService(db *gorm.DB) *CategoryService {
+	return &CategoryService{db: db}
+}
+
+// Tree returns the top-level categories with their subcategories nested in Children
+func (s *CategoryService) Tree() ([]models.Category, error) {
+	var categories []models.Category
+	if err := s.db.Order("sort_order, name, id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+
+	if roots == nil {
+		return []models.Category{}, nil
+	}
+	return attach(roots), nil
+}
+
+// Get returns a single category
+func (s *CategoryService) Get(id uint) (*models.Category, error) {
+	var category models.Category
+	if err := s.db.First(&category, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Resolve finds a category by slug or, case-insensitively, by name. A slug
+// match wins over a name match.
+func (s *CategoryService) Resolve(value string) (*models.Category, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, ErrCategoryNotFound
+	}
+
+	slug := strings.ToLower(value)
+	var matches []models.Category
+	if err := s.db.Where("slug = ? OR LOWER(name) = LOWER(?)", slug, value).Order("id").Find(&matches).Error; err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrCategoryNotFound
+	}
+	for i := range matches {
+		if matches[i].Slug == slug {
+			return &matches[i], nil
+		}
+	}
+	return &matches[0], nil
+}
+
+// WithDescendants returns the given category IDs together with the IDs of all
+// their subcategories, so filtering by a category also finds products filed
+// deeper in the tree
+func (s *CategoryService) WithDescendants(ids []uint) ([]uint, error) {
+	var categories []models.Category
+	if err := s.db.Select("id", "parent_id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]uint)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+
+	seen := make(map[uint]bool)
+	queue := append([]uint(nil), ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, children[id]...)
+	}
+
+	result := make([]uint, 0, len(seen))
+	for id := range seen {
+		result = append(result, id)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+// slugFor validates an explicit slug or derives one from the name
+func slugFor(input models.CategoryInput) (string, error) {
+	if err := validateAttributeDefinitions(input.Attributes); err != nil {
+		return "", err
+	}
+
+	if input.Slug == "" {
+		slug := utils.Slugify(input.Name)
+		if slug == "" {
+			return "", ErrCategoryInvalidSlug
+		}
+		return slug, nil
+	}
+	if !utils.IsSlug(input.Slug) {
+		return "", ErrCategoryInvalidSlug
+	}
+	return input.Slug, nil
+}
+
+func (s *CategoryService) checkSlug(tx *gorm.DB, slug string, exceptID uint) error {
+	var count int64
+	if err := tx.Model(&models.Category{}).Where("slug = ? AND id <> ?", slug, exceptID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategorySlugTaken
+	}
+	return nil
+}
+
+// checkParent makes sure the parent exists and, for an existing category,
+// that it would not become its own ancestor
+func (s *CategoryService) checkParent(tx *gorm.DB, parentID *uint, id uint) error {
+	if parentID == nil {
+		return nil
+	}
+
+	current := *parentID
+	for {
+		if id != 0 && current == id {
+			return ErrCategoryInvalidParent
+		}
+		var parent models.Category
+		if err := tx.Select("id", "parent_id").First(&parent, current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCategoryInvalidParent
+			}
+			return err
+		}
+		if parent.ParentID == nil {
+			return nil
+		}
+		current = *parent.ParentID
+	}
+}
+
+// Create adds a category
+func (s *CategoryService) Create(input models.CategoryInput) (*models.Category, error) {
+	slug, err := slugFor(input)
+	if err != nil {
+		return nil, err
+	}
+
+	category := &models.Category{
+		ParentID:   input.ParentID,
+		Slug:       slug,
+		Name:       strings.TrimSpace(input.Name),
+		SortOrder:  input.SortOrder,
+		Attributes: input.Attributes,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.checkSlug(tx, slug, 0); err != nil {
+			return err
+		}
+		if err := s.checkParent(tx, input.ParentID, 0); err != nil {
+			return err
+		}
+		return tx.Create(category).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// Update replaces a category. A new name is copied to the products filed
+// under it, which keep the display name alongside the category ID.
+func (s *CategoryService) Update(id uint, input models.CategoryInput) (*models.Category, error) {
+	slug, err := slugFor(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var category models.Category
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCategoryNotFound
+			}
+			return err
+		}
+		if err := s.checkSlug(tx, slug, id); err != nil {
+			return err
+		}
+		if err := s.checkParent(tx, input.ParentID, id); err != nil {
+			return err
+		}
+
+		renamed := category.Name != strings.TrimSpace(input.Name)
+		category.ParentID = input.ParentID
+		category.Slug = slug
+		category.Name = strings.TrimSpace(input.Name)
+		category.SortOrder = input.SortOrder
+		category.Attributes = input.Attributes
+		if err := tx.Save(&category).Error; err != nil {
+			return err
+		}
+
+		if renamed {
+			return tx.Model(&models.Product{}).
+				Where("category_id = ?", id).
+				UpdateColumn("category", category.Name).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Delete removes a category that has no subcategories and no products,
+// including products of deleted accounts
+func (s *CategoryService) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.First(&category, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCategoryNotFound
+			}
+			return err
+		}
+
+		var children, products int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Product{}).Where("category_id = ?", id).Count(&products).Error; err != nil {
+			return err
+		}
+		if children > 0 || products > 0 {
+			return ErrCategoryInUse
+		}
+
+		return tx.Delete(&category).Error
+	})
+}
+
+// AttributeSchema returns the attributes products of the category may have:
+// those of the category and of its ancestors, a subcategory overriding an
+// ancestor's attribute with the same key
+func (s *CategoryService) AttributeSchema(categoryID uint) ([]models.AttributeDefinition, error) {
+	var chain []models.Category
+	current := &categoryID
+	for current != nil && len(chain) <= maxCategoryDepth {
+		var category models.Category
+		if err := s.db.Select("id", "parent_id", "attributes").First(&category, *current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrCategoryNotFound
+			}
+			return nil, err
+		}
+		chain = append(chain, category)
+		current = category.ParentID
+	}
+
+	var schema []models.AttributeDefinition
+	index := make(map[string]int)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, definition := range chain[i].Attributes {
+			if at, exists := index[definition.Key]; exists {
+				schema[at] = definition
+				continue
+			}
+			index[definition.Key] = len(schema)
+			schema = append(schema, definition)
+		}
+	}
+	return schema, nil
+}
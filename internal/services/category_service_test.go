@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/testutil"
+)
+
+// createCategory adds a category or fails the test
+func createCategory(t *testing.T, s *CategoryService, input models.CategoryInput) *models.Category {
+	t.Helper()
+	category, err := s.Create(input)
+	if err != nil {
+		t.Fatalf("create category %s: %v", input.Name, err)
+	}
+	return category
+}
+
+func TestCategoryCheckParentRejectsCycles(t *testing.T) {
+	s := NewCategoryService(testutil.DB(t))
+	root := createCategory(t, s, models.CategoryInput{Name: "Fashion"})
+	child := createCategory(t, s, models.CategoryInput{Name: "Pria", ParentID: &root.ID})
+	grandchild := createCategory(t, s, models.CategoryInput{Name: "Kemeja Pria", ParentID: &child.ID})
+
+	missing := grandchild.ID + 100
+	for name, parentID := range map[string]*uint{
+		"itself":         &root.ID,
+		"its child":      &child.ID,
+		"its grandchild": &grandchild.ID,
+		"a missing one":  &missing,
+	} {
+		input := models.CategoryInput{Name: root.Name, Slug: root.Slug, ParentID: parentID}
+		if _, err := s.Update(root.ID, input); !errors.Is(err, ErrCategoryInvalidParent) {
+			t.Errorf("moving the root under %s: expected ErrCategoryInvalidParent, got %v", name, err)
+		}
+	}
+	if _, err := s.Create(models.CategoryInput{Name: "Yatim", ParentID: &missing}); !errors.Is(err, ErrCategoryInvalidParent) {
+		t.Errorf("expected a missing parent to be rejected on create, got %v", err)
+	}
+
+	// Moving a subcategory up or to the top level is fine
+	if _, err := s.Update(grandchild.ID, models.CategoryInput{Name: grandchild.Name, ParentID: &root.ID}); err != nil {
+		t.Fatalf("move the grandchild under the root: %v", err)
+	}
+	if _, err := s.Update(child.ID, models.CategoryInput{Name: child.Name}); err != nil {
+		t.Fatalf("move the child to the top level: %v", err)
+	}
+	// The old cycle is gone, so the former child can now take the root
+	if _, err := s.Update(root.ID, models.CategoryInput{Name: root.Name, ParentID: &child.ID}); err != nil {
+		t.Fatalf("move the root under the former child: %v", err)
+	}
+}
+
+func TestCategoryWithDescendants(t *testing.T) {
+	s := NewCategoryService(testutil.DB(t))
+	root := createCategory(t, s, models.CategoryInput{Name: "Fashion"})
+	child := createCategory(t, s, models.CategoryInput{Name: "Pria", ParentID: &root.ID})
+	grandchild := createCategory(t, s, models.CategoryInput{Name: "Kemeja Pria", ParentID: &child.ID})
+	sibling := createCategory(t, s, models.CategoryInput{Name: "Wanita", ParentID: &root.ID})
+	other := createCategory(t, s, models.CategoryInput{Name: "Elektronik"})
+
+	tests := []struct {
+		ids  []uint
+		want []uint
+	}{
+		{[]uint{root.ID}, []uint{root.ID, child.ID, grandchild.ID, sibling.ID}},
+		{[]uint{child.ID}, []uint{child.ID, grandchild.ID}},
+		{[]uint{grandchild.ID}, []uint{grandchild.ID}},
+		// Overlapping and repeated IDs are listed once
+		{[]uint{other.ID, child.ID, root.ID, child.ID}, []uint{root.ID, child.ID, grandchild.ID, sibling.ID, other.ID}},
+		{nil, []uint{}},
+	}
+	for _, tt := range tests {
+		got, err := s.WithDescendants(tt.ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("WithDescendants(%v) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+}
+
+func TestCategoryResolve(t *testing.T) {
+	s := NewCategoryService(testutil.DB(t))
+	anak := createCategory(t, s, models.CategoryInput{Name: "Pakaian Anak"})
+	// One category's name is another's slug
+	shoes := createCategory(t, s, models.CategoryInput{Name: "Sepatu", Slug: "kids"})
+	kids := createCategory(t, s, models.CategoryInput{Name: "Kids", Slug: "kids-wear"})
+
+	tests := []struct {
+		value string
+		want  uint
+	}{
+		{"pakaian-anak", anak.ID},
+		{"Pakaian-Anak", anak.ID},
+		{"pakaian anak", anak.ID},
+		{"  PAKAIAN ANAK ", anak.ID},
+		// A slug match wins over a name match
+		{"kids", shoes.ID},
+		{"Kids", shoes.ID},
+		{"kids-wear", kids.ID},
+		{"sepatu", shoes.ID},
+	}
+	for _, tt := range tests {
+		category, err := s.Resolve(tt.value)
+		if err != nil {
+			t.Fatalf("Resolve(%q): %v", tt.value, err)
+		}
+		if category.ID != tt.want {
+			t.Errorf("Resolve(%q) = %d (%s), want %d", tt.value, category.ID, category.Slug, tt.want)
+		}
+	}
+
+	// The default categories are seeded by the migrations
+	if category, err := s.Resolve("Clothes"); err != nil || category.Slug != "clothes" {
+		t.Fatalf("expected the seeded clothes category, got %v, %v", category, err)
+	}
+
+	for _, value := range []string{"", "   ", "pakaian", "anak", "%", "pakaian_anak"} {
+		if _, err := s.Resolve(value); !errors.Is(err, ErrCategoryNotFound) {
+			t.Errorf("Resolve(%q): expected ErrCategoryNotFound, got %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"tutuplapak/internal/models"
+
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+)
+
+const (
+	fileDeletionBatchSize  = 50
+	fileDeletionMaxBackoff = time.Hour
+)
+
+// ObjectNameFromURI returns the object name of a URI built by UploadFile,
+// or an empty string when the URI does not point into the bucket
+func (s *MinIOService) ObjectNameFromURI(uri string) string {
+	prefix := fmt.Sprintf("%s/%s/", s.client.EndpointURL().String(), s.bucketName)
+	if !strings.HasPrefix(uri, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(uri, prefix)
+}
+
+// GetObject opens a stored object for reading
+func (s *MinIOService) GetObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucketName, objectName, minio.GetObjectOptions{})
+}
+
+// StartDeletionWorker removes scheduled files from the bucket every interval until ctx is done
+func (s *MinIOService) StartDeletionWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.processDeletions(ctx); err != nil {
+					log.Printf("Failed to process scheduled file deletions: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// processDeletions runs the due deletion jobs; failed jobs are retried with exponential backoff
+func (s *MinIOService) processDeletions(ctx context.Context) error {
+	var jobs []models.FileDeletion
+	if err := s.db.Where("done_at IS NULL AND run_after <= ?", time.Now()).
+		Order("run_after").Limit(fileDeletionBatchSize).
+		Find(&jobs).Error; err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := s.deleteFile(ctx, job.FileID); err != nil {
+			attempts := job.Attempts + 1
+			if err := s.db.Model(&job).Updates(map[string]any{
+				"attempts":   attempts,
+				"last_error": err.Error(),
+				"run_after":  time.Now().Add(deletionBackoff(attempts)),
+			}).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.db.Model(&job).Update("done_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteFile removes the original and thumbnail objects and the upload record
+func (s *MinIOService) deleteFile(ctx context.Context, fileID string) error {
+	var upload models.FileUpload
+	err := s.db.Where("file_id = ?", fileID).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, uri := range []string{upload.FileURI, upload.FileThumbnailURI} {
+		objectName := s.ObjectNameFromURI(uri)
+		if objectName == "" {
+			continue
+		}
+		if err := s.client.RemoveObject(ctx, s.bucketName, objectName, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Delete(&upload).Error
+}
+
+func deletionBackoff(attempts int) time.Duration {
+	backoff := time.Minute << uint(attempts-1)
+	if backoff <= 0 || backoff > fileDeletionMaxBackoff {
+		return fileDeletionMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons recorded on login attempts
+const (
+	LoginReasonSuccess         = "success"
+	LoginReasonUnknownUser     = "unknown_user"
+	LoginReasonInvalidPassword = "invalid_password"
+	LoginReasonThrottled       = "throttled"
+)
+
+// ThrottledError is returned when an account or client IP must wait before trying again
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginGuard slows down password guessing. Every failure for an account
+// doubles the wait before the next attempt once BackoffThreshold is reached,
+// MaxFailures consecutive failures lock the account for LockoutDuration, and
+// each client IP may only fail IPMaxFailures times within IPWindow.
+type LoginGuard struct {
+	db  *gorm.DB
+	cfg config.LoginProtectionConfig
+}
+
+func NewLoginGuard(db *gorm.DB, cfg config.LoginProtectionConfig) *LoginGuard {
+	return &LoginGuard{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// Check returns a *ThrottledError when the identifier or IP is not allowed to try now
+func (g *LoginGuard) Check(identifier, ip string) error {
+	now := time.Now()
+
+	var throttle models.LoginThrottle
+	err := g.db.Where("identifier = ?", identifier).Limit(1).Find(&throttle).Error
+	if err != nil {
+		return err
+	}
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+		return &ThrottledError{
+			RetryAfter: throttle.LockedUntil.Sub(now),
+			Locked:     throttle.FailedCount >= g.cfg.MaxFailures,
+		}
+	}
+
+	windowStart := now.Add(-g.cfg.IPWindow)
+	var failures []time.Time
+	if err := g.db.Model(&models.LoginAttempt{}).
+		Where("ip = ? AND success = ? AND reason <> ? AND created_at > ?", ip, false, LoginReasonThrottled, windowStart).
+		Order("created_at DESC").
+		Limit(g.cfg.IPMaxFailures).
+		Pluck("created_at", &failures).Error; err != nil {
+		return err
+	}
+	if len(failures) >= g.cfg.IPMaxFailures {
+		// The window frees up once the oldest counted failure falls out of it
+		oldest := failures[len(failures)-1]
+		return &ThrottledError{RetryAfter: oldest.Add(g.cfg.IPWindow).Sub(now)}
+	}
+
+	return nil
+}
+
+// RecordFailure stores the failed attempt and extends the account back-off
+func (g *LoginGuard) RecordFailure(identifier, ip, userAgent string, userID *uint, reason string) error {
+	now := time.Now()
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.LoginAttempt{
+			Identifier: identifier,
+			UserID:     userID,
+			IP:         ip,
+			UserAgent:  userAgent,
+			Success:    false,
+			Reason:     reason,
+			CreatedAt:  now,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Attempts rejected by the guard itself do not extend the lock
+		if reason == LoginReasonThrottled {
+			return nil
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{Identifier: identifier}).Error; err != nil {
+			return err
+		}
+
+		var throttle models.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("identifier = ?", identifier).
+			First(&throttle).Error; err != nil {
+			return err
+		}
+
+		throttle.FailedCount++
+		throttle.LastFailedAt = &now
+		if delay := g.delayFor(throttle.FailedCount); delay > 0 {
+			lockedUntil := now.Add(delay)
+			throttle.LockedUntil = &lockedUntil
+		}
+
+		return tx.Save(&throttle).Error
+	})
+}
+
+// RecordSuccess stores the successful attempt and clears the account back-off
+func (g *LoginGuard) RecordSuccess(identifier, ip, userAgent string, userID uint) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.LoginAttempt{
+			Identifier: identifier,
+			UserID:     &userID,
+			IP:         ip,
+			UserAgent:  userAgent,
+			Success:    true,
+			Reason:     LoginReasonSuccess,
+			CreatedAt:  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("identifier = ?", identifier).Delete(&models.LoginThrottle{}).Error
+	})
+}
+
+// delayFor returns how long an account must wait after its n-th consecutive failure
+func (g *LoginGuard) delayFor(failures int) time.Duration {
+	if failures >= g.cfg.MaxFailures {
+		return g.cfg.LockoutDuration
+	}
+	if failures < g.cfg.BackoffThreshold {
+		return 0
+	}
+
+	delay := g.cfg.BackoffBase << (failures - g.cfg.BackoffThreshold)
+	if delay <= 0 || delay > g.cfg.BackoffMax {
+		return g.cfg.BackoffMax
+	}
+	return delay
+}
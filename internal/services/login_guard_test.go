@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/testutil"
+)
+
+var testLoginProtection = config.LoginProtectionConfig{
+	BackoffThreshold: 3,
+	BackoffBase:      time.Second,
+	BackoffMax:       8 * time.Second,
+	MaxFailures:      10,
+	LockoutDuration:  15 * time.Minute,
+	IPMaxFailures:    3,
+	IPWindow:         time.Hour,
+}
+
+// throttled returns the *ThrottledError of err, failing the test on any other result
+func throttled(t *testing.T, err error) *ThrottledError {
+	t.Helper()
+	var throttle *ThrottledError
+	if !errors.As(err, &throttle) {
+		t.Fatalf("expected a *ThrottledError, got %v", err)
+	}
+	return throttle
+}
+
+func TestLoginGuardBackoffGrowth(t *testing.T) {
+	g := NewLoginGuard(nil, testLoginProtection)
+	for failures, want := range map[int]time.Duration{
+		1:  0,
+		2:  0,
+		3:  time.Second,
+		4:  2 * time.Second,
+		5:  4 * time.Second,
+		6:  8 * time.Second,
+		7:  8 * time.Second,
+		9:  8 * time.Second,
+		10: 15 * time.Minute,
+		25: 15 * time.Minute,
+	} {
+		if got := g.delayFor(failures); got != want {
+			t.Errorf("delayFor(%d) = %s, want %s", failures, got, want)
+		}
+	}
+
+	// A shift past the width of time.Duration falls back to the maximum
+	cfg := testLoginProtection
+	cfg.BackoffThreshold, cfg.MaxFailures = 1, 1000
+	if got := NewLoginGuard(nil, cfg).delayFor(200); got != cfg.BackoffMax {
+		t.Fatalf("expected an overflowing delay to be capped at %s, got %s", cfg.BackoffMax, got)
+	}
+}
+
+func TestLoginGuardBackoffAndLockout(t *testing.T) {
+	db := testutil.DB(t)
+	cfg := testLoginProtection
+	cfg.IPMaxFailures = 100
+	g := NewLoginGuard(db, cfg)
+	const identifier, ip = "buyer@example.com", "203.0.113.7"
+
+	fail := func(reason string) {
+		t.Helper()
+		if err := g.RecordFailure(identifier, ip, "test", nil, reason); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// expire moves the current wait into the past, as if it had been sat out
+	expire := func() {
+		t.Helper()
+		if err := db.Model(&models.LoginThrottle{}).Where("identifier = ?", identifier).
+			Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		fail(LoginReasonInvalidPassword)
+		if err := g.Check(identifier, ip); err != nil {
+			t.Fatalf("expected no wait before the threshold, got %v", err)
+		}
+	}
+
+	fail(LoginReasonInvalidPassword)
+	throttle := throttled(t, g.Check(identifier, ip))
+	if throttle.Locked || throttle.RetryAfter <= 0 || throttle.RetryAfter > time.Second {
+		t.Fatalf("expected a wait of up to 1s, got %+v", throttle)
+	}
+	// Other accounts are not affected
+	if err := g.Check("seller@example.com", ip); err != nil {
+		t.Fatalf("expected another account to be allowed, got %v", err)
+	}
+
+	// Attempts rejected while waiting do not make the wait longer
+	fail(LoginReasonThrottled)
+	var state models.LoginThrottle
+	db.First(&state, "identifier = ?", identifier)
+	if state.FailedCount != 3 {
+		t.Fatalf("expected throttled attempts not to count, got %d failures", state.FailedCount)
+	}
+
+	expire()
+	if err := g.Check(identifier, ip); err != nil {
+		t.Fatalf("expected the wait to be over, got %v", err)
+	}
+	fail(LoginReasonInvalidPassword)
+	if throttle := throttled(t, g.Check(identifier, ip)); throttle.RetryAfter <= time.Second || throttle.RetryAfter > 2*time.Second {
+		t.Fatalf("expected the wait to double to 2s, got %s", throttle.RetryAfter)
+	}
+
+	for state.FailedCount < cfg.MaxFailures {
+		expire()
+		fail(LoginReasonUnknownUser)
+		db.First(&state, "identifier = ?", identifier)
+	}
+	throttle = throttled(t, g.Check(identifier, ip))
+	if !throttle.Locked || throttle.RetryAfter <= 14*time.Minute {
+		t.Fatalf("expected a 15 minute lockout, got %+v", throttle)
+	}
+
+	// The lockout ends by itself, and a success clears the count
+	expire()
+	if err := g.Check(identifier, ip); err != nil {
+		t.Fatalf("expected the lockout to be over, got %v", err)
+	}
+	if err := g.RecordSuccess(identifier, ip, "test", 1); err != nil {
+		t.Fatal(err)
+	}
+	fail(LoginReasonInvalidPassword)
+	if err := g.Check(identifier, ip); err != nil {
+		t.Fatalf("expected a fresh count after the success, got %v", err)
+	}
+}
+
+func TestLoginGuardIPWindow(t *testing.T) {
+	db := testutil.DB(t)
+	g := NewLoginGuard(db, testLoginProtection)
+	const ip = "203.0.113.7"
+
+	// Failures count per IP whichever account they were for; successes and
+	// throttled attempts do not count
+	if err := g.RecordSuccess("a@example.com", ip, "test", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.RecordFailure("a@example.com", ip, "test", nil, LoginReasonThrottled); err != nil {
+		t.Fatal(err)
+	}
+	for _, identifier := range []string{"a@example.com", "b@example.com"} {
+		if err := g.RecordFailure(identifier, ip, "test", nil, LoginReasonInvalidPassword); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Check("c@example.com", ip); err != nil {
+		t.Fatalf("expected the IP to be allowed below the limit, got %v", err)
+	}
+
+	if err := g.RecordFailure("c@example.com", ip, "test", nil, LoginReasonUnknownUser); err != nil {
+		t.Fatal(err)
+	}
+	throttle := throttled(t, g.Check("d@example.com", ip))
+	if throttle.Locked || throttle.RetryAfter <= 59*time.Minute || throttle.RetryAfter > time.Hour {
+		t.Fatalf("expected a wait until the oldest failure leaves the window, got %+v", throttle)
+	}
+	if err := g.Check("d@example.com", "198.51.100.1"); err != nil {
+		t.Fatalf("expected another IP to be allowed, got %v", err)
+	}
+
+	// Once the oldest failure is 50 minutes old the IP waits 10 more minutes
+	var oldest models.LoginAttempt
+	db.Where("ip = ? AND success = ? AND reason <> ?", ip, false, LoginReasonThrottled).Order("id").First(&oldest)
+	db.Model(&oldest).Update("created_at", time.Now().Add(-50*time.Minute))
+	throttle = throttled(t, g.Check("d@example.com", ip))
+	if throttle.RetryAfter <= 9*time.Minute || throttle.RetryAfter > 10*time.Minute {
+		t.Fatalf("expected about 10 minutes left, got %s", throttle.RetryAfter)
+	}
+
+	// And once it leaves the window the IP may try again
+	db.Model(&oldest).Update("created_at", time.Now().Add(-time.Hour-time.Minute))
+	if err := g.Check("d@example.com", ip); err != nil {
+		t.Fatalf("expected the IP to be allowed after the window, got %v", err)
+	}
+}
@@ -0,0 +1,551 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateBytes    = 32
+	oidcVerifierBytes = 32
+	oidcNonceBytes    = 16
+	// oidcMetadataTTL is how long discovery documents and signing keys are cached
+	oidcMetadataTTL = time.Hour
+)
+
+var (
+	ErrOIDCUnknownProvider = errors.New("unknown identity provider")
+	ErrOIDCInvalidState    = errors.New("invalid or expired login state")
+	ErrOIDCInvalidToken    = errors.New("invalid ID token")
+	ErrOIDCIdentityInUse   = errors.New("identity is linked to another user")
+	ErrOIDCLinkRequired    = errors.New("an account with this email exists and must link the identity itself")
+	ErrOIDCNotLinked       = errors.New("identity is not linked to this user")
+)
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	cfg config.OIDCProviderConfig
+
+	mu        sync.Mutex
+	metadata  *oidcMetadata
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// idTokenClaims are the claims read from a provider's ID token
+type idTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// OIDCService runs the authorization-code flow with PKCE against the
+// configured OpenID Connect providers and maps their identities to users
+type OIDCService struct {
+	db        *gorm.DB
+	client    *http.Client
+	stateTTL  time.Duration
+	providers map[string]*oidcProvider
+}
+
+func NewOIDCService(db *gorm.DB, cfg config.OIDCConfig) *OIDCService {
+	providers := make(map[string]*oidcProvider, len(cfg.Providers))
+	for _, provider := range cfg.Providers {
+		providers[provider.Name] = &oidcProvider{cfg: provider}
+	}
+
+	return &OIDCService{
+		db:        db,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		stateTTL:  cfg.StateTTL,
+		providers: providers,
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Begin stores a new login state and returns the provider URL to send the user
+// to, along with the state the browser must present on the callback.
+// linkUserID is set when a logged in user adds the identity to their account,
+// or with reauth when they confirm a sensitive request by logging in again.
+func (s *OIDCService) Begin(ctx context.Context, providerName, deviceID string, linkUserID *uint, reauth bool) (string, string, time.Time, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", time.Time{}, ErrOIDCUnknownProvider
+	}
+	metadata, err := s.metadata(ctx, provider)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	state, err := utils.GenerateOpaqueToken(oidcStateBytes)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	verifier, err := utils.GenerateOpaqueToken(oidcVerifierBytes)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	nonce, err := utils.GenerateOpaqueToken(oidcNonceBytes)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	// Abandoned logins are cleaned up whenever a new one starts
+	if err := s.db.Where("expires_at <= ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(s.stateTTL)
+	if err := s.db.Create(&models.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		DeviceID:     deviceID,
+		LinkUserID:   linkUserID,
+		Reauth:       reauth,
+		ExpiresAt:    expiresAt,
+	}).Error; err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.cfg.ClientID},
+		"redirect_uri":          {provider.cfg.RedirectURL},
+		"scope":                 {strings.Join(provider.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), state, expiresAt, nil
+}
+
+// Complete consumes the login state, redeems the authorization code and
+// verifies the returned ID token
+func (s *OIDCService) Complete(ctx context.Context, providerName, state, code string) (*models.OIDCClaims, *models.OIDCLoginState, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, nil, ErrOIDCUnknownProvider
+	}
+
+	var loginState models.OIDCLoginState
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND provider = ?", utils.HashToken(state), providerName).
+			First(&loginState).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOIDCInvalidState
+			}
+			return err
+		}
+		// A state is single use, whatever the outcome
+		return tx.Delete(&loginState).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, nil, ErrOIDCInvalidState
+	}
+
+	metadata, err := s.metadata(ctx, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawIDToken, err := s.exchangeCode(ctx, provider, metadata, code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := s.verifyIDToken(ctx, provider, metadata, rawIDToken, loginState.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return claims, &loginState, nil
+}
+
+// ResolveUser returns the user owning the identity. Unknown identities are
+// linked to linkUserID, to the user with the same email when both the provider
+// and the user verified it, or to a new user without a password. A user with
+// the same unverified email has to link the identity while logged in, failing
+// with ErrOIDCLinkRequired. created reports whether a user was created.
+func (s *OIDCService) ResolveUser(providerName string, claims *models.OIDCClaims, linkUserID *uint) (*models.User, bool, error) {
+	var (
+		user    models.User
+		created bool
+	)
+	email := ""
+	if claims.EmailVerified {
+		email = utils.CanonicalEmail(claims.Email)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var identity models.OIDCIdentity
+		err := tx.Where("provider = ? AND subject = ?", providerName, claims.Subject).First(&identity).Error
+		if err == nil {
+			if linkUserID != nil && *linkUserID != identity.UserID {
+				return ErrOIDCIdentityInUse
+			}
+			if err := tx.Model(&identity).Updates(map[string]any{
+				"email":         email,
+				"last_login_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Where("anonymized_at IS NULL").First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		switch {
+		case linkUserID != nil:
+			if err := tx.Where("anonymized_at IS NULL").First(&user, *linkUserID).Error; err != nil {
+				return err
+			}
+		case email != "":
+			err := tx.Where("email = ? AND anonymized_at IS NULL", email).First(&user).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if err == nil {
+				if user.EmailVerifiedAt == nil {
+					return ErrOIDCLinkRequired
+				}
+				break
+			}
+			fallthrough
+		default:
+			user = models.User{
+				Name:     claims.Name,
+				Email:    email,
+				Password: unusablePassword,
+			}
+			if email != "" {
+				user.EmailVerifiedAt = &now
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			created = true
+		}
+
+		return tx.Create(&models.OIDCIdentity{
+			UserID:      user.ID,
+			Provider:    providerName,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &user, created, nil
+}
+
+// CheckIdentity confirms the identity is linked to the user, failing with
+// ErrOIDCNotLinked otherwise
+func (s *OIDCService) CheckIdentity(providerName string, claims *models.OIDCClaims, userID uint) error {
+	var identity models.OIDCIdentity
+	err := s.db.Where("provider = ? AND subject = ? AND user_id = ?", providerName, claims.Subject, userID).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOIDCNotLinked
+	}
+	if err != nil {
+		return err
+	}
+	return s.db.Model(&identity).Update("last_login_at", time.Now()).Error
+}
+
+// ListIdentities returns the provider accounts linked to the user
+func (s *OIDCService) ListIdentities(userID uint) ([]models.OIDCIdentity, error) {
+	identities := []models.OIDCIdentity{}
+	err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	return identities, err
+}
+
+// exchangeCode redeems the authorization code at the token endpoint and returns the raw ID token
+func (s *OIDCService) exchangeCode(ctx context.Context, provider *oidcProvider, metadata *oidcMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.cfg.RedirectURL},
+		"client_id":     {provider.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if provider.cfg.ClientSecret != "" {
+		form.Set("client_secret", provider.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token request rejected: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+// verifyIDToken checks signature, issuer, audience, expiry and nonce of an ID token
+func (s *OIDCService) verifyIDToken(ctx context.Context, provider *oidcProvider, metadata *oidcMetadata, rawIDToken, nonce string) (*models.OIDCClaims, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(ctx, provider, metadata, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(provider.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidToken, err)
+	}
+	if claims.Nonce != nonce || claims.Subject == "" {
+		return nil, ErrOIDCInvalidToken
+	}
+
+	// Some providers send email_verified as a string
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return &models.OIDCClaims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// metadata returns the provider's discovery document, fetching it when missing or stale
+func (s *OIDCService) metadata(ctx context.Context, provider *oidcProvider) (*oidcMetadata, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.metadata != nil && time.Since(provider.fetchedAt) < oidcMetadataTTL {
+		return provider.metadata, nil
+	}
+
+	var metadata oidcMetadata
+	if err := s.getJSON(ctx, provider.cfg.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("discovery for %s: %w", provider.cfg.Name, err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != provider.cfg.Issuer {
+		return nil, fmt.Errorf("discovery for %s: issuer mismatch %q", provider.cfg.Name, metadata.Issuer)
+	}
+
+	provider.metadata = &metadata
+	provider.keys = nil
+	provider.fetchedAt = time.Now()
+	return provider.metadata, nil
+}
+
+// signingKey looks up a provider key by id, refetching the key set once for unknown ids
+func (s *OIDCService) signingKey(ctx context.Context, provider *oidcProvider, metadata *oidcMetadata, kid string) (crypto.PublicKey, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if key, ok := lookupKey(provider.keys, kid); ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := s.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("keys for %s: %w", provider.cfg.Name, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk.KeyType, jwk.Curve, jwk.N, jwk.E, jwk.X, jwk.Y)
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	provider.keys = keys
+
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by id; tokens without kid are accepted when the set has a single key
+func lookupKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// parseJWK builds a public key from the fields of an RSA, EC P-256 or Ed25519 JWK
+func parseJWK(keyType, curve, n, e, x, y string) (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch keyType {
+	case "RSA":
+		nBytes, err := decode(n)
+		if err != nil {
+			return nil, err
+		}
+		eBytes, err := decode(e)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}, nil
+	case "EC":
+		if curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", curve)
+		}
+		xBytes, err := decode(x)
+		if err != nil {
+			return nil, err
+		}
+		yBytes, err := decode(y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(xBytes),
+			Y:     new(big.Int).SetBytes(yBytes),
+		}, nil
+	case "OKP":
+		if curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", curve)
+		}
+		xBytes, err := decode(x)
+		if err != nil {
+			return nil, err
+		}
+		if len(xBytes) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(xBytes), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+func (s *OIDCService) getJSON(ctx context.Context, endpoint string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/oidctest"
+)
+
+const testRedirectURL = "http://localhost/v1/login/oidc/test/callback"
+
+// authorize runs the provider's authorization endpoint and returns the code
+func authorize(t *testing.T, endpoint, clientID, verifier, nonce string) string {
+	t.Helper()
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {testRedirectURL},
+		"state":                 {"state"},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(endpoint + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected a redirect, got %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code")
+}
+
+func newTestOIDCService(t *testing.T) (*OIDCService, *oidcProvider, *oidctest.Server) {
+	t.Helper()
+	idp, err := oidctest.NewServer("tutuplapak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	s := NewOIDCService(nil, config.OIDCConfig{Providers: []config.OIDCProviderConfig{{
+		Name:        "test",
+		Issuer:      idp.Issuer,
+		ClientID:    "tutuplapak",
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "email"},
+	}}})
+	return s, s.providers["test"], idp
+}
+
+func TestOIDCCodeExchangeRequiresPKCEVerifier(t *testing.T) {
+	s, provider, _ := newTestOIDCService(t)
+	ctx := context.Background()
+	metadata, err := s.metadata(ctx, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := authorize(t, metadata.AuthorizationEndpoint, "tutuplapak", "the-verifier", "nonce")
+	if _, err := s.exchangeCode(ctx, provider, metadata, code, "another-verifier"); err == nil {
+		t.Fatal("expected a wrong verifier to be rejected")
+	}
+	// Codes are single use, even after a failed exchange
+	if _, err := s.exchangeCode(ctx, provider, metadata, code, "the-verifier"); err == nil {
+		t.Fatal("expected a used code to be rejected")
+	}
+
+	code = authorize(t, metadata.AuthorizationEndpoint, "tutuplapak", "the-verifier", "nonce")
+	rawIDToken, err := s.exchangeCode(ctx, provider, metadata, code, "the-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := s.verifyIDToken(ctx, provider, metadata, rawIDToken, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "buyer@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestOIDCIDTokenChecksNonceAndAudience(t *testing.T) {
+	s, provider, idp := newTestOIDCService(t)
+	ctx := context.Background()
+	metadata, err := s.metadata(ctx, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := authorize(t, metadata.AuthorizationEndpoint, "tutuplapak", "verifier", "nonce")
+	rawIDToken, err := s.exchangeCode(ctx, provider, metadata, code, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.verifyIDToken(ctx, provider, metadata, rawIDToken, "other-nonce"); !errors.Is(err, ErrOIDCInvalidToken) {
+		t.Fatalf("expected ErrOIDCInvalidToken for a nonce mismatch, got %v", err)
+	}
+
+	other := &oidcProvider{cfg: provider.cfg}
+	other.cfg.ClientID = "another-client"
+	if _, err := s.verifyIDToken(ctx, other, metadata, rawIDToken, "nonce"); !errors.Is(err, ErrOIDCInvalidToken) {
+		t.Fatalf("expected ErrOIDCInvalidToken for another audience, got %v", err)
+	}
+
+	idp.SetIdentity(oidctest.Identity{Subject: "user-2", Email: "seller@example.com"})
+	code = authorize(t, metadata.AuthorizationEndpoint, "tutuplapak", "verifier", "nonce")
+	rawIDToken, err = s.exchangeCode(ctx, provider, metadata, code, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.verifyIDToken(ctx, provider, metadata, rawIDToken, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.EmailVerified {
+		t.Fatal("expected an unverified email")
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+const (
+	// resetTokenBytes is the amount of entropy in a password reset token
+	resetTokenBytes = 24
+	// resetSendTimeout bounds the background delivery of a reset token
+	resetSendTimeout = 30 * time.Second
+)
+
+type PasswordResetService struct {
+	db            *gorm.DB
+	sender        Sender
+	refreshTokens *RefreshTokenService
+	cfg           config.PasswordResetConfig
+}
+
+func NewPasswordResetService(db *gorm.DB, sender Sender, refreshTokens *RefreshTokenService, cfg config.PasswordResetConfig) *PasswordResetService {
+	return &PasswordResetService{
+		db:            db,
+		sender:        sender,
+		refreshTokens: refreshTokens,
+		cfg:           cfg,
+	}
+}
+
+// Request accepts a reset for the contact and sends the token in the
+// background, so neither the time taken nor a failure reveals whether an
+// account uses the contact. It returns a *ThrottledError when the IP made too
+// many requests; requests over the per-contact limit are accepted but not sent.
+func (s *PasswordResetService) Request(channel models.ContactType, contact, ip string) error {
+	now := time.Now()
+	windowStart := now.Add(-s.cfg.Window)
+	contactHash := utils.HashToken(string(channel) + ":" + contact)
+	send := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Attempts that left the window are no longer needed
+		if err := tx.Where("created_at <= ?", windowStart).Delete(&models.PasswordResetAttempt{}).Error; err != nil {
+			return err
+		}
+
+		var fromIP []time.Time
+		if err := tx.Model(&models.PasswordResetAttempt{}).
+			Where("ip = ? AND created_at > ?", ip, windowStart).
+			Order("created_at DESC").
+			Limit(s.cfg.MaxPerIP).
+			Pluck("created_at", &fromIP).Error; err != nil {
+			return err
+		}
+		if len(fromIP) >= s.cfg.MaxPerIP {
+			// The window frees up once the oldest counted request falls out of it
+			oldest := fromIP[len(fromIP)-1]
+			return &ThrottledError{RetryAfter: oldest.Add(s.cfg.Window).Sub(now)}
+		}
+
+		var forContact int64
+		if err := tx.Model(&models.PasswordResetAttempt{}).
+			Where("contact_hash = ? AND created_at > ?", contactHash, windowStart).
+			Count(&forContact).Error; err != nil {
+			return err
+		}
+		send = forContact < int64(s.cfg.MaxPerContact)
+
+		return tx.Create(&models.PasswordResetAttempt{
+			IP:          ip,
+			ContactHash: contactHash,
+			CreatedAt:   now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if send {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), resetSendTimeout)
+			defer cancel()
+			if err := s.deliver(ctx, channel, contact); err != nil {
+				log.Printf("Failed to send password reset token: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// deliver sends a new reset token to the account owning the contact.
+// Unknown contacts are ignored.
+func (s *PasswordResetService) deliver(ctx context.Context, channel models.ContactType, contact string) error {
+	var user models.User
+	column := "email"
+	if channel == models.ContactTypePhone {
+		column = "phone"
+	}
+	if err := s.db.Where(column+" = ?", contact).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	rawToken, err := utils.GenerateOpaqueToken(resetTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Only the most recent token stays usable
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(rawToken),
+			ExpiresAt: now.Add(s.cfg.TokenTTL),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := Message{
+		Channel: channel,
+		To:      contact,
+		Subject: "Reset your TutupLapak password",
+		Body:    fmt.Sprintf("Use this token to reset your TutupLapak password: %s. It expires in %d minutes. If you did not ask for this, you can ignore this message.", rawToken, int(s.cfg.TokenTTL.Minutes())),
+	}
+	return s.sender.Send(ctx, msg)
+}
+
+// Confirm consumes the token, stores the new password hash and signs the user
+// out of every session.
+func (s *PasswordResetService) Confirm(rawToken, hashedPassword string) error {
+	var userID uint
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.PasswordResetToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(rawToken)).
+			First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrResetTokenInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if token.UsedAt != nil || now.After(token.ExpiresAt) {
+			return ErrResetTokenInvalid
+		}
+
+		if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.User{}).Where("id = ?", token.UserID).Update("password", hashedPassword)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenInvalid
+		}
+
+		userID = token.UserID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.refreshTokens.RevokeAllSessions(userID)
+}
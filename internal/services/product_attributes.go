@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"tutuplapak/internal/models"
+)
+
+// ErrInvalidAttributes is wrapped with the reason a product's attributes were rejected
+var ErrInvalidAttributes = errors.New("invalid attributes")
+
+const (
+	defaultAttributeMaxLength = 255
+	// maxCategoryDepth stops AttributeSchema on a parent cycle written around the API
+	maxCategoryDepth = 16
+)
+
+var attributeKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// IsAttributeKey reports whether key is a valid attribute key
+func IsAttributeKey(key string) bool {
+	return attributeKeyRegex.MatchString(key)
+}
+
+func validateAttributeDefinitions(definitions []models.AttributeDefinition) error {
+	seen := make(map[string]bool, len(definitions))
+	for _, definition := range definitions {
+		if !IsAttributeKey(definition.Key) {
+			return fmt.Errorf("%w: key %q must be lowercase letters, digits and underscores", ErrCategoryAttributes, definition.Key)
+		}
+		if seen[definition.Key] {
+			return fmt.Errorf("%w: duplicate key %q", ErrCategoryAttributes, definition.Key)
+		}
+		seen[definition.Key] = true
+
+		if definition.Type == models.AttributeEnum && len(definition.Options) == 0 {
+			return fmt.Errorf("%w: enum %q needs options", ErrCategoryAttributes, definition.Key)
+		}
+		if definition.Min != nil && definition.Max != nil && *definition.Min > *definition.Max {
+			return fmt.Errorf("%w: min of %q is greater than its max", ErrCategoryAttributes, definition.Key)
+		}
+	}
+	return nil
+}
+
+// ValidateAttributes checks product attribute values against a category's
+// schema and returns them normalized: strings trimmed and empty values dropped
+func ValidateAttributes(schema []models.AttributeDefinition, values map[string]any) (map[string]any, error) {
+	definitions := make(map[string]models.AttributeDefinition, len(schema))
+	for _, definition := range schema {
+		definitions[definition.Key] = definition
+	}
+
+	result := make(map[string]any, len(values))
+	for key, value := range values {
+		definition, ok := definitions[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown attribute %q", ErrInvalidAttributes, key)
+		}
+		normalized, err := validateAttribute(definition, value)
+		if err != nil {
+			return nil, err
+		}
+		if normalized != nil {
+			result[key] = normalized
+		}
+	}
+
+	for _, definition := range schema {
+		if _, ok := result[definition.Key]; definition.Required && !ok {
+			return nil, fmt.Errorf("%w: %s is required", ErrInvalidAttributes, definition.Key)
+		}
+	}
+	return result, nil
+}
+
+func validateAttribute(definition models.AttributeDefinition, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s %s", ErrInvalidAttributes, definition.Key, reason)
+	}
+
+	switch definition.Type {
+	case models.AttributeNumber:
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, invalid("must be a number")
+		}
+		if definition.Min != nil && number < *definition.Min {
+			return nil, invalid(fmt.Sprintf("must be at least %g", *definition.Min))
+		}
+		if definition.Max != nil && number > *definition.Max {
+			return nil, invalid(fmt.Sprintf("must be at most %g", *definition.Max))
+		}
+		return number, nil
+
+	case models.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return nil, invalid("must be true or false")
+		}
+		return value, nil
+
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return nil, invalid("must be a string")
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, nil
+		}
+
+		switch definition.Type {
+		case models.AttributeEnum:
+			for _, option := range definition.Options {
+				if text == option {
+					return text, nil
+				}
+			}
+			return nil, invalid("must be one of " + strings.Join(definition.Options, ", "))
+		case models.AttributeDate:
+			if _, err := time.Parse(time.DateOnly, text); err != nil {
+				return nil, invalid("must be a YYYY-MM-DD date")
+			}
+			return text, nil
+		default:
+			maxLength := definition.MaxLength
+			if maxLength == 0 {
+				maxLength = defaultAttributeMaxLength
+			}
+			if len([]rune(text)) > maxLength {
+				return nil, invalid(fmt.Sprintf("must be at most %d characters", maxLength))
+			}
+			return text, nil
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+func TestValidateAttributes(t *testing.T) {
+	min, max := 1.0, 100.0
+	schema := []models.AttributeDefinition{
+		{Key: "brand", Label: "Brand", Type: models.AttributeString, Required: true, MaxLength: 8},
+		{Key: "weight", Label: "Weight", Type: models.AttributeNumber, Min: &min, Max: &max, Unit: "kg"},
+		{Key: "halal", Label: "Halal", Type: models.AttributeBoolean},
+		{Key: "size", Label: "Size", Type: models.AttributeEnum, Options: []string{"S", "M", "L"}},
+		{Key: "expires", Label: "Expires", Type: models.AttributeDate},
+		{Key: "notes", Label: "Notes", Type: models.AttributeString},
+	}
+
+	got, err := ValidateAttributes(schema, map[string]any{
+		"brand":   "  Batik ",
+		"weight":  2.5,
+		"halal":   false,
+		"size":    "M",
+		"expires": "2025-01-31",
+		"notes":   "   ",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"brand": "Batik", "weight": 2.5, "halal": false, "size": "M", "expires": "2025-01-31"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// Only the required attribute has to be set
+	if got, err := ValidateAttributes(schema, map[string]any{"brand": "Batik", "size": nil}); err != nil || len(got) != 1 {
+		t.Fatalf("expected only the brand, got %v, %v", got, err)
+	}
+	if got, err := ValidateAttributes(nil, nil); err != nil || len(got) != 0 {
+		t.Fatalf("expected no attributes without a schema, got %v, %v", got, err)
+	}
+}
+
+func TestValidateAttributesRejectsInvalidValues(t *testing.T) {
+	min, max := 1.0, 100.0
+	schema := []models.AttributeDefinition{
+		{Key: "brand", Label: "Brand", Type: models.AttributeString, Required: true, MaxLength: 8},
+		{Key: "weight", Label: "Weight", Type: models.AttributeNumber, Min: &min, Max: &max},
+		{Key: "halal", Label: "Halal", Type: models.AttributeBoolean},
+		{Key: "size", Label: "Size", Type: models.AttributeEnum, Options: []string{"S", "M", "L"}},
+		{Key: "expires", Label: "Expires", Type: models.AttributeDate},
+		{Key: "notes", Label: "Notes", Type: models.AttributeString},
+	}
+
+	tests := map[string]map[string]any{
+		"missing required":     {"size": "S"},
+		"blank required":       {"brand": "  "},
+		"null required":        {"brand": nil},
+		"unknown key":          {"brand": "Batik", "color": "red"},
+		"string too long":      {"brand": "Batik Keris"},
+		"default length":       {"brand": "Batik", "notes": strings.Repeat("a", defaultAttributeMaxLength+1)},
+		"number as string":     {"brand": "Batik", "weight": "2.5"},
+		"number below min":     {"brand": "Batik", "weight": 0.5},
+		"number above max":     {"brand": "Batik", "weight": 100.5},
+		"number not finite":    {"brand": "Batik", "weight": math.Inf(1)},
+		"boolean as string":    {"brand": "Batik", "halal": "true"},
+		"enum not an option":   {"brand": "Batik", "size": "XL"},
+		"enum case":            {"brand": "Batik", "size": "m"},
+		"enum as number":       {"brand": "Batik", "size": 1.0},
+		"date format":          {"brand": "Batik", "expires": "31/01/2025"},
+		"date out of range":    {"brand": "Batik", "expires": "2025-02-30"},
+		"string as number":     {"brand": 12.0},
+		"string as object":     {"brand": map[string]any{"name": "Batik"}},
+		"boolean as number":    {"brand": "Batik", "halal": 1.0},
+		"unknown key with nil": {"brand": "Batik", "color": nil},
+	}
+	for name, values := range tests {
+		if got, err := ValidateAttributes(schema, values); !errors.Is(err, ErrInvalidAttributes) {
+			t.Errorf("%s: expected ErrInvalidAttributes, got %v, %v", name, got, err)
+		}
+	}
+}
+
+func TestValidateAttributeDefinitions(t *testing.T) {
+	min, max := 10.0, 1.0
+	tests := map[string][]models.AttributeDefinition{
+		"key case":      {{Key: "Brand", Type: models.AttributeString}},
+		"key start":     {{Key: "1brand", Type: models.AttributeString}},
+		"key too long":  {{Key: strings.Repeat("a", 33), Type: models.AttributeString}},
+		"duplicate key": {{Key: "brand", Type: models.AttributeString}, {Key: "brand", Type: models.AttributeNumber}},
+		"enum options":  {{Key: "size", Type: models.AttributeEnum}},
+		"min over max":  {{Key: "weight", Type: models.AttributeNumber, Min: &min, Max: &max}},
+	}
+	for name, definitions := range tests {
+		if err := validateAttributeDefinitions(definitions); !errors.Is(err, ErrCategoryAttributes) {
+			t.Errorf("%s: expected ErrCategoryAttributes, got %v", name, err)
+		}
+	}
+
+	if err := validateAttributeDefinitions([]models.AttributeDefinition{
+		{Key: "brand", Type: models.AttributeString},
+		{Key: "weight_kg", Type: models.AttributeNumber, Min: &max, Max: &min},
+		{Key: "size", Type: models.AttributeEnum, Options: []string{"S"}},
+	}); err != nil {
+		t.Fatalf("expected valid definitions, got %v", err)
+	}
+}
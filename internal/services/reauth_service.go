@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var ErrReauthTokenInvalid = errors.New("reauthentication token is invalid or expired")
+
+const (
+	reauthTokenBytes = 32
+	// reauthTokenTTL is how long a fresh identity provider login confirms sensitive requests
+	reauthTokenTTL = 5 * time.Minute
+)
+
+// ReauthService issues and redeems the single-use tokens that stand in for a
+// password when a user confirms a sensitive request
+type ReauthService struct {
+	db *gorm.DB
+}
+
+func NewReauthService(db *gorm.DB) *ReauthService {
+	return &ReauthService{db: db}
+}
+
+// Issue returns a new token for the user and when it expires
+func (s *ReauthService) Issue(userID uint) (string, time.Time, error) {
+	rawToken, err := utils.GenerateOpaqueToken(reauthTokenBytes)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	// Expired tokens are cleaned up whenever the user gets a new one
+	if err := s.db.Where("user_id = ? AND expires_at <= ?", userID, now).Delete(&models.ReauthToken{}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := models.ReauthToken{
+		UserID:    userID,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: now.Add(reauthTokenTTL),
+		CreatedAt: now,
+	}
+	if err := s.db.Create(&token).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return rawToken, token.ExpiresAt, nil
+}
+
+// Consume marks the user's token as used, failing with ErrReauthTokenInvalid
+// when it is unknown, expired or was used before
+func (s *ReauthService) Consume(userID uint, rawToken string) error {
+	now := time.Now()
+	result := s.db.Model(&models.ReauthToken{}).
+		Where("user_id = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", userID, utils.HashToken(rawToken), now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReauthTokenInvalid
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrDeviceMismatch      = errors.New("refresh token was issued to another device")
+)
+
+const (
+	// refreshTokenBytes is the amount of entropy in a refresh token
+	refreshTokenBytes = 32
+	// lastSeenInterval limits how often a busy session's last_seen_at is written
+	lastSeenInterval = time.Minute
+)
+
+type RefreshTokenService struct {
+	db          *gorm.DB
+	ttl         time.Duration
+	revocations *RevocationService
+
+	mu        sync.Mutex
+	lastSeen  map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewRefreshTokenService(db *gorm.DB, ttl time.Duration, revocations *RevocationService) *RefreshTokenService {
+	return &RefreshTokenService{
+		db:          db,
+		ttl:         ttl,
+		revocations: revocations,
+		lastSeen:    make(map[string]time.Time),
+	}
+}
+
+// StartSession opens a new session for the user on the given device
+// and returns the first refresh token of its family.
+func (s *RefreshTokenService) StartSession(userID uint, deviceID string, client models.SessionClient) (*models.Session, string, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		DeviceID:   deviceID,
+		DeviceName: client.DeviceName,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		LastSeenAt: &now,
+		ExpiresAt:  now.Add(s.ttl),
+	}
+
+	var rawToken string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+
+		token, err := s.issue(tx, session, now)
+		if err != nil {
+			return err
+		}
+		rawToken = token
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to start session: %w", err)
+	}
+
+	return session, rawToken, nil
+}
+
+// Rotate consumes a refresh token and returns its successor in the same family.
+// Presenting a token that was already rotated revokes the whole family, since
+// it means the token has been copied by someone else.
+func (s *RefreshTokenService) Rotate(rawToken, deviceID string, client models.SessionClient) (*models.Session, string, error) {
+	var (
+		session  models.Session
+		newToken string
+		reuseErr error
+	)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(rawToken)).
+			First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&session, "id = ?", current.SessionID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		// A rotated token coming back, or a token presented from another
+		// device, means the family is compromised
+		if current.UsedAt != nil || session.DeviceID != deviceID {
+			if session.RevokedAt == nil {
+				if err := revokeSession(tx, session.ID, now); err != nil {
+					return err
+				}
+			}
+			if current.UsedAt != nil {
+				reuseErr = ErrRefreshTokenReused
+			} else {
+				reuseErr = ErrDeviceMismatch
+			}
+			return nil
+		}
+
+		if current.RevokedAt != nil || session.RevokedAt != nil ||
+			now.After(current.ExpiresAt) || now.After(session.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		seen := map[string]interface{}{"last_seen_at": now, "ip": client.IP, "user_agent": client.UserAgent}
+		if client.DeviceName != "" {
+			seen["device_name"] = client.DeviceName
+		}
+		if err := tx.Model(&session).Updates(seen).Error; err != nil {
+			return err
+		}
+
+		token, err := s.issue(tx, &session, now)
+		if err != nil {
+			return err
+		}
+		newToken = token
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if reuseErr != nil {
+		if err := s.revocations.RevokeSession(session.UserID, session.ID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", reuseErr
+	}
+
+	return &session, newToken, nil
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *RefreshTokenService) ListSessions(userID uint) ([]models.Session, error) {
+	sessions := []models.Session{}
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC NULLS LAST, created_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Touch records activity on a session. Writes are skipped when the session
+// was already seen within lastSeenInterval.
+func (s *RefreshTokenService) Touch(sessionID, ip string) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	if last, ok := s.lastSeen[sessionID]; ok && now.Sub(last) < lastSeenInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastSeen[sessionID] = now
+	// Forget idle sessions now and then so the map does not grow forever
+	if now.Sub(s.lastSweep) > 10*lastSeenInterval {
+		for id, last := range s.lastSeen {
+			if now.Sub(last) > lastSeenInterval {
+				delete(s.lastSeen, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+
+	return s.db.Model(&models.Session{}).
+		Where("id = ?", sessionID).
+		Updates(map[string]interface{}{"last_seen_at": now, "ip": ip}).Error
+}
+
+// RevokeSession ends a single session of the user, including access tokens already issued for it
+func (s *RefreshTokenService) RevokeSession(userID uint, sessionID string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		if err := tx.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+			return err
+		}
+		return revokeSession(tx, session.ID, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.revocations.RevokeSession(userID, sessionID)
+}
+
+// RevokeOtherSessions ends every session of the user except the one given
+// and returns how many were ended
+func (s *RefreshTokenService) RevokeOtherSessions(userID uint, keepSessionID string) (int, error) {
+	var sessionIDs []string
+	if err := s.db.Model(&models.Session{}).
+		Where("user_id = ? AND id::text <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Pluck("id", &sessionIDs).Error; err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, sessionID := range sessionIDs {
+			if err := revokeSession(tx, sessionID, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := s.revocations.RevokeSession(userID, sessionID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(sessionIDs), nil
+}
+
+// RevokeAllSessions ends every session of the user on every device
+func (s *RefreshTokenService) RevokeAllSessions(userID uint) error {
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.revocations.RevokeUser(userID)
+}
+
+// issue stores a new refresh token for the session and returns its raw value
+func (s *RefreshTokenService) issue(tx *gorm.DB, session *models.Session, now time.Time) (string, error) {
+	rawToken, err := utils.GenerateOpaqueToken(refreshTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	token := models.RefreshToken{
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: session.ExpiresAt,
+		CreatedAt: now,
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", err
+	}
+
+	return rawToken, nil
+}
+
+// revokeSession marks the session and every refresh token in its family as revoked
+func revokeSession(tx *gorm.DB, sessionID string, now time.Time) error {
+	if err := tx.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error
+}
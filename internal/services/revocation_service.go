@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"tutuplapak/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationService keeps the list of revoked access tokens in Postgres and
+// mirrors it in memory so the auth middleware never hits the database.
+// Every instance reloads the list periodically to pick up revocations
+// written by other replicas.
+type RevocationService struct {
+	db             *gorm.DB
+	accessTokenTTL time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+func NewRevocationService(db *gorm.DB, accessTokenTTL time.Duration) *RevocationService {
+	return &RevocationService{
+		db:             db,
+		accessTokenTTL: accessTokenTTL,
+		entries:        make(map[string]time.Time),
+	}
+}
+
+func revocationKey(kind models.RevocationKind, subject string) string {
+	return string(kind) + ":" + subject
+}
+
+// Load replaces the in-memory cache with the unexpired rows from the database
+func (s *RevocationService) Load() error {
+	var rows []models.TokenRevocation
+	if err := s.db.Where("expires_at > ?", time.Now()).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	entries := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		entries[revocationKey(row.Kind, row.Subject)] = row.RevokedAt
+	}
+
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+	return nil
+}
+
+// Start reloads the cache and purges expired rows every interval until ctx is done
+func (s *RevocationService) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.db.Where("expires_at <= ?", time.Now()).Delete(&models.TokenRevocation{}).Error; err != nil {
+					log.Printf("Failed to purge expired token revocations: %v", err)
+				}
+				if err := s.Load(); err != nil {
+					log.Printf("Failed to reload token revocations: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// IsRevoked reports whether the token described by claims has been revoked
+func (s *RevocationService) IsRevoked(claims *models.JWTClaim) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.entries[revocationKey(models.RevocationKindToken, claims.TokenID())]; ok {
+		return true
+	}
+
+	if claims.SessionID != "" {
+		if _, ok := s.entries[revocationKey(models.RevocationKindSession, claims.SessionID)]; ok {
+			return true
+		}
+	}
+
+	if revokedAt, ok := s.entries[revocationKey(models.RevocationKindUser, strconv.FormatUint(uint64(claims.ID), 10))]; ok {
+		if claims.IssuedAt == nil || !claims.IssuedAt.After(revokedAt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RevokeToken revokes a single access token until it expires
+func (s *RevocationService) RevokeToken(userID uint, jti string, expiresAt time.Time) error {
+	return s.revoke(models.RevocationKindToken, jti, userID, expiresAt)
+}
+
+// RevokeSession revokes every access token issued for the session
+func (s *RevocationService) RevokeSession(userID uint, sessionID string) error {
+	return s.revoke(models.RevocationKindSession, sessionID, userID, time.Now().Add(s.accessTokenTTL))
+}
+
+// RevokeUser revokes every access token of the user issued up to now
+func (s *RevocationService) RevokeUser(userID uint) error {
+	return s.revoke(models.RevocationKindUser, strconv.FormatUint(uint64(userID), 10), userID, time.Now().Add(s.accessTokenTTL))
+}
+
+func (s *RevocationService) revoke(kind models.RevocationKind, subject string, userID uint, expiresAt time.Time) error {
+	row := models.TokenRevocation{
+		Kind:      kind,
+		Subject:   subject,
+		UserID:    userID,
+		RevokedAt: time.Now().Truncate(time.Second),
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_at", "expires_at"}),
+	}).Create(&row).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.entries[revocationKey(kind, subject)] = row.RevokedAt
+	s.mu.Unlock()
+	return nil
+}
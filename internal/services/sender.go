@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+)
+
+// Message is a notification addressed to an email address or phone number
+type Message struct {
+	Channel models.ContactType `json:"channel"`
+	To      string             `json:"to"`
+	Subject string             `json:"subject"`
+	Body    string             `json:"body"`
+}
+
+// Sender delivers messages to users. Production deployments plug in an
+// email or SMS provider; LogSender and FileSender are meant for development.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender builds the sender selected in the configuration
+func NewSender(cfg config.NotificationConfig) (Sender, error) {
+	switch cfg.Sender {
+	case "log", "":
+		return LogSender{ShowBody: cfg.LogBodies}, nil
+	case "file":
+		return NewFileSender(cfg.OutboxPath)
+	default:
+		return nil, fmt.Errorf("unsupported notification sender %q", cfg.Sender)
+	}
+}
+
+// LogSender writes every message to the application log. Bodies carry codes
+// and reset links, so they are redacted unless ShowBody is set.
+type LogSender struct {
+	ShowBody bool
+}
+
+func (s LogSender) Send(ctx context.Context, msg Message) error {
+	body := "[redacted]"
+	if s.ShowBody {
+		body = msg.Body
+	}
+	log.Printf("[%s] to=%s subject=%q body=%q", msg.Channel, msg.To, msg.Subject, body)
+	return nil
+}
+
+// FileSender appends every message as a JSON line to a local outbox file
+type FileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSender(path string) (*FileSender, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	return &FileSender{path: path}, nil
+}
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	line, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sentAt"`
+	}{msg, time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"tutuplapak/internal/models"
+)
+
+func TestLogSenderRedactsBody(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	msg := Message{Channel: models.ContactTypeEmail, To: "buyer@example.com", Subject: "Code", Body: "Your code is 123456"}
+	if err := (LogSender{}).Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "123456") {
+		t.Fatalf("expected the body to be redacted, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := (LogSender{ShowBody: true}).Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "123456") {
+		t.Fatalf("expected the body with ShowBody, got %q", out.String())
+	}
+}
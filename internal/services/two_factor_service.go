@@ -0,0 +1,444 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTwoFactorNotEnrolled   = errors.New("two-factor authentication is not enrolled")
+	ErrTwoFactorAlreadyActive = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorCodeInvalid   = errors.New("two-factor code is invalid")
+	ErrChallengeInvalid       = errors.New("login challenge is invalid or expired")
+	ErrTwoFactorKeyMissing    = errors.New("TWO_FACTOR_ENCRYPTION_KEY is required")
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew accepts codes from one step before and after the current one
+	totpSkew = 1
+	// recoveryCodeAlphabet avoids characters that are easy to misread
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	challengeTokenBytes  = 32
+)
+
+type TwoFactorService struct {
+	db  *gorm.DB
+	cfg config.TwoFactorConfig
+}
+
+// NewTwoFactorService fails without an encryption key so TOTP secrets are
+// never protected by a default or shared secret
+func NewTwoFactorService(db *gorm.DB, cfg config.TwoFactorConfig) (*TwoFactorService, error) {
+	if cfg.EncryptionKey == "" {
+		return nil, ErrTwoFactorKeyMissing
+	}
+	return &TwoFactorService{
+		db:  db,
+		cfg: cfg,
+	}, nil
+}
+
+// IsEnabled reports whether the user must pass a second factor to log in
+func (s *TwoFactorService) IsEnabled(userID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.TwoFactor{}).
+		Where("user_id = ? AND enabled_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Enroll creates a new pending secret for the user, replacing any earlier pending one
+func (s *TwoFactorService) Enroll(user *models.User) (*models.TwoFactorEnrollResponse, error) {
+	enabled, err := s.IsEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyActive
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := utils.EncryptSecret(s.cfg.EncryptionKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment := models.TwoFactor{
+		UserID:          user.ID,
+		SecretEncrypted: encrypted,
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret_encrypted", "last_used_step", "updated_at"}),
+	}).Create(&enrollment).Error; err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Phone
+	}
+	uri := utils.TOTPURI(s.cfg.Issuer, account, secret)
+
+	return &models.TwoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRPayload:  uri,
+	}, nil
+}
+
+// Activate enables a pending enrollment once the user proves the authenticator works
+// and returns a fresh set of recovery codes.
+func (s *TwoFactorService) Activate(userID uint, code string) ([]string, error) {
+	var codes []string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		enrollment, err := s.lockEnrollment(tx, userID)
+		if err != nil {
+			return err
+		}
+		if enrollment.EnabledAt != nil {
+			return ErrTwoFactorAlreadyActive
+		}
+
+		if err := s.checkCode(tx, enrollment, code); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(enrollment).Update("enabled_at", now).Error; err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable removes the enrollment and its recovery codes
+func (s *TwoFactorService) Disable(userID uint, code string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		enrollment, err := s.lockEnrollment(tx, userID)
+		if err != nil {
+			return err
+		}
+		if enrollment.EnabledAt == nil {
+			return ErrTwoFactorNotEnrolled
+		}
+		if err := s.checkLocked(enrollment); err != nil {
+			return err
+		}
+
+		if err := s.checkCode(tx, enrollment, code); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(enrollment).Error
+	})
+	return s.countFailure(userID, err)
+}
+
+// RegenerateRecoveryCodes invalidates the old recovery codes and returns new ones
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	var codes []string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		enrollment, err := s.lockEnrollment(tx, userID)
+		if err != nil {
+			return err
+		}
+		if enrollment.EnabledAt == nil {
+			return ErrTwoFactorNotEnrolled
+		}
+		if err := s.checkLocked(enrollment); err != nil {
+			return err
+		}
+
+		if err := s.checkCode(tx, enrollment, code); err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err := s.countFailure(userID, err); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CreateChallenge issues the short-lived token a client exchanges for a token pair
+// together with a second factor. identifier is the login throttle key of the
+// password step, empty when the user signed in another way.
+func (s *TwoFactorService) CreateChallenge(userID uint, deviceID, identifier string) (string, time.Time, error) {
+	rawToken, err := utils.GenerateOpaqueToken(challengeTokenBytes)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	challenge := models.LoginChallenge{
+		UserID:     userID,
+		TokenHash:  utils.HashToken(rawToken),
+		DeviceID:   deviceID,
+		Identifier: identifier,
+		ExpiresAt:  now.Add(s.cfg.ChallengeTTL),
+		CreatedAt:  now,
+	}
+	if err := s.db.Create(&challenge).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	return rawToken, challenge.ExpiresAt, nil
+}
+
+// CompleteChallenge checks the TOTP or recovery code for the challenge and
+// returns it, so the final tokens are issued for its user and device. Invalid
+// codes count against the challenge and the enrollment, which is locked with a
+// *ThrottledError after MaxFailures in a row. The challenge is also returned
+// with ErrTwoFactorCodeInvalid and *ThrottledError so the failure can be
+// attributed to its user.
+func (s *TwoFactorService) CompleteChallenge(rawToken, code, recoveryCode string) (*models.LoginChallenge, error) {
+	var (
+		challenge models.LoginChallenge
+		codeErr   error
+	)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(rawToken)).
+			First(&challenge).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrChallengeInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if challenge.UsedAt != nil || now.After(challenge.ExpiresAt) || challenge.Attempts >= s.cfg.MaxAttempts {
+			return ErrChallengeInvalid
+		}
+
+		enrollment, err := s.lockEnrollment(tx, challenge.UserID)
+		if err != nil {
+			return err
+		}
+		if codeErr = s.checkLocked(enrollment); codeErr != nil {
+			return nil
+		}
+
+		if recoveryCode != "" {
+			codeErr = useRecoveryCode(tx, challenge.UserID, recoveryCode, now)
+		} else {
+			codeErr = s.checkCode(tx, enrollment, code)
+		}
+
+		if errors.Is(codeErr, ErrTwoFactorCodeInvalid) {
+			// Keep the failed attempt, the transaction itself must commit
+			if err := tx.Model(&challenge).Update("attempts", challenge.Attempts+1).Error; err != nil {
+				return err
+			}
+			return s.recordFailure(tx, challenge.UserID)
+		}
+		if codeErr != nil {
+			return codeErr
+		}
+
+		if recoveryCode != "" {
+			if err := tx.Model(enrollment).Updates(resetFailures()).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&challenge).Update("used_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if codeErr != nil {
+		return &challenge, codeErr
+	}
+
+	return &challenge, nil
+}
+
+// checkLocked returns a *ThrottledError while the enrollment is locked
+func (s *TwoFactorService) checkLocked(enrollment *models.TwoFactor) error {
+	if enrollment.LockedUntil == nil {
+		return nil
+	}
+	if wait := time.Until(*enrollment.LockedUntil); wait > 0 {
+		return &ThrottledError{RetryAfter: wait, Locked: true}
+	}
+	return nil
+}
+
+// recordFailure counts an invalid code and locks the enrollment for
+// LockoutDuration once MaxFailures are reached
+func (s *TwoFactorService) recordFailure(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.TwoFactor{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]any{
+			"failed_attempts": gorm.Expr("failed_attempts + 1"),
+			"locked_until": gorm.Expr("CASE WHEN failed_attempts + 1 >= ? THEN ?::timestamptz ELSE locked_until END",
+				s.cfg.MaxFailures, time.Now().Add(s.cfg.LockoutDuration)),
+		}).Error
+}
+
+// resetFailures clears the failure count after a valid code
+func resetFailures() map[string]any {
+	return map[string]any{"failed_attempts": 0, "locked_until": nil}
+}
+
+// countFailure records an invalid code after its transaction was rolled back
+// and returns err unchanged
+func (s *TwoFactorService) countFailure(userID uint, err error) error {
+	if errors.Is(err, ErrTwoFactorCodeInvalid) {
+		if recordErr := s.recordFailure(s.db, userID); recordErr != nil {
+			return recordErr
+		}
+	}
+	return err
+}
+
+func (s *TwoFactorService) lockEnrollment(tx *gorm.DB, userID uint) (*models.TwoFactor, error) {
+	var enrollment models.TwoFactor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		First(&enrollment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// checkCode verifies a TOTP code, clears earlier failures and remembers its
+// step so it cannot be replayed.
+// A secret encrypted with a previous key is re-encrypted with the current one.
+func (s *TwoFactorService) checkCode(tx *gorm.DB, enrollment *models.TwoFactor, code string) error {
+	secret, current, err := s.decryptSecret(enrollment.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+
+	step, ok := utils.VerifyTOTP(secret, code, time.Now(), totpSkew)
+	if !ok || step <= enrollment.LastUsedStep {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	updates := resetFailures()
+	updates["last_used_step"] = step
+	if !current {
+		encrypted, err := utils.EncryptSecret(s.cfg.EncryptionKey, secret)
+		if err != nil {
+			return err
+		}
+		updates["secret_encrypted"] = encrypted
+	}
+	return tx.Model(enrollment).Updates(updates).Error
+}
+
+// decryptSecret tries the current key and then the previous ones, reporting
+// whether the current key was used
+func (s *TwoFactorService) decryptSecret(encrypted string) (string, bool, error) {
+	secret, err := utils.DecryptSecret(s.cfg.EncryptionKey, encrypted)
+	if err == nil {
+		return secret, true, nil
+	}
+	for _, key := range s.cfg.PreviousEncryptionKeys {
+		if secret, previousErr := utils.DecryptSecret(key, encrypted); previousErr == nil {
+			return secret, false, nil
+		}
+	}
+	return "", false, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{
+			UserID:    userID,
+			CodeHash:  utils.HashToken(normalizeRecoveryCode(code)),
+			CreatedAt: now,
+		})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func useRecoveryCode(tx *gorm.DB, userID uint, code string, now time.Time) error {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	return nil
+}
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	// Reject bytes above the largest multiple of the alphabet size to avoid modulo bias
+	limit := byte(256 - 256%len(recoveryCodeAlphabet))
+
+	var b strings.Builder
+	buf := make([]byte, 1)
+	for n := 0; n < 10; {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		if buf[0] >= limit {
+			continue
+		}
+		if n == 5 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(recoveryCodeAlphabet[int(buf[0])%len(recoveryCodeAlphabet)])
+		n++
+	}
+	return b.String(), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+)
+
+func TestNewTwoFactorServiceRequiresKey(t *testing.T) {
+	if _, err := NewTwoFactorService(nil, config.TwoFactorConfig{}); !errors.Is(err, ErrTwoFactorKeyMissing) {
+		t.Fatalf("expected ErrTwoFactorKeyMissing, got %v", err)
+	}
+}
+
+func TestDecryptSecretFallsBackToPreviousKeys(t *testing.T) {
+	s, err := NewTwoFactorService(nil, config.TwoFactorConfig{
+		EncryptionKey:          "new-key",
+		PreviousEncryptionKeys: []string{"retired-key", "old-key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := utils.EncryptSecret("old-key", "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, current, err := s.decryptSecret(sealed)
+	if err != nil || secret != "JBSWY3DPEHPK3PXP" || current {
+		t.Fatalf("expected the secret from a previous key, got %q %v %v", secret, current, err)
+	}
+
+	sealed, err = utils.EncryptSecret("new-key", "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, current, err := s.decryptSecret(sealed); err != nil || !current {
+		t.Fatalf("expected the current key to be used, got %v %v", current, err)
+	}
+
+	sealed, err = utils.EncryptSecret("unknown-key", "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.decryptSecret(sealed); err == nil {
+		t.Fatal("expected a secret under an unknown key to be rejected")
+	}
+}
+
+func TestCheckLocked(t *testing.T) {
+	s := &TwoFactorService{}
+
+	if err := s.checkLocked(&models.TwoFactor{}); err != nil {
+		t.Fatalf("expected an unlocked enrollment, got %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if err := s.checkLocked(&models.TwoFactor{LockedUntil: &past}); err != nil {
+		t.Fatalf("expected an expired lock to be ignored, got %v", err)
+	}
+
+	future := time.Now().Add(time.Minute)
+	var throttled *ThrottledError
+	if err := s.checkLocked(&models.TwoFactor{LockedUntil: &future}); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("expected a *ThrottledError, got %v", err)
+	}
+	if throttled.RetryAfter <= 0 || throttled.RetryAfter > time.Minute {
+		t.Fatalf("unexpected retry after %s", throttled.RetryAfter)
+	}
+}
+
+func TestGenerateRecoveryCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("unexpected format %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if normalizeRecoveryCode(" "+code+" ") != code[:5]+code[6:] {
+			t.Fatalf("unexpected normalized form of %q", code)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"tutuplapak/internal/config"
+	"tutuplapak/internal/models"
+	"tutuplapak/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrVerificationNotFound = errors.New("no pending verification")
+	ErrVerificationExpired  = errors.New("verification code has expired")
+	ErrInvalidCode          = errors.New("verification code is invalid")
+	ErrTooManyAttempts      = errors.New("too many invalid verification attempts")
+)
+
+// CooldownError is returned when a new code is requested too soon after the previous one
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("verification code was sent recently, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+const otpDigits = 6
+
+type VerificationService struct {
+	db     *gorm.DB
+	sender Sender
+	cfg    config.VerificationConfig
+}
+
+func NewVerificationService(db *gorm.DB, sender Sender, cfg config.VerificationConfig) *VerificationService {
+	return &VerificationService{
+		db:     db,
+		sender: sender,
+		cfg:    cfg,
+	}
+}
+
+// ResendCooldown is the minimum delay between two codes for the same channel
+func (s *VerificationService) ResendCooldown() time.Duration {
+	return s.cfg.ResendCooldown
+}
+
+// Start issues a new code for the target and sends it, replacing any pending
+// verification the user has on the same channel. The verification is only
+// saved once the code has been sent, so a failed send does not start the
+// resend cooldown.
+func (s *VerificationService) Start(ctx context.Context, userID uint, channel models.ContactType, target string) (*models.ContactVerification, error) {
+	now := time.Now()
+
+	code, err := generateOTP()
+	if err != nil {
+		return nil, err
+	}
+
+	verification := models.ContactVerification{
+		UserID:     userID,
+		Channel:    channel,
+		Target:     target,
+		CodeHash:   hashOTP(userID, channel, target, code),
+		Attempts:   0,
+		ExpiresAt:  now.Add(s.cfg.CodeTTL),
+		LastSentAt: now,
+	}
+	msg := Message{
+		Channel: channel,
+		To:      target,
+		Subject: "Your TutupLapak verification code",
+		Body:    fmt.Sprintf("Your TutupLapak verification code is %s. It expires in %d minutes.", code, int(s.cfg.CodeTTL.Minutes())),
+	}
+
+	var startErr error
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// The pending verification is only replaced once its cooldown is over;
+		// the upsert checks and claims the row in one statement, so concurrent
+		// requests cannot both pass the check
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "channel"}},
+			DoUpdates: clause.AssignmentColumns([]string{"target", "code_hash", "attempts", "expires_at", "last_sent_at", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Lte{Column: clause.Column{Table: "contact_verifications", Name: "last_sent_at"}, Value: now.Add(-s.cfg.ResendCooldown)},
+			}},
+		}).Create(&verification)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var pending models.ContactVerification
+			if err := tx.Where("user_id = ? AND channel = ?", userID, channel).First(&pending).Error; err != nil {
+				return err
+			}
+			wait := pending.LastSentAt.Add(s.cfg.ResendCooldown).Sub(now)
+			if wait < time.Second {
+				wait = time.Second
+			}
+			startErr = &CooldownError{RetryAfter: wait}
+			return nil
+		}
+
+		// The row stays locked until the code is out; a failed send rolls
+		// back to the previous verification
+		if err := s.sender.Send(ctx, msg); err != nil {
+			return fmt.Errorf("failed to send verification code: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if startErr != nil {
+		return nil, startErr
+	}
+
+	return &verification, nil
+}
+
+// Verify checks the code against the pending verification and returns the
+// verified target. The verification is consumed on success and discarded
+// once its attempts are exhausted.
+func (s *VerificationService) Verify(userID uint, channel models.ContactType, code string) (string, error) {
+	var target string
+	var verifyErr error
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var pending models.ContactVerification
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND channel = ?", userID, channel).
+			First(&pending).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				verifyErr = ErrVerificationNotFound
+				return nil
+			}
+			return err
+		}
+
+		if time.Now().After(pending.ExpiresAt) {
+			verifyErr = ErrVerificationExpired
+			return tx.Delete(&pending).Error
+		}
+
+		expected := hashOTP(userID, channel, pending.Target, code)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(pending.CodeHash)) != 1 {
+			pending.Attempts++
+			if pending.Attempts >= s.cfg.MaxAttempts {
+				verifyErr = ErrTooManyAttempts
+				return tx.Delete(&pending).Error
+			}
+			verifyErr = ErrInvalidCode
+			return tx.Model(&pending).Update("attempts", pending.Attempts).Error
+		}
+
+		target = pending.Target
+		return tx.Delete(&pending).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	if verifyErr != nil {
+		return "", verifyErr
+	}
+
+	return target, nil
+}
+
+func generateOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n), nil
+}
+
+// hashOTP binds the code to the user and target so a leaked hash cannot be replayed elsewhere
+func hashOTP(userID uint, channel models.ContactType, target, code string) string {
+	return utils.HashToken(fmt.Sprintf("%d:%s:%s:%s", userID, channel, target, code))
+}
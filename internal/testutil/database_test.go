@@ -0,0 +1,14 @@
+package testutil
+
+import "testing"
+
+func TestWithSearchPath(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"postgres://u:p@localhost:5432/db?sslmode=disable": "postgres://u:p@localhost:5432/db?search_path=test_1%2Cpublic&sslmode=disable",
+		"host=localhost dbname=db":                         "host=localhost dbname=db search_path=test_1,public",
+	} {
+		if got := withSearchPath(dsn, "test_1"); got != want {
+			t.Fatalf("%s: expected %s, got %s", dsn, want, got)
+		}
+	}
+}
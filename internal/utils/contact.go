@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// DefaultPhoneCountryCode is prefixed to local numbers written with a leading 0
+const DefaultPhoneCountryCode = "62"
+
+var (
+	ErrInvalidPhone = errors.New("phone number is invalid")
+
+	e164Regex = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	// phoneSeparators are characters people use to group digits
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+)
+
+// CanonicalEmail returns the form emails are stored and compared in
+func CanonicalEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// CanonicalPhone converts a phone number to E.164, e.g. "0812-3456-7890" and
+// "+62 812 3456 7890" both become "+6281234567890".
+func CanonicalPhone(phone string) (string, error) {
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+
+	switch {
+	case strings.HasPrefix(phone, "+"):
+	case strings.HasPrefix(phone, "00"):
+		phone = "+" + strings.TrimPrefix(phone, "00")
+	case strings.HasPrefix(phone, "0"):
+		phone = "+" + DefaultPhoneCountryCode + strings.TrimPrefix(phone, "0")
+	default:
+		phone = "+" + phone
+	}
+
+	if !e164Regex.MatchString(phone) {
+		return "", ErrInvalidPhone
+	}
+	return phone, nil
+}
+
+// IsEmailIdentifier tells an email apart from a phone number in a login identifier
+func IsEmailIdentifier(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
@@ -0,0 +1,43 @@
+package utils
+
+import "testing"
+
+func TestCanonicalEmail(t *testing.T) {
+	if got := CanonicalEmail("  Buyer@Example.COM "); got != "buyer@example.com" {
+		t.Fatalf("expected buyer@example.com, got %q", got)
+	}
+}
+
+func TestCanonicalPhone(t *testing.T) {
+	for input, want := range map[string]string{
+		"081234567890":       "+6281234567890",
+		"0812-3456-7890":     "+6281234567890",
+		"+62 812 3456 7890":  "+6281234567890",
+		"0062 812 3456 7890": "+6281234567890",
+		"6281234567890":      "+6281234567890",
+		"(0812) 3456.7890":   "+6281234567890",
+	} {
+		got, err := CanonicalPhone(input)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("%q: expected %s, got %s", input, want, got)
+		}
+	}
+
+	for _, input := range []string{"", "+", "12345", "+0812345678", "0812abc4567", "+123456789012345678"} {
+		if _, err := CanonicalPhone(input); err == nil {
+			t.Fatalf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestIsEmailIdentifier(t *testing.T) {
+	if !IsEmailIdentifier("buyer@example.com") {
+		t.Fatal("expected an email identifier")
+	}
+	if IsEmailIdentifier("+6281234567890") {
+		t.Fatal("expected a phone identifier")
+	}
+}
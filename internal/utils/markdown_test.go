@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	got, err := RenderMarkdown("**Kaos** _polos_\n\n- katun\n- [toko](https://example.com)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<strong>Kaos</strong>",
+		"<em>polos</em>",
+		"<li>katun</li>",
+		`<a href="https://example.com" rel="nofollow noopener" target="_blank">toko</a>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+
+	if got, err := RenderMarkdown(""); err != nil || got != "" {
+		t.Fatalf("expected nothing for an empty description, got %q, %v", got, err)
+	}
+}
+
+func TestRenderMarkdownStripsUnsafeHTML(t *testing.T) {
+	for _, source := range []string{
+		"<script>alert(1)</script>",
+		"Kaos <script>alert(1)</script> polos",
+		`<img src="x" onerror="alert(1)">`,
+		`<a href="https://example.com" onclick="alert(1)">toko</a>`,
+		"[toko](javascript:alert(1))",
+		"[toko](JavaScript:alert(1))",
+		`[toko](  javascript:alert(1) "judul")`,
+		"![foto](javascript:alert(1))",
+		"<iframe src=\"https://example.com\"></iframe>",
+		"[toko](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+	} {
+		got, err := RenderMarkdown(source)
+		if err != nil {
+			t.Fatalf("%q: %v", source, err)
+		}
+		lower := strings.ToLower(got)
+		for _, unsafe := range []string{"<script", "onerror", "onclick", "javascript:", "<iframe", "data:text/html"} {
+			if strings.Contains(lower, unsafe) {
+				t.Errorf("%q: rendered %q still contains %s", source, got, unsafe)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheapPasswordParams keeps the tests fast; restored when the test ends
+func cheapPasswordParams(t *testing.T) Argon2Params {
+	t.Helper()
+	previous := passwordParams
+	t.Cleanup(func() { UsePasswordParams(previous) })
+
+	params := Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	UsePasswordParams(params)
+	return params
+}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	cheapPasswordParams(t)
+
+	hash, err := HashPassword("rahasia123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+	if err := VerifyPassword("rahasia123", hash); err != nil {
+		t.Fatalf("expected the password to verify, got %v", err)
+	}
+	if err := VerifyPassword("rahasia124", hash); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("expected ErrPasswordMismatch, got %v", err)
+	}
+	if PasswordNeedsRehash(hash) {
+		t.Fatal("expected a hash with the current parameters not to need a rehash")
+	}
+
+	// Every hash gets its own salt
+	again, err := HashPassword("rahasia123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hash {
+		t.Fatal("expected two hashes of one password to differ")
+	}
+}
+
+func TestVerifyPasswordAcceptsLegacyBcrypt(t *testing.T) {
+	cheapPasswordParams(t)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("rahasia123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPassword("rahasia123", string(legacy)); err != nil {
+		t.Fatalf("expected the bcrypt hash to verify, got %v", err)
+	}
+	if err := VerifyPassword("rahasia124", string(legacy)); err == nil {
+		t.Fatal("expected a wrong password to fail against the bcrypt hash")
+	}
+	if !PasswordNeedsRehash(string(legacy)) {
+		t.Fatal("expected a bcrypt hash to need a rehash")
+	}
+}
+
+func TestPasswordNeedsRehashOnParameterChange(t *testing.T) {
+	params := cheapPasswordParams(t)
+	hash, err := HashPassword("rahasia123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, change := range map[string]func(*Argon2Params){
+		"memory":      func(p *Argon2Params) { p.Memory *= 2 },
+		"iterations":  func(p *Argon2Params) { p.Iterations++ },
+		"parallelism": func(p *Argon2Params) { p.Parallelism++ },
+		"salt length": func(p *Argon2Params) { p.SaltLength = 32 },
+		"key length":  func(p *Argon2Params) { p.KeyLength = 64 },
+	} {
+		changed := params
+		change(&changed)
+		UsePasswordParams(changed)
+		if !PasswordNeedsRehash(hash) {
+			t.Errorf("expected a change in %s to need a rehash", name)
+		}
+		// The old hash keeps verifying until it is replaced
+		if err := VerifyPassword("rahasia123", hash); err != nil {
+			t.Errorf("expected the old hash to verify after a change in %s, got %v", name, err)
+		}
+	}
+
+	UsePasswordParams(params)
+	if PasswordNeedsRehash(hash) {
+		t.Fatal("expected no rehash with the original parameters")
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"$argon2id$",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+	} {
+		if err := VerifyPassword("rahasia123", hash); err == nil {
+			t.Errorf("%q: expected an error", hash)
+		}
+		if !PasswordNeedsRehash(hash) {
+			t.Errorf("%q: expected a malformed hash to need a rehash", hash)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify lower-cases s and joins its runs of letters and digits with hyphens,
+// e.g. "Home & Garden" becomes "home-garden".
+func Slugify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// IsSlug reports whether s is already in the form Slugify produces
+func IsSlug(s string) bool {
+	return s != "" && Slugify(s) == s
+}
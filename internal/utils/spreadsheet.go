@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// xlsxUnzipSizeLimit bounds the uncompressed size of a workbook, so a
+	// small upload cannot expand into gigabytes
+	xlsxUnzipSizeLimit = 64 << 20
+	// xlsxUnzipXMLSizeLimit is how much of a worksheet is unzipped in memory;
+	// larger sheets are streamed from a temporary file
+	xlsxUnzipXMLSizeLimit = 8 << 20
+)
+
+// EachCSVRow calls fn with every record of a CSV file and stops at the first
+// error fn returns. A leading byte order mark is dropped and rows may have
+// different numbers of fields.
+func EachCSVRow(data []byte, fn func(row []string) error) error {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// EachXLSXRow calls fn with the formatted cell values of every row of the
+// first sheet of an XLSX workbook and stops at the first error fn returns.
+// The sheet is streamed rather than loaded at once; empty rows are passed
+// as empty slices.
+func EachXLSXRow(data []byte, fn func(row []string) error) error {
+	file, err := excelize.OpenReader(bytes.NewReader(data), excelize.Options{
+		UnzipSizeLimit:    xlsxUnzipSizeLimit,
+		UnzipXMLSizeLimit: xlsxUnzipXMLSizeLimit,
+	})
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return errors.New("workbook has no sheets")
+	}
+	rows, err := file.Rows(sheets[0])
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Error()
+}
+
+// IsBlankRow reports whether every cell of row is empty or whitespace
+func IsBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
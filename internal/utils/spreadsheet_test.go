@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestEachXLSXRowKeepsRowNumbers(t *testing.T) {
+	file := excelize.NewFile()
+	defer file.Close()
+	sheet := file.GetSheetName(0)
+	for cell, value := range map[string]any{"A1": "name", "B1": "qty", "A3": "Kaos", "B3": 12} {
+		if err := file.SetCellValue(sheet, cell, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows [][]string
+	err = EachXLSXRow(buf.Bytes(), func(row []string) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"name", "qty"}, nil, {"Kaos", "12"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("expected %q, got %q", want, rows)
+	}
+}
+
+func TestEachCSVRowDropsByteOrderMark(t *testing.T) {
+	var rows [][]string
+	err := EachCSVRow([]byte("\xef\xbb\xbfname,qty\nKaos\n"), func(row []string) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"name", "qty"}, {"Kaos"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("expected %q, got %q", want, rows)
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyTOTPAcceptsSkewedSteps(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_800_000_000, 0)
+	current := now.Unix() / TOTPPeriod
+
+	for _, step := range []int64{current - 1, current, current + 1} {
+		code, err := TOTPCode(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := VerifyTOTP(secret, code, now, 1)
+		if !ok || got != step {
+			t.Fatalf("step %d: expected a match, got %d %v", step, got, ok)
+		}
+	}
+
+	code, err := TOTPCode(secret, current-2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := VerifyTOTP(secret, code, now, 1); ok {
+		t.Fatal("expected a code outside the skew to be rejected")
+	}
+}
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 secret "12345678901234567890" at T = 59s, truncated to 6 digits
+	code, err := TOTPCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 59/TOTPPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Fatalf("expected 287082, got %s", code)
+	}
+}
+
+func TestDecryptSecretRejectsOtherKey(t *testing.T) {
+	sealed, err := EncryptSecret("current-key", "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := DecryptSecret("current-key", sealed)
+	if err != nil || plaintext != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected the secret back, got %q %v", plaintext, err)
+	}
+	if _, err := DecryptSecret("other-key", sealed); err == nil {
+		t.Fatal("expected decryption with another key to fail")
+	}
+}
@@ -91,3 +91,16 @@ func PasswordValidation(password string) *models.ErrorResponse {
 	}
 	return nil
 }
+
+// NormalizePhone validates a phone number and returns it in E.164 form
+func NormalizePhone(phone string) (string, *models.ErrorResponse) {
+	canonical, err := CanonicalPhone(phone)
+	if err != nil {
+		return "", &models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid phone number",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	return canonical, nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
 	"tutuplapak/internal/config"
 	"tutuplapak/internal/database"
@@ -10,6 +12,7 @@ import (
 	"tutuplapak/internal/middleware"
 	"tutuplapak/internal/routes"
 	"tutuplapak/internal/services"
+	"tutuplapak/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -24,6 +27,9 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Parameters for new password hashes
+	utils.UsePasswordParams(cfg.Password.Argon2Params())
+
 	// Connect to database
 	if err := database.Connect(cfg.DatabaseURL); err != nil {
 		log.Fatal("Failed to connect to database:", err)
@@ -55,17 +61,73 @@ func main() {
 		minioService = nil
 	}
 
+	// Load access token signing keys
+	keyManager, err := middleware.NewKeyManager(cfg.Auth.Signing, cfg.JWTSecret)
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	middleware.UseKeys(keyManager)
+	keyManager.Start(context.Background())
+
+	// Initialize token revocation list and session store
+	revocationService := services.NewRevocationService(database.DB, middleware.AccessTokenTTL)
+	if err := revocationService.Load(); err != nil {
+		log.Fatal("Failed to load token revocation list:", err)
+	}
+	revocationService.Start(context.Background(), time.Minute)
+	refreshTokenService := services.NewRefreshTokenService(database.DB, cfg.Auth.RefreshTokenTTL, revocationService)
+	apiKeyService := services.NewAPIKeyService(database.DB)
+	authenticator := middleware.NewAuthenticator(revocationService, apiKeyService, refreshTokenService)
+	accessService := services.NewAccessService(database.DB)
+	auditService := services.NewAuditService(database.DB)
+	accountService := services.NewAccountService(database.DB, refreshTokenService)
+	if minioService != nil {
+		minioService.StartDeletionWorker(context.Background(), time.Minute)
+	}
+
+	// Initialize contact verification
+	sender, err := services.NewSender(cfg.Notification)
+	if err != nil {
+		log.Fatal("Failed to initialize notification sender:", err)
+	}
+	verificationService := services.NewVerificationService(database.DB, sender, cfg.Verification)
+	passwordResetService := services.NewPasswordResetService(database.DB, sender, refreshTokenService, cfg.PasswordReset)
+	if cfg.TwoFactor.EncryptionKey == cfg.JWTSecret {
+		log.Fatal("TWO_FACTOR_ENCRYPTION_KEY must differ from JWT_SECRET")
+	}
+	twoFactorService, err := services.NewTwoFactorService(database.DB, cfg.TwoFactor)
+	if err != nil {
+		log.Fatal("Failed to initialize two-factor authentication:", err)
+	}
+	oidcService := services.NewOIDCService(database.DB, cfg.OIDC)
+	reauthService := services.NewReauthService(database.DB)
+	categoryService := services.NewCategoryService(database.DB)
+
 	// Initialize handlers with database connection
 	healthHandler := handlers.NewHealthHandler()
-	userHandler := handlers.NewUserHandler(database.DB)
-	registerHandler := handlers.NewRegisterHandler(database.DB)
-	loginHandler := handlers.NewLoginHandler(database.DB)
+	userHandler := handlers.NewUserHandler(database.DB, verificationService, refreshTokenService, reauthService, auditService)
+	registerHandler := handlers.NewRegisterHandler(database.DB, refreshTokenService, accessService, auditService)
+	loginHandler := handlers.NewLoginHandler(database.DB, refreshTokenService, accessService, services.NewLoginGuard(database.DB, cfg.Login), twoFactorService, auditService)
 	fileHandler := handlers.NewFileHandler(minioService)
-	productHandler := handlers.NewProductHandler(database.DB)
+	productHandler := handlers.NewProductHandler(database.DB, categoryService, cfg.Product)
 	purchaseHandler := handlers.NewPurchaseHandler(database.DB)
+	authHandler := handlers.NewAuthHandler(database.DB, refreshTokenService, accessService, revocationService, auditService)
+	jwksHandler := handlers.NewJWKSHandler(keyManager)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(database.DB, twoFactorService, reauthService, auditService)
+	adminHandler := handlers.NewAdminHandler(database.DB, accessService, revocationService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	sessionHandler := handlers.NewSessionHandler(refreshTokenService, auditService)
+	accountHandler := handlers.NewAccountHandler(database.DB, accountService, minioService, reauthService, auditService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, loginHandler, reauthService, auditService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+
+	// Run queued product imports
+	productHandler.StartImportWorker(context.Background(), 5*time.Second)
 
 	// Setup routes
-	routes.SetupRoutes(router, healthHandler, userHandler, registerHandler, loginHandler, fileHandler, productHandler, purchaseHandler)
+	routes.SetupRoutes(router, healthHandler, userHandler, registerHandler, loginHandler, fileHandler, productHandler, purchaseHandler, authHandler, authenticator, jwksHandler, passwordResetHandler, twoFactorHandler, adminHandler, apiKeyHandler, auditHandler, sessionHandler, accountHandler, oidcHandler, categoryHandler)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
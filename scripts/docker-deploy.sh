@@ -39,6 +39,7 @@ DB_NAME=tutuplapak_db
 
 # JWT Configuration
 JWT_SECRET=generalist-production
+TWO_FACTOR_ENCRYPTION_KEY=$(openssl rand -base64 32)
 
 # MinIO Configuration
 MINIO_ENDPOINT=minio:9000